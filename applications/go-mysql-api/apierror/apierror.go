@@ -0,0 +1,144 @@
+// Package apierror turns the errors of request handlers into HTTP
+// responses with stable, machine-readable codes. Errors from the store and
+// the MySQL driver are mapped to their status: a missing row is 404, a
+// duplicate key 409 naming the field, and a deadlock 503 to be retried.
+// Anything unrecognised is a 500 whose cause is logged but never sent.
+package apierror
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"goapp_CI/store"
+	"goapp_CI/validate"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Codes of the errors, stable for clients to match on
+const (
+	CodeBadRequest           = "bad_request"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeInvalidCredentials   = "invalid_credentials"
+	CodeInvalidToken         = "invalid_token"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeDuplicate            = "duplicate"
+	CodeConflict             = "conflict"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeRateLimited          = "rate_limited"
+	CodeInternal             = "internal_error"
+	CodeUnavailable          = "temporarily_unavailable"
+)
+
+// MySQL server error numbers
+const (
+	mysqlDuplicateEntry  = 1062
+	mysqlLockWaitTimeout = 1205
+	mysqlDeadlock        = 1213
+)
+
+// Error is an error with the HTTP response describing it
+type Error struct {
+	Status int
+	Code   string
+	// Detail is shown to the client
+	Detail string
+	// Field is the request field at fault, e.g. a duplicate username
+	Field string
+	// Errors are the invalid fields of a validation_failed error
+	Errors validate.Errors
+	// RetryAfter is sent with 429 and 503 errors
+	RetryAfter time.Duration
+	// Err is the cause; it is logged but not sent
+	Err error
+}
+
+// New returns an Error with status, code and detail
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Detail + ": " + e.Err.Error()
+	}
+	return e.Code + ": " + e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// duplicateKey extracts the key from "Duplicate entry 'x' for key
+// 'users.username'"; MySQL 5.7 leaves out the table
+var duplicateKey = regexp.MustCompile(`for key '(?:[^']*\.)?([^'.]+)'$`)
+
+// From returns the Error describing err. resource names what the request
+// was about, e.g. "User", in the details of not found and conflict errors.
+func From(err error, resource string) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if resource == "" {
+		resource = "Resource"
+	}
+
+	var fieldErrs validate.Errors
+	var mysqlErr *mysql.MySQLError
+	switch {
+	case errors.As(err, &fieldErrs):
+		return &Error{Status: http.StatusBadRequest, Code: CodeValidationFailed, Detail: "Invalid request: " + fieldErrs.Error(), Errors: fieldErrs}
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, sql.ErrNoRows):
+		return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Detail: resource + " not found", Err: err}
+	case errors.Is(err, store.ErrConflict):
+		// Requests with If-Match report a lost race as 412 themselves
+		return &Error{Status: http.StatusConflict, Code: CodeConflict, Detail: resource + " was modified by another request", Err: err}
+	case errors.Is(err, store.ErrDuplicate):
+		return &Error{Status: http.StatusConflict, Code: CodeDuplicate, Detail: resource + " already exists", Err: err}
+	case errors.Is(err, store.ErrInvalidCursor):
+		return &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Detail: "Invalid cursor", Err: err}
+	case errors.As(err, &mysqlErr):
+		switch mysqlErr.Number {
+		case mysqlDuplicateEntry:
+			e := &Error{Status: http.StatusConflict, Code: CodeDuplicate, Detail: resource + " already exists", Err: err}
+			if m := duplicateKey.FindStringSubmatch(mysqlErr.Message); m != nil {
+				e.Field = m[1]
+				e.Detail = fmt.Sprintf("%s with this %s already exists", resource, m[1])
+			}
+			return e
+		case mysqlDeadlock, mysqlLockWaitTimeout:
+			return unavailable(err)
+		}
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, mysql.ErrInvalidConn), errors.Is(err, context.DeadlineExceeded):
+		return unavailable(err)
+	}
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Detail: "Internal server error", Err: err}
+}
+
+// unavailable describes a transient database failure worth retrying
+func unavailable(err error) *Error {
+	return &Error{
+		Status:     http.StatusServiceUnavailable,
+		Code:       CodeUnavailable,
+		Detail:     "The request could not be completed, try again",
+		RetryAfter: time.Second,
+		Err:        err,
+	}
+}
+
+// problemType is the URI identifying the kind of problem with code
+func problemType(code string) string {
+	return "urn:go-mysql-api:problem:" + code
+}
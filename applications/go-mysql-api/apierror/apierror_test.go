@@ -0,0 +1,114 @@
+package apierror
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"goapp_CI/store"
+	"goapp_CI/validate"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+		field  string
+	}{
+		{"not found", store.ErrNotFound, 404, CodeNotFound, "User not found", ""},
+		{"no rows", fmt.Errorf("loading: %w", sql.ErrNoRows), 404, CodeNotFound, "User not found", ""},
+		{"version conflict", store.ErrConflict, 409, CodeConflict, "User was modified by another request", ""},
+		{"duplicate", store.ErrDuplicate, 409, CodeDuplicate, "User already exists", ""},
+		{"duplicate MySQL 8", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'alice' for key 'users.username'"}, 409, CodeDuplicate, "User with this username already exists", "username"},
+		{"duplicate MySQL 5.7", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@example.com' for key 'email'"}, 409, CodeDuplicate, "User with this email already exists", "email"},
+		{"deadlock", &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}, 503, CodeUnavailable, "The request could not be completed, try again", ""},
+		{"lock wait timeout", &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, 503, CodeUnavailable, "The request could not be completed, try again", ""},
+		{"bad connection", mysql.ErrInvalidConn, 503, CodeUnavailable, "The request could not be completed, try again", ""},
+		{"other MySQL error", &mysql.MySQLError{Number: 1146, Message: "Table 'users.users' doesn't exist"}, 500, CodeInternal, "Internal server error", ""},
+		{"unknown", errors.New("dial tcp 10.0.0.5:3306: secret detail"), 500, CodeInternal, "Internal server error", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := From(tt.err, "User")
+			assert.Equal(t, tt.status, e.Status)
+			assert.Equal(t, tt.code, e.Code)
+			assert.Equal(t, tt.detail, e.Detail)
+			assert.Equal(t, tt.field, e.Field)
+			assert.ErrorIs(t, e, tt.err)
+		})
+	}
+
+	e := New(http.StatusForbidden, CodeForbidden, "Permission denied")
+	assert.Same(t, e, From(fmt.Errorf("wrapped: %w", e), "User"))
+
+	e = From(validate.Errors{{Field: "email", Code: validate.CodeRequired, Message: "is required"}}, "")
+	assert.Equal(t, http.StatusBadRequest, e.Status)
+	assert.Equal(t, CodeValidationFailed, e.Code)
+	assert.Len(t, e.Errors, 1)
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   Format
+	}{
+		{"", FormatProblem},
+		{"*/*", FormatProblem},
+		{"application/json", FormatLegacy},
+		{"application/json, application/problem+json", FormatProblem},
+		{"text/html, application/json;q=0.9", FormatLegacy},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		assert.Equal(t, tt.want, Negotiate(r, FormatProblem), tt.accept)
+	}
+	assert.Equal(t, FormatLegacy, Negotiate(httptest.NewRequest("GET", "/", nil), FormatLegacy))
+}
+
+func TestWrite(t *testing.T) {
+	err := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'alice' for key 'users.username'"}
+
+	r := httptest.NewRequest("POST", "/users", nil)
+	rec := httptest.NewRecorder()
+	Write(rec, r, From(err, "User"), FormatProblem)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+	var problem map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+	assert.Equal(t, map[string]any{
+		"type":     "urn:go-mysql-api:problem:duplicate",
+		"title":    "Conflict",
+		"status":   float64(409),
+		"detail":   "User with this username already exists",
+		"instance": "/users",
+		"code":     "duplicate",
+		"field":    "username",
+	}, problem)
+
+	r.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	Write(rec, r, From(err, "User"), FormatProblem)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"success": false, "message": "User with this username already exists", "code": "duplicate", "field": "username"}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	Write(rec, r, &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, FormatProblem)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.NotContains(t, rec.Body.String(), "Deadlock")
+}
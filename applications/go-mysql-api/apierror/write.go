@@ -0,0 +1,116 @@
+package apierror
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"goapp_CI/logging"
+	"goapp_CI/validate"
+)
+
+// Format is how errors are rendered
+type Format string
+
+const (
+	// FormatProblem renders RFC 7807 application/problem+json
+	FormatProblem Format = "problem"
+	// FormatLegacy renders the {"success": false, "message": ...} envelope
+	// of the API's first clients
+	FormatLegacy Format = "legacy"
+)
+
+// ParseFormat parses "problem" or "legacy"
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatProblem, FormatLegacy:
+		return f, nil
+	}
+	return "", fmt.Errorf("apierror: unknown format %q", s)
+}
+
+// Negotiate picks the format for r: problem+json when the Accept header
+// names it, the legacy envelope when it names only application/json, and
+// def otherwise
+func Negotiate(r *http.Request, def Format) Format {
+	var json bool
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(part))
+			switch mediaType {
+			case "application/problem+json":
+				return FormatProblem
+			case "application/json":
+				json = true
+			}
+		}
+	}
+	if json {
+		return FormatLegacy
+	}
+	return def
+}
+
+// Problem is an RFC 7807 problem details object with the extension members
+// of this API
+type Problem struct {
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Status    int             `json:"status"`
+	Detail    string          `json:"detail,omitempty"`
+	Instance  string          `json:"instance,omitempty"`
+	Code      string          `json:"code"`
+	Field     string          `json:"field,omitempty"`
+	Errors    validate.Errors `json:"errors,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+}
+
+// legacy is the envelope of the API's first clients, with the code added
+type legacy struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Code    string          `json:"code"`
+	Field   string          `json:"field,omitempty"`
+	Errors  validate.Errors `json:"errors,omitempty"`
+}
+
+// Write responds to r with err, in the format Negotiate picks. Server
+// errors are logged with their cause.
+func Write(w http.ResponseWriter, r *http.Request, err error, def Format) {
+	e := From(err, "")
+	ctx := r.Context()
+	logging.AddAttrs(ctx, slog.String("error_code", e.Code))
+	if e.Status >= 500 && e.Err != nil {
+		logging.FromContext(ctx).Error("request failed", "code", e.Code, "error", e.Err)
+	}
+
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+	}
+
+	var body any
+	if Negotiate(r, def) == FormatLegacy {
+		w.Header().Set("Content-Type", "application/json")
+		body = legacy{Message: e.Detail, Code: e.Code, Field: e.Field, Errors: e.Errors}
+	} else {
+		w.Header().Set("Content-Type", "application/problem+json")
+		body = Problem{
+			Type:      problemType(e.Code),
+			Title:     http.StatusText(e.Status),
+			Status:    e.Status,
+			Detail:    e.Detail,
+			Instance:  r.URL.Path,
+			Code:      e.Code,
+			Field:     e.Field,
+			Errors:    e.Errors,
+			RequestID: logging.RequestID(ctx),
+		}
+	}
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"goapp_CI/logging"
+	"goapp_CI/store"
+)
+
+// APIKeyPrefix starts every generated API key, which has the form
+// gma_<lookup prefix>_<secret>
+const APIKeyPrefix = "gma_"
+
+// touchInterval limits how often last-used timestamps are written
+const touchInterval = time.Minute
+
+// GenerateAPIKey returns a new key together with the lookup prefix and hash
+// to store for it. The key itself must only be shown to its creator.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	b := make([]byte, 4+32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	prefix = hex.EncodeToString(b[:4])
+	key = APIKeyPrefix + prefix + "_" + base64.RawURLEncoding.EncodeToString(b[4:])
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the hex SHA-256 of key. Keys are random, so a fast hash
+// is sufficient.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyLookup returns the lookup prefix of a generated key
+func apiKeyLookup(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, APIKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	return prefix, ok && prefix != "" && secret != ""
+}
+
+type staticKey struct {
+	hash [sha256.Size]byte
+	id   Identity
+}
+
+// APIKeyAuthenticator authenticates machine clients by the key in the
+// X-API-Key header or a non-JWT Authorization: Bearer header
+type APIKeyAuthenticator struct {
+	keys store.APIKeyStore
+	now  func() time.Time
+
+	mu     sync.RWMutex
+	static []staticKey
+}
+
+// NewAPIKeyAuthenticator returns an authenticator for the keys in keys
+func NewAPIKeyAuthenticator(keys store.APIKeyStore) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{keys: keys, now: time.Now}
+}
+
+// AddStatic accepts key, e.g. one provisioned from a secret store, as a
+// non-expiring key called name with scopes
+func (a *APIKeyAuthenticator) AddStatic(name, key string, scopes []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.static = append(a.static, staticKey{
+		hash: sha256.Sum256([]byte(key)),
+		id:   Identity{Username: "apikey:" + name, Scopes: scopes},
+	})
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (Identity, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		token, ok := bearerToken(r)
+		if !ok {
+			return Identity{}, ErrNoCredentials
+		}
+		key = token
+	}
+
+	if id, ok := a.matchStatic(key); ok {
+		return id, nil
+	}
+
+	prefix, ok := apiKeyLookup(key)
+	if !ok {
+		return Identity{}, ErrInvalidToken
+	}
+	k, err := a.keys.GetAPIKeyByPrefix(r.Context(), prefix)
+	if errors.Is(err, store.ErrNotFound) {
+		return Identity{}, ErrInvalidToken
+	}
+	if err != nil {
+		return Identity{}, err
+	}
+
+	hash := HashAPIKey(key)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(k.SecretHash)) != 1 {
+		return Identity{}, ErrInvalidToken
+	}
+	now := a.now()
+	if k.RevokedAt != nil || (k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)) {
+		return Identity{}, ErrInvalidToken
+	}
+
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= touchInterval {
+		// A failed write must not fail the request it is recording
+		if err := a.keys.TouchAPIKey(r.Context(), k.ID, now); err != nil {
+			logging.FromContext(r.Context()).Warn("recording use of API key", "api_key_id", k.ID, "error", err)
+		}
+	}
+
+	return Identity{Username: "apikey:" + k.Name, APIKeyID: k.ID, Scopes: k.Scopes}, nil
+}
+
+func (a *APIKeyAuthenticator) matchStatic(key string) (Identity, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	sum := sha256.Sum256([]byte(key))
+	for _, s := range a.static {
+		if subtle.ConstantTimeCompare(sum[:], s.hash[:]) == 1 {
+			return s.id, true
+		}
+	}
+	return Identity{}, false
+}
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goapp_CI/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func newTestService(t *testing.T, signing Key, previous ...Key) *TokenService {
+	ks, err := NewKeySet(signing, previous...)
+	require.NoError(t, err)
+	return NewTokenService(ks, "test-issuer", "test-audience", time.Minute, time.Hour)
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	hmacKey, err := NewHMACKey("hs", testSecret)
+	require.NoError(t, err)
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edKey, err := NewPrivateKey("ed", edPriv)
+	require.NoError(t, err)
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaKey, err := NewPrivateKey("rs", rsaPriv)
+	require.NoError(t, err)
+
+	for _, key := range []Key{hmacKey, edKey, rsaKey} {
+		t.Run(key.Method.Alg(), func(t *testing.T) {
+			svc := newTestService(t, key)
+			pair, err := svc.Issue(Identity{UserID: 7, Username: "alice", Role: "user"})
+			require.NoError(t, err)
+			assert.Equal(t, "Bearer", pair.TokenType)
+			assert.Equal(t, 60, pair.ExpiresIn)
+
+			id, err := svc.Verify(pair.AccessToken, AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, Identity{UserID: 7, Username: "alice", Role: "user"}, id)
+
+			_, err = svc.Verify(pair.RefreshToken, AccessToken)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+			_, err = svc.Verify(pair.RefreshToken, RefreshToken)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, _ := NewHMACKey("2024", testSecret)
+	newKey, _ := NewHMACKey("2025", []byte(strings.Repeat("n", 32)))
+
+	oldSvc := newTestService(t, oldKey)
+	pair, err := oldSvc.Issue(Identity{UserID: 1})
+	require.NoError(t, err)
+
+	rotated := newTestService(t, newKey, oldKey)
+	_, err = rotated.Verify(pair.AccessToken, AccessToken)
+	assert.NoError(t, err, "tokens signed with a previous key stay valid")
+
+	retired := newTestService(t, newKey)
+	_, err = retired.Verify(pair.AccessToken, AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestVerifyRejectsExpiredAndForeignTokens(t *testing.T) {
+	key, _ := NewHMACKey("k", testSecret)
+	svc := newTestService(t, key)
+	pair, err := svc.Issue(Identity{UserID: 1})
+	require.NoError(t, err)
+
+	svc.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	_, err = svc.Verify(pair.AccessToken, AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	other := newTestService(t, key)
+	other.audience = "someone-else"
+	_, err = other.Verify(pair.AccessToken, AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestNewHMACKeyRequiresLongSecret(t *testing.T) {
+	_, err := NewHMACKey("k", []byte("short"))
+	assert.Error(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	key, _ := NewHMACKey("k", testSecret)
+	svc := newTestService(t, key)
+	pair, err := svc.Issue(Identity{UserID: 3, Username: "carol"})
+	require.NoError(t, err)
+
+	var seen Identity
+	handler := Middleware(func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}, svc)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = FromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"no header", "", http.StatusUnauthorized},
+		{"garbage", "Bearer not-a-jwt", http.StatusUnauthorized},
+		{"refresh token", "Bearer " + pair.RefreshToken, http.StatusUnauthorized},
+		{"access token", "Bearer " + pair.AccessToken, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/users", nil)
+			if test.header != "" {
+				req.Header.Set("Authorization", test.header)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, test.status, recorder.Code)
+			if test.status == http.StatusUnauthorized {
+				assert.Contains(t, recorder.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+		})
+	}
+	assert.Equal(t, "carol", seen.Username)
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	keys := store.NewMemoryStore()
+	a := NewAPIKeyAuthenticator(keys)
+	a.AddStatic("ci", "static-secret", []string{"users:read"})
+
+	newKey := func(expires *time.Time) (string, int) {
+		key, prefix, hash, err := GenerateAPIKey()
+		require.NoError(t, err)
+		k := store.APIKey{Name: "deploy", Prefix: prefix, SecretHash: hash, Scopes: []string{"users:write"}, ExpiresAt: expires}
+		require.NoError(t, keys.CreateAPIKey(ctx, &k))
+		return key, k.ID
+	}
+	valid, validID := newKey(nil)
+	past := time.Now().Add(-time.Hour)
+	expired, _ := newKey(&past)
+	revoked, revokedID := newKey(nil)
+	require.NoError(t, keys.RevokeAPIKey(ctx, revokedID))
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   Identity
+		err    error
+	}{
+		{"no header", "", "", Identity{}, ErrNoCredentials},
+		{"x-api-key", "X-API-Key", valid, Identity{Username: "apikey:deploy", APIKeyID: validID, Scopes: []string{"users:write"}}, nil},
+		{"bearer", "Authorization", "Bearer " + valid, Identity{Username: "apikey:deploy", APIKeyID: validID, Scopes: []string{"users:write"}}, nil},
+		{"static", "X-API-Key", "static-secret", Identity{Username: "apikey:ci", Scopes: []string{"users:read"}}, nil},
+		{"wrong secret", "X-API-Key", valid[:len(valid)-2] + "xx", Identity{}, ErrInvalidToken},
+		{"unknown format", "X-API-Key", "nope", Identity{}, ErrInvalidToken},
+		{"expired", "X-API-Key", expired, Identity{}, ErrInvalidToken},
+		{"revoked", "X-API-Key", revoked, Identity{}, ErrInvalidToken},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/users", nil)
+			if test.header != "" {
+				req.Header.Set(test.header, test.value)
+			}
+			id, err := a.Authenticate(req)
+			if test.err != nil {
+				assert.ErrorIs(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, id)
+		})
+	}
+
+	k, err := keys.GetAPIKeyByPrefix(ctx, strings.Split(valid, "_")[1])
+	require.NoError(t, err)
+	assert.NotNil(t, k.LastUsedAt)
+}
+
+func TestMiddlewareFallsThroughToAPIKeys(t *testing.T) {
+	key, _ := NewHMACKey("k", testSecret)
+	svc := newTestService(t, key)
+	a := NewAPIKeyAuthenticator(store.NewMemoryStore())
+	a.AddStatic("ci", "static-secret", nil)
+
+	handler := Middleware(func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}, svc, a)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Authorization", "Bearer static-secret")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestClientCertAuthenticator(t *testing.T) {
+	verified := func(cn string) *http.Request {
+		req := httptest.NewRequest("GET", "/users", nil)
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn, Organization: []string{"Example"}}}
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return req
+	}
+
+	a := NewClientCertAuthenticator([]string{"reporting"}, []string{"users:read"})
+	id, err := a.Authenticate(verified("reporting"))
+	require.NoError(t, err)
+	assert.Equal(t, "reporting", id.Username)
+	assert.Equal(t, "CN=reporting,O=Example", id.ClientCert)
+	assert.Equal(t, []string{"users:read"}, id.Scopes)
+
+	_, err = a.Authenticate(verified("billing"))
+	assert.ErrorIs(t, err, ErrNoCredentials)
+
+	// Presented but unverified certificates do not count
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "reporting"}}}}
+	_, err = a.Authenticate(req)
+	assert.ErrorIs(t, err, ErrNoCredentials)
+
+	_, err = a.Authenticate(httptest.NewRequest("GET", "/users", nil))
+	assert.ErrorIs(t, err, ErrNoCredentials)
+
+	// Without names any verified certificate is accepted
+	id, err = NewClientCertAuthenticator(nil, nil).Authenticate(verified("billing"))
+	require.NoError(t, err)
+	assert.Equal(t, "billing", id.Username)
+}
@@ -0,0 +1,30 @@
+// Package auth authenticates API callers and carries their identity on the
+// request context.
+package auth
+
+import "context"
+
+// Identity is the authenticated caller of a request. Users carry a UserID
+// and Role; API keys carry their APIKeyID and Scopes instead, and clients
+// authenticated by certificate its subject in ClientCert and their Scopes.
+type Identity struct {
+	UserID     int
+	Username   string
+	Role       string
+	APIKeyID   int
+	ClientCert string
+	Scopes     []string
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying id
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity stored in ctx by the middleware
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a JWT key identified by the kid header. Verify-only keys have no
+// signing key and are kept so tokens issued before a rotation stay valid
+// until they expire.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	sign   any
+	verify any
+}
+
+// NewHMACKey returns an HS256 key
+func NewHMACKey(id string, secret []byte) (Key, error) {
+	if len(secret) < 32 {
+		return Key{}, fmt.Errorf("auth: HMAC secret for key %q must be at least 32 bytes", id)
+	}
+	return Key{ID: id, Method: jwt.SigningMethodHS256, sign: secret, verify: secret}, nil
+}
+
+// NewPrivateKey returns a signing key for an RSA (RS256) or Ed25519 (EdDSA) private key
+func NewPrivateKey(id string, priv crypto.Signer) (Key, error) {
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		return Key{ID: id, Method: jwt.SigningMethodRS256, sign: k, verify: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return Key{ID: id, Method: jwt.SigningMethodEdDSA, sign: k, verify: k.Public()}, nil
+	default:
+		return Key{}, fmt.Errorf("auth: unsupported private key type %T", priv)
+	}
+}
+
+// NewPublicKey returns a verify-only key for an RSA or Ed25519 public key
+func NewPublicKey(id string, pub crypto.PublicKey) (Key, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return Key{ID: id, Method: jwt.SigningMethodRS256, verify: k}, nil
+	case ed25519.PublicKey:
+		return Key{ID: id, Method: jwt.SigningMethodEdDSA, verify: k}, nil
+	default:
+		return Key{}, fmt.Errorf("auth: unsupported public key type %T", pub)
+	}
+}
+
+// LoadPrivateKey reads a PEM encoded PKCS#8 or PKCS#1 private key from path
+func LoadPrivateKey(id, path string) (Key, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return Key{}, err
+	}
+
+	priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		rsaKey, rsaErr := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if rsaErr != nil {
+			return Key{}, fmt.Errorf("auth: parsing private key %s: %w", path, err)
+		}
+		priv = rsaKey
+	}
+
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return Key{}, fmt.Errorf("auth: unsupported private key type %T", priv)
+	}
+	return NewPrivateKey(id, signer)
+}
+
+// LoadPublicKey reads a PEM encoded PKIX public key from path
+func LoadPublicKey(id, path string) (Key, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return Key{}, err
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return Key{}, fmt.Errorf("auth: parsing public key %s: %w", path, err)
+	}
+	return NewPublicKey(id, pub)
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("auth: no PEM data in %s", path)
+	}
+	return block, nil
+}
+
+// KeySet holds the current signing key and every key accepted for verification
+type KeySet struct {
+	signing Key
+	keys    map[string]Key
+}
+
+// NewKeySet returns a KeySet signing with signing and additionally
+// verifying tokens signed by any of previous
+func NewKeySet(signing Key, previous ...Key) (*KeySet, error) {
+	if signing.sign == nil {
+		return nil, errors.New("auth: signing key has no private part")
+	}
+
+	ks := &KeySet{signing: signing, keys: map[string]Key{signing.ID: signing}}
+	for _, k := range previous {
+		if _, dup := ks.keys[k.ID]; dup {
+			return nil, fmt.Errorf("auth: duplicate key id %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+	return ks, nil
+}
+
+// methods returns the algorithms of all keys in the set
+func (ks *KeySet) methods() []string {
+	seen := make(map[string]bool)
+	var methods []string
+	for _, k := range ks.keys {
+		if alg := k.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// keyfunc selects the verification key by kid and refuses algorithm
+// substitution, e.g. an HS256 token signed with an RSA public key
+func (ks *KeySet) keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("key %q does not use %s", kid, token.Method.Alg())
+	}
+	return k.verify, nil
+}
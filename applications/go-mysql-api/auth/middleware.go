@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Authenticator resolves the caller of a request. It returns
+// ErrNoCredentials when the request carries no credentials for it.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Identity, error)
+}
+
+// ErrorHandler writes the response for a request that failed authentication
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+// Middleware requires every request to be authenticated by one of
+// authenticators, tried in order, and stores the identity on the context
+func Middleware(onError ErrorHandler, authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, a := range authenticators {
+				id, err := a.Authenticate(r)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if err != nil {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					onError(w, r, err)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+				return
+			}
+
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			onError(w, r, ErrNoCredentials)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Token types carried in the typ claim
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request does not
+// carry credentials it understands, so the next one can be tried
+var ErrNoCredentials = errors.New("auth: no credentials")
+
+// ErrInvalidToken is returned for malformed, expired or wrongly signed tokens
+var ErrInvalidToken = errors.New("auth: invalid token")
+
+// Claims are the JWT claims issued by the API
+type Claims struct {
+	jwt.RegisteredClaims
+	Username string `json:"username"`
+	Role     string `json:"role,omitempty"`
+	Type     string `json:"typ"`
+}
+
+// TokenPair is returned on login and refresh
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// TokenService issues and verifies access and refresh tokens
+type TokenService struct {
+	keys       *KeySet
+	issuer     string
+	audience   string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	now        func() time.Time
+}
+
+// NewTokenService returns a TokenService signing with keys
+func NewTokenService(keys *KeySet, issuer, audience string, accessTTL, refreshTTL time.Duration) *TokenService {
+	return &TokenService{
+		keys:       keys,
+		issuer:     issuer,
+		audience:   audience,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		now:        time.Now,
+	}
+}
+
+// Issue returns a new access and refresh token for id
+func (t *TokenService) Issue(id Identity) (TokenPair, error) {
+	access, err := t.sign(id, AccessToken, t.accessTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refresh, err := t.sign(id, RefreshToken, t.refreshTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(t.accessTTL / time.Second),
+	}, nil
+}
+
+// Verify parses token and checks its signature, expiry, issuer, audience
+// and that it is of the expected type
+func (t *TokenService) Verify(token, typ string) (Identity, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims, t.keys.keyfunc,
+		jwt.WithValidMethods(t.keys.methods()),
+		jwt.WithIssuer(t.issuer),
+		jwt.WithAudience(t.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(t.now),
+	)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Type != typ {
+		return Identity{}, fmt.Errorf("%w: expected %s token", ErrInvalidToken, typ)
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: bad subject", ErrInvalidToken)
+	}
+	return Identity{UserID: userID, Username: claims.Username, Role: claims.Role}, nil
+}
+
+// Authenticate verifies the access token in the Authorization header
+func (t *TokenService) Authenticate(r *http.Request) (Identity, error) {
+	token, ok := bearerToken(r)
+	if !ok || strings.Count(token, ".") != 2 {
+		return Identity{}, ErrNoCredentials
+	}
+	return t.Verify(token, AccessToken)
+}
+
+func (t *TokenService) sign(id Identity, typ string, ttl time.Duration) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	now := t.now()
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.issuer,
+			Subject:   strconv.Itoa(id.UserID),
+			Audience:  jwt.ClaimStrings{t.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			ID:        hex.EncodeToString(jti),
+		},
+		Username: id.Username,
+		Role:     id.Role,
+		Type:     typ,
+	}
+
+	key := t.keys.signing
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.sign)
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
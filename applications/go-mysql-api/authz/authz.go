@@ -0,0 +1,137 @@
+// Package authz decides whether an authenticated subject may perform an
+// action on a resource.
+package authz
+
+import (
+	"errors"
+	"fmt"
+
+	"goapp_CI/auth"
+)
+
+// Roles assigned to users
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Scopes granted to API keys
+const (
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+)
+
+// Scopes lists every scope an API key may be given
+var Scopes = []string{ScopeUsersRead, ScopeUsersWrite}
+
+// ValidScope reports whether scope is one of Scopes
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Action is an operation on a resource
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionRead   Action = "read"
+	ActionList   Action = "list"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Resource identifies what an action applies to. OwnerID is the ID of the
+// user owning the resource, or zero for collections.
+type Resource struct {
+	Type    string
+	OwnerID int
+}
+
+// ErrDenied is returned when the policy does not allow an action
+var ErrDenied = errors.New("authz: permission denied")
+
+// Policy evaluates (subject, action, resource) triples
+type Policy interface {
+	Authorize(sub auth.Identity, action Action, res Resource) error
+}
+
+// Rule reports whether it grants sub the action on res
+type Rule func(sub auth.Identity, action Action, res Resource) bool
+
+// RulePolicy allows an action when any of its rules grants it
+type RulePolicy struct {
+	rules []Rule
+}
+
+// NewRulePolicy returns a policy built from rules
+func NewRulePolicy(rules ...Rule) *RulePolicy {
+	return &RulePolicy{rules: rules}
+}
+
+func (p *RulePolicy) Authorize(sub auth.Identity, action Action, res Resource) error {
+	for _, rule := range p.rules {
+		if rule(sub, action, res) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s %s", ErrDenied, action, res.Type)
+}
+
+// Default returns the API policy: admins may do everything, other users
+// may read, update and delete their own user record, and API keys may read
+// and create users as far as their scopes allow. Keys never update or
+// delete users, which would let them take over any account, admins included.
+func Default() *RulePolicy {
+	return NewRulePolicy(
+		AllowRole(RoleAdmin),
+		AllowOwner(ActionRead, ActionUpdate, ActionDelete),
+		AllowScope(ScopeUsersRead, "user", ActionRead, ActionList),
+		AllowScope(ScopeUsersWrite, "user", ActionCreate),
+	)
+}
+
+// AllowRole grants every action to subjects with role
+func AllowRole(role string) Rule {
+	return func(sub auth.Identity, action Action, res Resource) bool {
+		return sub.Role == role
+	}
+}
+
+// AllowOwner grants actions on resources owned by the subject
+func AllowOwner(actions ...Action) Rule {
+	return func(sub auth.Identity, action Action, res Resource) bool {
+		if res.OwnerID == 0 || res.OwnerID != sub.UserID {
+			return false
+		}
+		return hasAction(actions, action)
+	}
+}
+
+// AllowScope grants actions on resources of resType to subjects holding scope
+func AllowScope(scope, resType string, actions ...Action) Rule {
+	return func(sub auth.Identity, action Action, res Resource) bool {
+		if res.Type != resType || !hasAction(actions, action) {
+			return false
+		}
+		for _, s := range sub.Scopes {
+			if s == scope {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func hasAction(actions []Action, action Action) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package authz
+
+import (
+	"testing"
+
+	"goapp_CI/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	admin := auth.Identity{UserID: 1, Role: RoleAdmin}
+	alice := auth.Identity{UserID: 2, Role: RoleUser}
+	users := Resource{Type: "user"}
+	aliceRecord := Resource{Type: "user", OwnerID: 2}
+	bobRecord := Resource{Type: "user", OwnerID: 3}
+	reader := auth.Identity{APIKeyID: 1, Scopes: []string{ScopeUsersRead}}
+	writer := auth.Identity{APIKeyID: 2, Scopes: []string{ScopeUsersRead, ScopeUsersWrite}}
+	keys := Resource{Type: "api_key"}
+
+	tests := []struct {
+		name    string
+		sub     auth.Identity
+		action  Action
+		res     Resource
+		allowed bool
+	}{
+		{"admin lists", admin, ActionList, users, true},
+		{"admin creates", admin, ActionCreate, users, true},
+		{"admin deletes others", admin, ActionDelete, bobRecord, true},
+		{"user lists", alice, ActionList, users, false},
+		{"user creates", alice, ActionCreate, users, false},
+		{"user reads self", alice, ActionRead, aliceRecord, true},
+		{"user updates self", alice, ActionUpdate, aliceRecord, true},
+		{"user deletes self", alice, ActionDelete, aliceRecord, true},
+		{"user reads other", alice, ActionRead, bobRecord, false},
+		{"user updates other", alice, ActionUpdate, bobRecord, false},
+		{"user deletes other", alice, ActionDelete, bobRecord, false},
+		{"no role", auth.Identity{UserID: 2}, ActionList, users, false},
+		{"reader key lists", reader, ActionList, users, true},
+		{"reader key reads", reader, ActionRead, bobRecord, true},
+		{"reader key deletes", reader, ActionDelete, bobRecord, false},
+		{"writer key creates", writer, ActionCreate, users, true},
+		{"writer key updates", writer, ActionUpdate, bobRecord, false},
+		{"writer key deletes", writer, ActionDelete, bobRecord, false},
+		{"key manages keys", writer, ActionCreate, keys, false},
+		{"admin manages keys", admin, ActionCreate, keys, true},
+		{"user manages keys", alice, ActionList, keys, false},
+	}
+
+	p := Default()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := p.Authorize(test.sub, test.action, test.res)
+			if test.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrDenied)
+			}
+		})
+	}
+}
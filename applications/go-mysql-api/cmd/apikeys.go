@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"goapp_CI/apierror"
+	"goapp_CI/auth"
+	"goapp_CI/authz"
+	"goapp_CI/conff"
+	"goapp_CI/store"
+	"goapp_CI/validate"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateAPIKeyRequest represents the request body for creating an API key
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreatedAPIKey is returned once when a key is created; Key is never
+// stored or shown again
+type CreatedAPIKey struct {
+	store.APIKey
+	Key string `json:"key"`
+}
+
+// apiKeyResource describes the API keys collection, managed by admins only
+var apiKeyResource = authz.Resource{Type: "api_key"}
+
+// configureStaticAPIKey accepts the key from API_KEY, if set
+func configureStaticAPIKey(s *server, cfg *conff.Config) error {
+	if cfg.APIKey == "" {
+		return nil
+	}
+	for _, scope := range cfg.APIKeyScopes {
+		if !authz.ValidScope(scope) {
+			return fmt.Errorf("unknown scope %q in API_KEY_SCOPES", scope)
+		}
+	}
+	s.apiKeys.AddStatic("static", cfg.APIKey, cfg.APIKeyScopes)
+	return nil
+}
+
+func (s *server) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, authz.ActionCreate, apiKeyResource) {
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	var errs validate.Errors
+	s.validator.Value(&errs, "name", req.Name, "required,max=100")
+	if len(req.Scopes) == 0 {
+		errs.Add("scopes", validate.CodeRequired, "is required")
+	}
+	for _, scope := range req.Scopes {
+		if !authz.ValidScope(scope) {
+			errs.Add("scopes", validate.CodeInvalidValue, "unknown scope %q", scope)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		errs.Add("expires_at", validate.CodeInvalidValue, "must be in the future")
+	}
+	if len(errs) > 0 {
+		s.respondWithError(w, r, errs)
+		return
+	}
+
+	key, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		s.respondWithError(w, r, apierror.From(err, ""))
+		return
+	}
+
+	id, _ := auth.FromContext(r.Context())
+	k := store.APIKey{
+		Name:       req.Name,
+		Prefix:     prefix,
+		SecretHash: hash,
+		Scopes:     req.Scopes,
+		CreatedBy:  id.UserID,
+		ExpiresAt:  req.ExpiresAt,
+	}
+	if err := s.keys.CreateAPIKey(r.Context(), &k); err != nil {
+		s.respondWithError(w, r, apierror.From(err, "API key"))
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, Response{
+		Success: true,
+		Message: "API key created successfully; store the key now, it will not be shown again",
+		Data:    CreatedAPIKey{APIKey: k, Key: key},
+	})
+}
+
+func (s *server) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, authz.ActionList, apiKeyResource) {
+		return
+	}
+
+	keys, err := s.keys.ListAPIKeys(r.Context())
+	if err != nil {
+		s.respondWithError(w, r, apierror.From(err, "API key"))
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "API keys retrieved successfully",
+		Data:    keys,
+	})
+}
+
+func (s *server) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		s.respondWithError(w, r, apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "Invalid API key ID"))
+		return
+	}
+
+	if !s.allow(w, r, authz.ActionDelete, apiKeyResource) {
+		return
+	}
+
+	if err := s.keys.RevokeAPIKey(r.Context(), id); err != nil {
+		s.respondWithError(w, r, apierror.From(err, "API key"))
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "API key revoked successfully",
+	})
+}
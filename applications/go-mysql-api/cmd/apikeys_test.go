@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"goapp_CI/auth"
+	"goapp_CI/authz"
+	"goapp_CI/conff"
+	"goapp_CI/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createdKeyResponse mirrors Response with a created key as data
+type createdKeyResponse struct {
+	Success bool          `json:"success"`
+	Data    CreatedAPIKey `json:"data"`
+}
+
+// Test creating, using, listing and revoking an API key
+func TestAPIKeyLifecycle(t *testing.T) {
+	router := newServer(store.NewMemoryStore(), testPasswords(), testTokens).routes()
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	body, _ := json.Marshal(CreateAPIKeyRequest{Name: "ci", Scopes: []string{authz.ScopeUsersRead}})
+	req, _ := http.NewRequest("POST", "/admin/api-keys", bytes.NewBuffer(body))
+	authorize(req)
+	recorder := serve(req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	var created createdKeyResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	assert.True(t, created.Success)
+	assert.Contains(t, created.Data.Key, auth.APIKeyPrefix+created.Data.Prefix+"_")
+	key := created.Data.Key
+	assert.NotContains(t, recorder.Body.String(), auth.HashAPIKey(key))
+
+	// The key works in either header and is limited to its scopes
+	req, _ = http.NewRequest("GET", "/users", nil)
+	req.Header.Set("X-API-Key", key)
+	assert.Equal(t, http.StatusOK, serve(req).Code)
+
+	req, _ = http.NewRequest("GET", "/users", nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	assert.Equal(t, http.StatusOK, serve(req).Code)
+
+	req, _ = http.NewRequest("DELETE", "/users/1", nil)
+	req.Header.Set("X-API-Key", key)
+	assert.Equal(t, http.StatusForbidden, serve(req).Code)
+
+	req, _ = http.NewRequest("GET", "/admin/api-keys", nil)
+	req.Header.Set("X-API-Key", key)
+	assert.Equal(t, http.StatusForbidden, serve(req).Code)
+
+	// Listings never include the secret
+	req, _ = http.NewRequest("GET", "/admin/api-keys", nil)
+	authorize(req)
+	recorder = serve(req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), key)
+	assert.Contains(t, recorder.Body.String(), `"last_used_at"`)
+
+	req, _ = http.NewRequest("DELETE", "/admin/api-keys/1", nil)
+	authorize(req)
+	assert.Equal(t, http.StatusOK, serve(req).Code)
+
+	req, _ = http.NewRequest("GET", "/users", nil)
+	req.Header.Set("X-API-Key", key)
+	assert.Equal(t, http.StatusUnauthorized, serve(req).Code)
+
+	req, _ = http.NewRequest("DELETE", "/admin/api-keys/99", nil)
+	authorize(req)
+	assert.Equal(t, http.StatusNotFound, serve(req).Code)
+}
+
+// Test that only admins manage API keys and requests are validated
+func TestCreateAPIKeyValidation(t *testing.T) {
+	_, router := setupTest(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		as     auth.Identity
+		status int
+	}{
+		{"regular user", `{"name":"ci","scopes":["users:read"]}`, auth.Identity{UserID: 2, Role: authz.RoleUser}, http.StatusForbidden},
+		{"missing scopes", `{"name":"ci"}`, auth.Identity{UserID: 1, Role: authz.RoleAdmin}, http.StatusBadRequest},
+		{"unknown scope", `{"name":"ci","scopes":["root"]}`, auth.Identity{UserID: 1, Role: authz.RoleAdmin}, http.StatusBadRequest},
+		{"expired", `{"name":"ci","scopes":["users:read"],"expires_at":"2000-01-01T00:00:00Z"}`, auth.Identity{UserID: 1, Role: authz.RoleAdmin}, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/admin/api-keys", bytes.NewBufferString(test.body))
+			authorizeAs(req, test.as)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			assert.Equal(t, test.status, recorder.Code)
+		})
+	}
+}
+
+// Test the key provisioned through API_KEY
+func TestStaticAPIKey(t *testing.T) {
+	s := newServer(store.NewMemoryStore(), testPasswords(), testTokens)
+	require.Error(t, configureStaticAPIKey(s, &conff.Config{APIKey: "k", APIKeyScopes: []string{"root"}}))
+	require.NoError(t, configureStaticAPIKey(s, &conff.Config{APIKey: "provisioned-key", APIKeyScopes: []string{authz.ScopeUsersRead}}))
+	router := s.routes()
+
+	req, _ := http.NewRequest("GET", "/users", nil)
+	req.Header.Set("X-API-Key", "provisioned-key")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
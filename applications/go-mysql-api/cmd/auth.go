@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"goapp_CI/apierror"
+	"goapp_CI/auth"
+	"goapp_CI/authz"
+	"goapp_CI/conff"
+)
+
+// LoginRequest represents the request body for logging in
+type LoginRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// RefreshRequest represents the request body for refreshing tokens
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// newTokenService builds the JWT key set described by cfg
+func newTokenService(cfg *conff.Config) (*auth.TokenService, error) {
+	var signing auth.Key
+	var err error
+
+	switch cfg.JWTAlgorithm {
+	case "HS256":
+		if cfg.JWTSecret == "" {
+			return nil, fmt.Errorf("JWT_SECRET is required for HS256")
+		}
+		signing, err = auth.NewHMACKey(cfg.JWTKeyID, []byte(cfg.JWTSecret))
+	case "RS256", "EdDSA":
+		if cfg.JWTPrivateKeyFile == "" {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE is required for %s", cfg.JWTAlgorithm)
+		}
+		signing, err = auth.LoadPrivateKey(cfg.JWTKeyID, cfg.JWTPrivateKeyFile)
+		if err == nil && signing.Method.Alg() != cfg.JWTAlgorithm {
+			err = fmt.Errorf("JWT_PRIVATE_KEY_FILE holds a %s key, not %s", signing.Method.Alg(), cfg.JWTAlgorithm)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q", cfg.JWTAlgorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var previous []auth.Key
+	for _, entry := range cfg.JWTPreviousSecrets {
+		kid, secret, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("JWT_PREVIOUS_SECRETS entries must be kid=secret")
+		}
+		k, err := auth.NewHMACKey(kid, []byte(secret))
+		if err != nil {
+			return nil, err
+		}
+		previous = append(previous, k)
+	}
+	for _, entry := range cfg.JWTPublicKeyFiles {
+		kid, path, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("JWT_PUBLIC_KEY_FILES entries must be kid=path")
+		}
+		k, err := auth.LoadPublicKey(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		previous = append(previous, k)
+	}
+
+	keys, err := auth.NewKeySet(signing, previous...)
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewTokenService(keys, cfg.JWTIssuer, cfg.JWTAudience, cfg.JWTAccessTTL, cfg.JWTRefreshTTL), nil
+}
+
+// requireAuth rejects requests without a valid access token, API key or,
+// in mTLS mode, client certificate
+func (s *server) requireAuth(next http.Handler) http.Handler {
+	authenticators := []auth.Authenticator{s.tokens, s.apiKeys}
+	if s.clientCerts != nil {
+		authenticators = append(authenticators, s.clientCerts)
+	}
+	return auth.Middleware(s.respondUnauthorized, authenticators...)(logIdentity(next))
+}
+
+func (s *server) respondUnauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	s.respondWithError(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required"))
+}
+
+// userResource describes the user with id, or the users collection for id 0.
+// A user record is owned by the user it describes.
+func userResource(id int) authz.Resource {
+	return authz.Resource{Type: "user", OwnerID: id}
+}
+
+// allow checks the caller's permission for action on res and responds with
+// 403 when it is denied
+func (s *server) allow(w http.ResponseWriter, r *http.Request, action authz.Action, res authz.Resource) bool {
+	id, _ := auth.FromContext(r.Context())
+	if err := s.policy.Authorize(id, action, res); err != nil {
+		s.respondWithError(w, r, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "Permission denied"))
+		return false
+	}
+	return true
+}
+
+func (s *server) login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if !s.decodeJSON(w, r, &req) || !s.valid(w, r, &req) {
+		return
+	}
+
+	user, err := s.authenticate(r.Context(), req.Username, req.Password)
+	if errors.Is(err, errInvalidCredentials) {
+		s.respondWithError(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid username or password"))
+		return
+	}
+	if err != nil {
+		s.respondWithError(w, r, apierror.From(err, ""))
+		return
+	}
+
+	tokens, err := s.tokens.Issue(auth.Identity{UserID: user.ID, Username: user.Username, Role: user.Role})
+	if err != nil {
+		s.respondWithError(w, r, apierror.From(err, ""))
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Login successful",
+		Data:    tokens,
+	})
+}
+
+func (s *server) refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if !s.decodeJSON(w, r, &req) || !s.valid(w, r, &req) {
+		return
+	}
+
+	id, err := s.tokens.Verify(req.RefreshToken, auth.RefreshToken)
+	if err != nil {
+		s.respondWithError(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid refresh token"))
+		return
+	}
+
+	// Deleted users must not be able to keep refreshing their session
+	user, err := s.users.Get(r.Context(), id.UserID)
+	if err != nil {
+		s.respondWithError(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid refresh token"))
+		return
+	}
+
+	tokens, err := s.tokens.Issue(auth.Identity{UserID: user.ID, Username: user.Username, Role: user.Role})
+	if err != nil {
+		s.respondWithError(w, r, apierror.From(err, ""))
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Tokens refreshed successfully",
+		Data:    tokens,
+	})
+}
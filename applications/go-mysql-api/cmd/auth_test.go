@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"goapp_CI/auth"
+	"goapp_CI/conff"
+	"goapp_CI/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenResponse mirrors Response with the token pair as data
+type tokenResponse struct {
+	Success bool           `json:"success"`
+	Data    auth.TokenPair `json:"data"`
+}
+
+func postJSON(router http.Handler, path string, body any) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// Test that /users routes reject requests without a valid token
+func TestUsersRequireAuthentication(t *testing.T) {
+	recorder, router := setupTest(t)
+
+	req, _ := http.NewRequest("GET", "/users", nil)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, "Bearer", recorder.Header().Get("WWW-Authenticate"))
+
+	var response Response
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.False(t, response.Success)
+
+	req, _ = http.NewRequest("DELETE", "/users/1", nil)
+	req.Header.Set("Authorization", "Bearer forged.token.value")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+// Test login, using the access token and refreshing it
+func TestLoginAndRefresh(t *testing.T) {
+	users := store.NewMemoryStore()
+	srv := newServer(users, testPasswords(), testTokens)
+	router := srv.routes()
+
+	hash, err := srv.passwords.Hash("password123")
+	require.NoError(t, err)
+	require.NoError(t, users.Create(context.Background(), &User{Username: "alice", Email: "alice@example.com", Password: hash}))
+
+	recorder := postJSON(router, "/auth/login", LoginRequest{Username: "alice", Password: "wrong"})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = postJSON(router, "/auth/login", LoginRequest{Username: "alice", Password: "password123"})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var login tokenResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &login))
+	require.NotEmpty(t, login.Data.AccessToken)
+
+	req, _ := http.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("Authorization", "Bearer "+login.Data.AccessToken)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	// An access token cannot be used to refresh
+	recorder = postJSON(router, "/auth/refresh", RefreshRequest{RefreshToken: login.Data.AccessToken})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = postJSON(router, "/auth/refresh", RefreshRequest{RefreshToken: login.Data.RefreshToken})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var refreshed tokenResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &refreshed))
+	assert.NotEmpty(t, refreshed.Data.AccessToken)
+
+	// Deleted users cannot refresh
+	require.NoError(t, users.Delete(context.Background(), 1))
+	recorder = postJSON(router, "/auth/refresh", RefreshRequest{RefreshToken: refreshed.Data.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+// Test key configuration validation
+func TestNewTokenService(t *testing.T) {
+	cfg := &conff.Config{JWTAlgorithm: "HS256", JWTKeyID: "k1"}
+	_, err := newTokenService(cfg)
+	assert.ErrorContains(t, err, "JWT_SECRET")
+
+	cfg.JWTSecret = "0123456789abcdef0123456789abcdef"
+	cfg.JWTPreviousSecrets = []string{"k0=fedcba9876543210fedcba9876543210"}
+	_, err = newTokenService(cfg)
+	assert.NoError(t, err)
+
+	cfg.JWTPreviousSecrets = []string{"missing-separator"}
+	_, err = newTokenService(cfg)
+	assert.Error(t, err)
+
+	cfg.JWTAlgorithm = "none"
+	_, err = newTokenService(cfg)
+	assert.Error(t, err)
+}
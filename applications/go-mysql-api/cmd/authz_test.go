@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"goapp_CI/auth"
+	"goapp_CI/authz"
+	"goapp_CI/conff"
+	"goapp_CI/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that regular users only manage their own record
+func TestSelfServiceAuthorization(t *testing.T) {
+	users := store.NewMemoryStore()
+	router := newServer(users, testPasswords(), testTokens).routes()
+
+	for _, name := range []string{"alice", "bob"} {
+		require.NoError(t, users.Create(context.Background(), &User{Username: name, Email: name + "@example.com", Password: "x", Role: authz.RoleUser}))
+	}
+	alice := auth.Identity{UserID: 1, Username: "alice", Role: authz.RoleUser}
+
+	update, _ := json.Marshal(UpdateUserRequest{Username: "alice2", Email: "alice2@example.com", Password: "newpassword123"})
+	create, _ := json.Marshal(CreateUserRequest{Username: "carol", Email: "carol@example.com", Password: "password123"})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   []byte
+		status int
+	}{
+		{"list users", "GET", "/users", nil, http.StatusForbidden},
+		{"create user", "POST", "/users", create, http.StatusForbidden},
+		{"read other", "GET", "/users/2", nil, http.StatusForbidden},
+		{"update other", "PUT", "/users/2", update, http.StatusForbidden},
+		{"delete other", "DELETE", "/users/2", nil, http.StatusForbidden},
+		{"read nonexistent", "GET", "/users/99", nil, http.StatusForbidden},
+		{"read self", "GET", "/users/1", nil, http.StatusOK},
+		{"update self", "PUT", "/users/1", update, http.StatusOK},
+		{"delete self", "DELETE", "/users/1", nil, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(test.method, test.path, bytes.NewBuffer(test.body))
+			authorizeAs(req, alice)
+			// Errors come in the legacy envelope for clients asking for JSON
+			req.Header.Set("Accept", "application/json")
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			assert.Equal(t, test.status, recorder.Code)
+
+			if test.status == http.StatusForbidden {
+				var response Response
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				assert.False(t, response.Success)
+				assert.Equal(t, "Permission denied", response.Message)
+			}
+		})
+	}
+}
+
+// Test that created users get the regular role and login tokens carry it
+func TestCreatedUsersAreRegularUsers(t *testing.T) {
+	_, router := setupTest(t)
+
+	jsonData, _ := json.Marshal(CreateUserRequest{Username: "dave", Email: "dave@example.com", Password: "password123"})
+	req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(jsonData))
+	authorize(req)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	recorder = postJSON(router, "/auth/login", LoginRequest{Username: "dave", Password: "password123"})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var login tokenResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &login))
+
+	id, err := testTokens.Verify(login.Data.AccessToken, auth.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, authz.RoleUser, id.Role)
+}
+
+// Test that a users:write key cannot take over the seeded admin account
+func TestWriteKeyCannotChangeUsers(t *testing.T) {
+	users := store.NewMemoryStore()
+	require.NoError(t, users.Create(context.Background(), &User{Username: "admin", Email: "admin@example.com", Password: "x", Role: authz.RoleAdmin}))
+	s := newServer(users, testPasswords(), testTokens)
+	require.NoError(t, configureStaticAPIKey(s, &conff.Config{APIKey: "writer-key", APIKeyScopes: []string{authz.ScopeUsersRead, authz.ScopeUsersWrite}}))
+	router := s.routes()
+
+	update, _ := json.Marshal(UpdateUserRequest{Username: "admin", Email: "admin@example.com", Password: "takenover123"})
+	create, _ := json.Marshal(CreateUserRequest{Username: "carol", Email: "carol@example.com", Password: "password123"})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   []byte
+		status int
+	}{
+		{"update admin", "PUT", "/users/1", update, http.StatusForbidden},
+		{"patch admin", "PATCH", "/users/1", []byte(`{"password": "takenover123"}`), http.StatusForbidden},
+		{"delete admin", "DELETE", "/users/1", nil, http.StatusForbidden},
+		{"create user", "POST", "/users", create, http.StatusCreated},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(test.method, test.path, bytes.NewBuffer(test.body))
+			req.Header.Set("X-API-Key", "writer-key")
+			if test.method == "PATCH" {
+				req.Header.Set("Content-Type", "application/merge-patch+json")
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			assert.Equal(t, test.status, recorder.Code)
+		})
+	}
+
+	admin, err := users.Get(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, authz.RoleAdmin, admin.Role)
+}
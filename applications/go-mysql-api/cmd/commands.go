@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// command is a subcommand of the binary
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, out, errOut io.Writer) int
+}
+
+// commands lists the subcommands; serve runs when none is given
+var commands = []command{
+	{"serve", "run the API server (default)", runServe},
+	{"migrate", "apply, roll back or list schema migrations", runMigrate},
+	{"config", "print the effective configuration", runConfig},
+	{"health-check", "probe the readiness endpoint of the local server", runHealthCheck},
+}
+
+// run dispatches args to a subcommand and returns the exit status. Without
+// a subcommand, args are the server flags. -health-check is accepted for
+// the container HEALTHCHECK.
+func run(args []string, out, errOut io.Writer) int {
+	name := "serve"
+	if len(args) > 0 {
+		switch arg := args[0]; {
+		case arg == "-health-check" || arg == "--health-check":
+			name, args = "health-check", args[1:]
+		case arg == "help" || arg == "-h" || arg == "-help" || arg == "--help":
+			printUsage(out)
+			return 0
+		case !strings.HasPrefix(arg, "-"):
+			name, args = arg, args[1:]
+		}
+	}
+
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(args, out, errOut)
+		}
+	}
+	fmt.Fprintf(errOut, "unknown command %q\n", name)
+	printUsage(errOut)
+	return 2
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: main [command] [flags]")
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"goapp_CI/conff"
+)
+
+const configUsage = "usage: main config print [flags]"
+
+// runConfig implements the config subcommand. "config print" shows the
+// effective configuration with secrets redacted, followed by any validation
+// errors, and accepts the same flags as the server.
+func runConfig(args []string, out, errOut io.Writer) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(errOut, configUsage)
+		return 2
+	}
+
+	cfg, err := conff.Load(args[1:])
+	if cfg != nil {
+		if perr := cfg.Print(out); perr != nil {
+			fmt.Fprintf(errOut, "config: %v\n", perr)
+			return 1
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the config print subcommand
+func TestRunConfigPrint(t *testing.T) {
+	var out, errOut bytes.Buffer
+	code := runConfig([]string{"print", "-db-host", "db.example.com"}, &out, &errOut)
+	assert.Equal(t, 0, code, errOut.String())
+	assert.Regexp(t, `DB_HOST\s+db.example.com\s+flag`, out.String())
+	assert.Regexp(t, `JWT_SECRET\s+\[REDACTED\]`, out.String())
+	assert.NotContains(t, out.String(), "test-secret")
+
+	out.Reset()
+	errOut.Reset()
+	code = runConfig([]string{"print", "-db-port", "0"}, &out, &errOut)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, out.String(), "DB_PORT")
+	assert.Contains(t, errOut.String(), "DB_PORT: must be a port number")
+
+	assert.Equal(t, 2, runConfig(nil, &out, &errOut))
+}
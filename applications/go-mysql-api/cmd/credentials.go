@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"goapp_CI/conff"
+	"goapp_CI/logging"
+	"goapp_CI/password"
+	"goapp_CI/store"
+)
+
+// errInvalidCredentials is returned for an unknown user or a wrong password
+var errInvalidCredentials = errors.New("invalid username or password")
+
+// newPasswordManager builds the password hasher selected in cfg. The other
+// algorithm stays registered so existing hashes keep verifying and get
+// migrated on the next successful login.
+func newPasswordManager(cfg *conff.Config) (*password.Manager, error) {
+	argon := &password.Argon2id{
+		Memory:  uint32(cfg.PasswordArgon2Memory),
+		Time:    uint32(cfg.PasswordArgon2Time),
+		Threads: uint8(cfg.PasswordArgon2Threads),
+		SaltLen: 16,
+		KeyLen:  32,
+	}
+	bcrypt := &password.Bcrypt{Cost: cfg.PasswordBcryptCost}
+
+	switch cfg.PasswordHasher {
+	case "argon2id":
+		return password.NewManager(argon, bcrypt), nil
+	case "bcrypt":
+		return password.NewManager(bcrypt, argon), nil
+	default:
+		return nil, fmt.Errorf("unknown password hasher %q", cfg.PasswordHasher)
+	}
+}
+
+// authenticate verifies username and plain against the stored hash. When the
+// stored hash is plaintext or uses outdated parameters it is replaced with a
+// fresh hash; a failure to do so does not fail the login.
+func (s *server) authenticate(ctx context.Context, username, plain string) (*User, error) {
+	user, err := s.users.GetByUsername(ctx, username)
+	if errors.Is(err, store.ErrNotFound) {
+		// Spend the same effort as for a known user to avoid leaking which usernames exist.
+		s.passwords.Hash(plain)
+		return nil, errInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	match, rehash, err := s.passwords.Verify(plain, user.Password)
+	if err != nil {
+		return nil, err
+	}
+	if !match {
+		return nil, errInvalidCredentials
+	}
+
+	if rehash {
+		if hash, err := s.passwords.Hash(plain); err != nil {
+			logging.FromContext(ctx).Warn("rehashing password", "user_id", user.ID, "error", err)
+		} else if err := s.users.SetPassword(ctx, user.ID, hash); err != nil {
+			logging.FromContext(ctx).Warn("storing rehashed password", "user_id", user.ID, "error", err)
+		}
+	}
+
+	user.Password = ""
+	return user, nil
+}
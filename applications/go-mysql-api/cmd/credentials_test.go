@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goapp_CI/conff"
+	"goapp_CI/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that a legacy plaintext row is migrated on successful login
+func TestAuthenticateMigratesPlaintext(t *testing.T) {
+	ctx := context.Background()
+	users := store.NewMemoryStore()
+	srv := newServer(users, testPasswords(), testTokens)
+
+	require.NoError(t, users.Create(ctx, &User{Username: "admin", Email: "admin@example.com", Password: "admin123"}))
+
+	_, err := srv.authenticate(ctx, "admin", "wrong")
+	assert.ErrorIs(t, err, errInvalidCredentials)
+	stored, _ := users.GetByUsername(ctx, "admin")
+	assert.Equal(t, "admin123", stored.Password)
+
+	user, err := srv.authenticate(ctx, "admin", "admin123")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", user.Username)
+	assert.Empty(t, user.Password)
+
+	stored, _ = users.GetByUsername(ctx, "admin")
+	assert.True(t, strings.HasPrefix(stored.Password, "$argon2id$"))
+
+	_, err = srv.authenticate(ctx, "admin", "admin123")
+	assert.NoError(t, err)
+}
+
+// Test that unknown users are rejected like wrong passwords
+func TestAuthenticateUnknownUser(t *testing.T) {
+	srv := newServer(store.NewMemoryStore(), testPasswords(), testTokens)
+
+	_, err := srv.authenticate(context.Background(), "ghost", "whatever")
+	assert.ErrorIs(t, err, errInvalidCredentials)
+}
+
+// Test that created users never have their password stored in plaintext
+func TestCreateUserHashesPassword(t *testing.T) {
+	ctx := context.Background()
+	users := store.NewMemoryStore()
+	srv := newServer(users, testPasswords(), testTokens)
+	router := srv.routes()
+
+	jsonData, _ := json.Marshal(CreateUserRequest{Username: "hashme", Email: "hash@example.com", Password: "password123"})
+	req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(jsonData))
+	authorize(req)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	stored, err := users.GetByUsername(ctx, "hashme")
+	require.NoError(t, err)
+	assert.NotEqual(t, "password123", stored.Password)
+	assert.True(t, strings.HasPrefix(stored.Password, "$argon2id$"))
+}
+
+// Test hasher selection from configuration
+func TestNewPasswordManager(t *testing.T) {
+	cfg := &conff.Config{PasswordHasher: "bcrypt", PasswordBcryptCost: 4, PasswordArgon2Memory: 1024, PasswordArgon2Time: 1, PasswordArgon2Threads: 1}
+	m, err := newPasswordManager(cfg)
+	require.NoError(t, err)
+	hash, err := m.Hash("x")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$2a$04$"))
+
+	cfg.PasswordHasher = "md5"
+	_, err = newPasswordManager(cfg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"goapp_CI/conff"
+	"goapp_CI/dbpool"
+	"goapp_CI/tlsconfig"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// vaultDBCredentials issues MySQL users from Vault's database secrets engine
+type vaultDBCredentials struct {
+	vault *conff.Vault
+	mount string
+	role  string
+}
+
+func (c vaultDBCredentials) Issue(ctx context.Context) (*dbpool.Lease, error) {
+	l, err := c.vault.DatabaseCredentials(ctx, c.mount, c.role)
+	if err != nil {
+		return nil, err
+	}
+	if l.Data["username"] == "" || l.Data["password"] == "" {
+		return nil, fmt.Errorf("lease %s has no username or password", l.ID)
+	}
+	return &dbpool.Lease{
+		ID:        l.ID,
+		User:      l.Data["username"],
+		Password:  l.Data["password"],
+		TTL:       l.Duration,
+		Renewable: l.Renewable,
+	}, nil
+}
+
+func (c vaultDBCredentials) Renew(ctx context.Context, l *dbpool.Lease) (time.Duration, error) {
+	return c.vault.RenewLease(ctx, l.ID, l.TTL)
+}
+
+func (c vaultDBCredentials) Revoke(ctx context.Context, l *dbpool.Lease) error {
+	return c.vault.RevokeLease(ctx, l.ID)
+}
+
+// openDB opens a pool to the database in cfg logging in as user and checks
+// that it is reachable
+func openDB(ctx context.Context, cfg *conff.Config, user, password string) (*sql.DB, error) {
+	config, err := mysqlConfig(cfg, user, password)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := mysql.NewConnector(config)
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	sqlDB := sql.OpenDB(connector)
+	sqlDB.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("connecting to MySQL database: %w", err)
+	}
+	slog.Info("opened MySQL connection pool", dbSettingsAttrs(cfg, config)...)
+	return sqlDB, nil
+}
+
+// mysqlConfig returns the driver settings of cfg for user
+func mysqlConfig(cfg *conff.Config, user, password string) (*mysql.Config, error) {
+	config := mysql.NewConfig()
+	config.User = user
+	config.Passwd = password
+	config.Net = "tcp"
+	config.Addr = net.JoinHostPort(cfg.DBHost, cfg.DBPort)
+	config.DBName = cfg.DBName
+	config.ParseTime = cfg.DBParseTime
+	config.Collation = cfg.DBCollation
+	config.Timeout = cfg.DBDialTimeout
+	config.ReadTimeout = cfg.DBReadTimeout
+	config.WriteTimeout = cfg.DBWriteTimeout
+
+	loc, err := time.LoadLocation(cfg.DBLocation)
+	if err != nil {
+		return nil, fmt.Errorf("loading DB_LOCATION: %w", err)
+	}
+	config.Loc = loc
+
+	if config.Params, err = cfg.DBParamMap(); err != nil {
+		return nil, fmt.Errorf("parsing DB_PARAMS: %w", err)
+	}
+
+	serverName := cfg.DBTLSServerName
+	if serverName == "" {
+		serverName = cfg.DBHost
+	}
+	config.TLS, err = tlsconfig.Client(tlsconfig.ClientOptions{
+		Mode:       cfg.DBTLSMode,
+		CAFile:     cfg.DBTLSCAFile,
+		ServerName: serverName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("configuring database TLS: %w", err)
+	}
+	config.AllowFallbackToPlaintext = cfg.DBTLSMode == "preferred"
+	return config, nil
+}
+
+// dbSettingsAttrs describes the effective connection settings for the log.
+// The DSN is logged as "connection" with the password redacted, since
+// logging.Redact blanks keys naming a DSN; the TLS settings are not part of
+// it because the driver only names registered configurations.
+func dbSettingsAttrs(cfg *conff.Config, config *mysql.Config) []any {
+	redacted := config.Clone()
+	if redacted.Passwd != "" {
+		redacted.Passwd = conff.Redacted
+	}
+	redacted.TLS = nil
+	var serverName string
+	if config.TLS != nil {
+		serverName = config.TLS.ServerName
+	}
+	return []any{
+		"connection", redacted.FormatDSN(),
+		"tls_mode", cfg.DBTLSMode,
+		"tls_ca_file", cfg.DBTLSCAFile,
+		"tls_server_name", serverName,
+		"max_open_conns", cfg.DBMaxOpenConns,
+		"max_idle_conns", cfg.DBMaxIdleConns,
+		"conn_max_lifetime", cfg.DBConnMaxLifetime,
+		"conn_max_idle_time", cfg.DBConnMaxIdleTime,
+	}
+}
+
+// openDynamicDB connects with credentials leased from Vault and starts
+// rotating them in the background
+func openDynamicDB(ctx context.Context, cfg *conff.Config) (*dbpool.Pool, error) {
+	creds := vaultDBCredentials{vault: cfg.Vault(), mount: cfg.DBVaultMount, role: cfg.DBVaultRole}
+	open := func(ctx context.Context, l *dbpool.Lease) (*sql.DB, error) {
+		return openDB(ctx, cfg, l.User, l.Password)
+	}
+
+	lease, err := creds.Issue(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("issuing database credentials: %w", err)
+	}
+	sqlDB, err := open(ctx, lease)
+	if err != nil {
+		if err := creds.Revoke(ctx, lease); err != nil {
+			slog.Warn("revoking database lease", "lease_id", lease.ID, "error", err)
+		}
+		return nil, err
+	}
+
+	pool := dbpool.New(sqlDB)
+	pool.DrainTimeout = cfg.DBDrainTimeout
+	go dbpool.NewRotator(pool, creds, lease, open).Run(ctx)
+	return pool, nil
+}
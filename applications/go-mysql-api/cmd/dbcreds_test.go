@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"goapp_CI/conff"
+	"goapp_CI/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the driver settings built from the configuration
+func TestMySQLConfig(t *testing.T) {
+	cfg, err := conff.LoadConfig()
+	require.NoError(t, err)
+
+	config, err := mysqlConfig(cfg, "api", "s3cret")
+	require.NoError(t, err)
+	assert.True(t, config.ParseTime)
+	assert.True(t, config.AllowNativePasswords)
+	assert.Equal(t, "utf8mb4_unicode_ci", config.Collation)
+	assert.Equal(t, 5*time.Second, config.Timeout)
+	assert.Equal(t, time.UTC, config.Loc)
+	require.NotNil(t, config.TLS)
+	assert.True(t, config.AllowFallbackToPlaintext)
+
+	attrs := dbSettingsAttrs(cfg, config)
+	assert.Equal(t, "connection", attrs[0])
+	assert.Contains(t, attrs[1], "api:[REDACTED]@tcp(localhost:3306)/")
+	assert.Contains(t, attrs[1], "parseTime=true")
+	assert.NotContains(t, attrs[1], "s3cret")
+}
+
+// Test TLS verification against a CA bundle, e.g. the RDS one
+func TestMySQLConfigVerifiesIdentity(t *testing.T) {
+	t.Setenv("DB_HOST", "users.abc123.eu-west-1.rds.amazonaws.com")
+	t.Setenv("DB_TLS_MODE", "verify-identity")
+	t.Setenv("DB_PARAMS", "sql_mode='STRICT_TRANS_TABLES,NO_ZERO_DATE'&time_zone='+00:00'")
+	cfg, err := conff.LoadConfig()
+	require.NoError(t, err)
+
+	config, err := mysqlConfig(cfg, "api", "s3cret")
+	require.NoError(t, err)
+	require.NotNil(t, config.TLS)
+	assert.False(t, config.TLS.InsecureSkipVerify)
+	assert.Equal(t, "users.abc123.eu-west-1.rds.amazonaws.com", config.TLS.ServerName)
+	assert.False(t, config.AllowFallbackToPlaintext)
+	assert.Equal(t, map[string]string{"sql_mode": "'STRICT_TRANS_TABLES,NO_ZERO_DATE'", "time_zone": "'+00:00'"}, config.Params)
+
+	cfg.DBTLSServerName = "users.example.internal"
+	config, err = mysqlConfig(cfg, "api", "s3cret")
+	require.NoError(t, err)
+	assert.Equal(t, "users.example.internal", config.TLS.ServerName)
+
+	cfg.DBTLSCAFile = "/nonexistent/global-bundle.pem"
+	_, err = mysqlConfig(cfg, "api", "s3cret")
+	assert.ErrorContains(t, err, "database TLS")
+
+	cfg.DBTLSMode = "disabled"
+	cfg.DBTLSCAFile = ""
+	config, err = mysqlConfig(cfg, "api", "")
+	require.NoError(t, err)
+	assert.Nil(t, config.TLS)
+	assert.Contains(t, dbSettingsAttrs(cfg, config)[1], "api@tcp(")
+}
+
+// Test that the connection settings survive the redacting logger
+func TestDBSettingsLogLine(t *testing.T) {
+	t.Setenv("DB_PARAMS", "sql_mode=TRADITIONAL")
+	cfg, err := conff.LoadConfig()
+	require.NoError(t, err)
+	config, err := mysqlConfig(cfg, "api", "s3cret")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "json", new(slog.LevelVar))
+	require.NoError(t, err)
+	logger.Info("opened MySQL connection pool", dbSettingsAttrs(cfg, config)...)
+	assert.NotContains(t, buf.String(), "s3cret")
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	connection, _ := line["connection"].(string)
+	assert.Contains(t, connection, "api:[REDACTED]@tcp(localhost:3306)/")
+	assert.Contains(t, connection, "timeout=5s")
+	assert.Contains(t, connection, "collation=utf8mb4_unicode_ci")
+	assert.Contains(t, connection, "sql_mode=TRADITIONAL")
+	assert.Equal(t, "preferred", line["tls_mode"])
+}
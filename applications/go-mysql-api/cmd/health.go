@@ -0,0 +1,33 @@
+package main
+
+import (
+	"goapp_CI/conff"
+	"goapp_CI/dbpool"
+	"goapp_CI/health"
+	"goapp_CI/migrate"
+
+	"github.com/gorilla/mux"
+)
+
+// newHealth registers the readiness checks for db. Liveness has no
+// dependency checks: restarting the pod does not fix a database outage.
+func newHealth(cfg *conff.Config, db *dbpool.Pool, migrator *migrate.Migrator) (*health.Health, error) {
+	internal, err := health.ParseCIDRs(cfg.HealthInternalCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	h := health.New(cfg.HealthCheckTimeout, internal)
+	h.AddReadiness("mysql", health.Ping(db))
+	h.AddReadiness("mysql_pool", health.PoolSaturation(db.Stats, cfg.HealthPoolSaturation))
+	h.AddReadiness("migrations", health.Migrations(migrator.Pending))
+	return h, nil
+}
+
+// registerHealthRoutes exposes the probes. /health is kept as an alias of
+// /readyz for the Helm chart tests and older probe configurations.
+func registerHealthRoutes(r *mux.Router, h *health.Health) {
+	r.Handle("/livez", h.LivenessHandler()).Methods("GET", "HEAD")
+	r.Handle("/readyz", h.ReadinessHandler()).Methods("GET", "HEAD")
+	r.Handle("/health", h.ReadinessHandler()).Methods("GET", "HEAD")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"goapp_CI/health"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the probe paths used by the Helm chart are routed
+func TestHealthRoutes(t *testing.T) {
+	_, router := setupTest(t)
+
+	h := health.New(time.Second, nil)
+	dbUp := true
+	h.AddReadiness("mysql", health.CheckerFunc(func(ctx context.Context) error {
+		if !dbUp {
+			return errors.New("down")
+		}
+		return nil
+	}))
+	registerHealthRoutes(router, h)
+
+	for _, path := range []string{"/livez", "/readyz", "/health"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusOK, recorder.Code, path)
+	}
+
+	dbUp = false
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/livez", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"goapp_CI/conff"
+)
+
+// runHealthCheck implements the health-check subcommand, used as the
+// container HEALTHCHECK where the scratch image has no curl. It exits 0 when
+// the readiness endpoint of the server on localhost answers 200.
+//
+// The port is taken from -port, APP_PORT, SERVER_PORT or the config file in
+// APP_CONFIG_FILE, and HTTPS is used when TLS_CERT_FILE is set in either.
+// Only the environment and that file are read, so that probes never reach
+// Vault or AWS. When the server requires client certificates, pass one with
+// -client-cert and -client-key.
+func runHealthCheck(args []string, out, errOut io.Writer) int {
+	fs := flag.NewFlagSet("health-check", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	port := fs.String("port", setting("APP_PORT", "8080"), "port of the local server")
+	path := fs.String("path", "/readyz", "endpoint to probe")
+	timeout := fs.Duration("timeout", 2*time.Second, "how long to wait for the answer")
+	useTLS := fs.Bool("tls", setting("TLS_CERT_FILE", "") != "", "probe over HTTPS")
+	clientCert := fs.String("client-cert", "", "client certificate for mTLS")
+	clientKey := fs.String("client-key", "", "key of the client certificate")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	scheme := "http"
+	client := http.DefaultClient
+	if *useTLS {
+		// The server certificate names the service, not 127.0.0.1
+		tlsConfig := &tls.Config{InsecureSkipVerify: true}
+		if *clientCert != "" {
+			pair, err := tls.LoadX509KeyPair(*clientCert, *clientKey)
+			if err != nil {
+				fmt.Fprintf(errOut, "health-check: %v\n", err)
+				return 2
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+		scheme = "https"
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	}
+
+	url := scheme + "://127.0.0.1:" + *port + *path
+	if err := healthCheck(context.Background(), client, url, *timeout); err != nil {
+		fmt.Fprintf(errOut, "unhealthy: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(out, "healthy")
+	return 0
+}
+
+// healthCheck probes url with client, expecting 200 within timeout
+func healthCheck(ctx context.Context, client *http.Client, url string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return nil
+}
+
+// setting returns the raw value of the setting name from the environment or
+// the config file, or def. An unreadable config file is ignored, leaving
+// the probe to fail against def.
+func setting(name, def string) string {
+	if value, ok, err := conff.RawValue(name); err == nil && ok {
+		return value
+	}
+	return def
+}
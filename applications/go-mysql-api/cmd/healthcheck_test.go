@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// probeServer serves status on /readyz and returns its port
+func probeServer(t *testing.T, status int, delay time.Duration) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readyz" {
+			http.NotFound(w, r)
+			return
+		}
+		time.Sleep(delay)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	return u.Port()
+}
+
+func TestHealthCheck(t *testing.T) {
+	var out, errOut bytes.Buffer
+
+	port := probeServer(t, http.StatusOK, 0)
+	assert.Equal(t, 0, run([]string{"-health-check", "-port", port}, &out, &errOut), errOut.String())
+	assert.Equal(t, "healthy\n", out.String())
+
+	t.Setenv("APP_PORT", port)
+	assert.Equal(t, 0, run([]string{"health-check"}, &out, &errOut), errOut.String())
+
+	errOut.Reset()
+	port = probeServer(t, http.StatusServiceUnavailable, 0)
+	assert.Equal(t, 1, run([]string{"-health-check", "-port", port}, &out, &errOut))
+	assert.Contains(t, errOut.String(), "503 Service Unavailable")
+
+	errOut.Reset()
+	port = probeServer(t, http.StatusOK, 200*time.Millisecond)
+	assert.Equal(t, 1, run([]string{"-health-check", "-port", port, "-timeout", "20ms"}, &out, &errOut))
+	assert.Contains(t, errOut.String(), "deadline exceeded")
+}
+
+// Test that the port set only in app.conf, as the chart does, is probed
+func TestHealthCheckPortFromConfigFile(t *testing.T) {
+	port := probeServer(t, http.StatusOK, 0)
+	path := filepath.Join(t.TempDir(), "app.conf")
+	require.NoError(t, os.WriteFile(path, []byte("[app]\nport = "+port+"\n\n[database]\npassword = vault://secret/data/db#password\n"), 0o600))
+	t.Setenv("APP_CONFIG_FILE", path)
+	t.Setenv("APP_PORT", "")
+	t.Setenv("SERVER_PORT", "")
+
+	var out, errOut bytes.Buffer
+	assert.Equal(t, 0, run([]string{"health-check"}, &out, &errOut), errOut.String())
+
+	// The environment still takes precedence over the file
+	t.Setenv("APP_PORT", "1")
+	assert.Equal(t, 1, run([]string{"health-check"}, &out, &errOut))
+}
+
+func TestHealthCheckTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	var out, errOut bytes.Buffer
+	assert.Equal(t, 1, run([]string{"-health-check", "-port", u.Port()}, &out, &errOut))
+
+	t.Setenv("TLS_CERT_FILE", "/etc/tls/tls.crt")
+	errOut.Reset()
+	assert.Equal(t, 0, run([]string{"-health-check", "-port", u.Port()}, &out, &errOut), errOut.String())
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	var out, errOut bytes.Buffer
+	assert.Equal(t, 2, run([]string{"frobnicate"}, &out, &errOut))
+	assert.Contains(t, errOut.String(), `unknown command "frobnicate"`)
+	assert.Contains(t, errOut.String(), "health-check")
+
+	assert.Equal(t, 0, run([]string{"help"}, &out, &errOut))
+	assert.Contains(t, out.String(), "serve")
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+
+	"goapp_CI/conff"
+	"goapp_CI/httpsec"
+)
+
+// secure wraps h with the CORS handling and security headers configured in
+// cfg. They wrap the whole router so that preflight requests, which match
+// no route, and 404 responses are covered.
+func secure(h http.Handler, cfg *conff.Config) http.Handler {
+	h = httpsec.Headers(httpsec.HeaderPolicy{
+		HSTSMaxAge:            cfg.SecurityHSTSMaxAge,
+		HSTSIncludeSubdomains: cfg.SecurityHSTSSubdomains,
+		ContentSecurityPolicy: cfg.SecurityCSP,
+		ReferrerPolicy:        cfg.SecurityReferrerPolicy,
+		FrameOptions:          cfg.SecurityFrameOptions,
+		NoStorePaths:          cfg.SecurityNoStorePaths,
+	})(h)
+	return httpsec.CORS(httpsec.CORSOptions{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowedMethods:   cfg.CORSAllowedMethods,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		ExposedHeaders:   cfg.CORSExposedHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+	})(h)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"goapp_CI/conff"
+	"goapp_CI/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the security headers and CORS around the API routes
+func TestSecureRouter(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://admin.example.com")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	cfg, err := conff.LoadConfig()
+	require.NoError(t, err)
+
+	h := secure(newServer(store.NewMemoryStore(), testPasswords(), testTokens).routes(), cfg)
+
+	// Unmatched routes get the headers too
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/nonexistent", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+	assert.NotEmpty(t, rec.Header().Get("X-XSS-Protection"))
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	authorize(req)
+	req.Header.Set("Origin", "https://admin.example.com")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.Equal(t, "https://admin.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+
+	// Preflights are answered before routing, which only knows GET and POST on /users
+	req = httptest.NewRequest("OPTIONS", "/users/1", nil)
+	req.Header.Set("Origin", "https://admin.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PATCH")
+	req.Header.Set("Access-Control-Request-Headers", "Authorization, Content-Type, If-Match")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Contains(t, rec.Header().Get("Access-Control-Allow-Methods"), "PATCH")
+}
+
+// Test that wildcard origins cannot be combined with credentials
+func TestCORSConfigValidation(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	_, err := conff.LoadConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "CORS_ALLOWED_ORIGINS")
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://admin.example.com/app")
+	_, err = conff.LoadConfig()
+	assert.Error(t, err)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,8 @@ import (
 	"testing"
 
 	"goapp_CI/conff"
+	"goapp_CI/migrate"
+	"goapp_CI/store"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
@@ -39,12 +42,7 @@ func (suite *IntegrationTestSuite) SetupSuite() {
 	suite.initTestDB()
 
 	// Set up router
-	suite.router = mux.NewRouter()
-	suite.router.HandleFunc("/users", createUser).Methods("POST")
-	suite.router.HandleFunc("/users", getUsers).Methods("GET")
-	suite.router.HandleFunc("/users/{id}", getUser).Methods("GET")
-	suite.router.HandleFunc("/users/{id}", updateUser).Methods("PUT")
-	suite.router.HandleFunc("/users/{id}", deleteUser).Methods("DELETE")
+	suite.router = newServer(store.NewMySQLStore(suite.db), testPasswords(), testTokens).routes()
 }
 
 // TearDownSuite runs once after all tests
@@ -90,17 +88,10 @@ func (suite *IntegrationTestSuite) initTestDB() {
 }
 
 func (suite *IntegrationTestSuite) createTestTable() {
-	query := `
-	CREATE TABLE IF NOT EXISTS users (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		username VARCHAR(50) UNIQUE NOT NULL,
-		email VARCHAR(100) UNIQUE NOT NULL,
-		password VARCHAR(255) NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
-	)`
-
-	_, err := suite.db.Exec(query)
+	m, err := migrate.New(suite.db)
+	require.NoError(suite.T(), err)
+
+	_, err = m.Up(context.Background())
 	require.NoError(suite.T(), err)
 }
 
@@ -131,6 +122,7 @@ func (suite *IntegrationTestSuite) TestUserLifecycle() {
 
 	jsonData, _ := json.Marshal(userData)
 	req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(jsonData))
+	authorize(req)
 	req.Header.Set("Content-Type", "application/json")
 
 	recorder := httptest.NewRecorder()
@@ -149,6 +141,7 @@ func (suite *IntegrationTestSuite) TestUserLifecycle() {
 
 	// 2. Get user by ID
 	req, _ = http.NewRequest("GET", fmt.Sprintf("/users/%d", userID), nil)
+	authorize(req)
 	recorder = httptest.NewRecorder()
 	suite.router.ServeHTTP(recorder, req)
 
@@ -168,6 +161,7 @@ func (suite *IntegrationTestSuite) TestUserLifecycle() {
 
 	jsonData, _ = json.Marshal(updateData)
 	req, _ = http.NewRequest("PUT", fmt.Sprintf("/users/%d", userID), bytes.NewBuffer(jsonData))
+	authorize(req)
 	req.Header.Set("Content-Type", "application/json")
 
 	recorder = httptest.NewRecorder()
@@ -182,6 +176,7 @@ func (suite *IntegrationTestSuite) TestUserLifecycle() {
 
 	// 4. Verify update
 	req, _ = http.NewRequest("GET", fmt.Sprintf("/users/%d", userID), nil)
+	authorize(req)
 	recorder = httptest.NewRecorder()
 	suite.router.ServeHTTP(recorder, req)
 
@@ -194,6 +189,7 @@ func (suite *IntegrationTestSuite) TestUserLifecycle() {
 
 	// 5. Delete user
 	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/users/%d", userID), nil)
+	authorize(req)
 	recorder = httptest.NewRecorder()
 	suite.router.ServeHTTP(recorder, req)
 
@@ -206,6 +202,7 @@ func (suite *IntegrationTestSuite) TestUserLifecycle() {
 
 	// 6. Verify deletion
 	req, _ = http.NewRequest("GET", fmt.Sprintf("/users/%d", userID), nil)
+	authorize(req)
 	recorder = httptest.NewRecorder()
 	suite.router.ServeHTTP(recorder, req)
 
@@ -216,9 +213,9 @@ func (suite *IntegrationTestSuite) TestUserLifecycle() {
 func (suite *IntegrationTestSuite) TestMultipleUsers() {
 	// Create multiple users
 	users := []CreateUserRequest{
-		{Username: "user1", Email: "user1@example.com", Password: "pass1"},
-		{Username: "user2", Email: "user2@example.com", Password: "pass2"},
-		{Username: "user3", Email: "user3@example.com", Password: "pass3"},
+		{Username: "user1", Email: "user1@example.com", Password: "password1"},
+		{Username: "user2", Email: "user2@example.com", Password: "password2"},
+		{Username: "user3", Email: "user3@example.com", Password: "password3"},
 	}
 
 	userIDs := make([]int, len(users))
@@ -226,6 +223,7 @@ func (suite *IntegrationTestSuite) TestMultipleUsers() {
 	for i, userData := range users {
 		jsonData, _ := json.Marshal(userData)
 		req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(jsonData))
+		authorize(req)
 		req.Header.Set("Content-Type", "application/json")
 
 		recorder := httptest.NewRecorder()
@@ -243,6 +241,7 @@ func (suite *IntegrationTestSuite) TestMultipleUsers() {
 
 	// Get all users
 	req, _ := http.NewRequest("GET", "/users", nil)
+	authorize(req)
 	recorder := httptest.NewRecorder()
 	suite.router.ServeHTTP(recorder, req)
 
@@ -269,6 +268,7 @@ func (suite *IntegrationTestSuite) TestDuplicateConstraints() {
 
 	jsonData, _ := json.Marshal(userData)
 	req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(jsonData))
+	authorize(req)
 	req.Header.Set("Content-Type", "application/json")
 
 	recorder := httptest.NewRecorder()
@@ -285,6 +285,7 @@ func (suite *IntegrationTestSuite) TestDuplicateConstraints() {
 
 	jsonData, _ = json.Marshal(duplicateUser)
 	req, _ = http.NewRequest("POST", "/users", bytes.NewBuffer(jsonData))
+	authorize(req)
 	req.Header.Set("Content-Type", "application/json")
 
 	recorder = httptest.NewRecorder()
@@ -309,6 +310,7 @@ func (suite *IntegrationTestSuite) TestConcurrentUserCreation() {
 
 			jsonData, _ := json.Marshal(userData)
 			req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(jsonData))
+			authorize(req)
 			req.Header.Set("Content-Type", "application/json")
 
 			recorder := httptest.NewRecorder()
@@ -327,6 +329,7 @@ func (suite *IntegrationTestSuite) TestConcurrentUserCreation() {
 
 	// Verify all users were created
 	req, _ := http.NewRequest("GET", "/users", nil)
+	authorize(req)
 	recorder := httptest.NewRecorder()
 	suite.router.ServeHTTP(recorder, req)
 
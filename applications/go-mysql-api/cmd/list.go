@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"goapp_CI/store"
+)
+
+// Page sizes for list endpoints
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// parseListOptions reads the paging, sorting and filter parameters of
+// GET /users:
+//
+//	limit           page size, default 20, capped at 100
+//	cursor          next_cursor of the previous page
+//	sort            created_at, username, email or id; "-" prefix for descending
+//	username, email prefix filters
+//	created_after, created_before  RFC 3339 bounds on created_at (exclusive)
+func parseListOptions(q url.Values) (store.ListOptions, error) {
+	opts := store.ListOptions{
+		Limit:          defaultPageSize,
+		UsernamePrefix: q.Get("username"),
+		EmailPrefix:    q.Get("email"),
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return opts, errors.New("limit must be a positive integer")
+		}
+		opts.Limit = min(limit, maxPageSize)
+	}
+
+	sort, err := store.ParseSort(q.Get("sort"))
+	if err != nil {
+		return opts, fmt.Errorf("sort must be one of %v", store.SortFields)
+	}
+	opts.Sort = sort
+
+	if v := q.Get("cursor"); v != "" {
+		opts.After, err = store.DecodeCursor(v, sort)
+		if err != nil {
+			return opts, errors.New("cursor is invalid or was issued for another sort order")
+		}
+	}
+
+	for name, dst := range map[string]**time.Time{
+		"created_after":  &opts.CreatedAfter,
+		"created_before": &opts.CreatedBefore,
+	} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return opts, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*dst = &t
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"goapp_CI/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// usersPage mirrors Response with a user list as data
+type usersPage struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Data    []User `json:"data"`
+	Meta    *Meta  `json:"meta"`
+}
+
+// Test walking GET /users page by page with filters and sorting
+func TestGetUsersPagination(t *testing.T) {
+	users := store.NewMemoryStore()
+	router := newServer(users, testPasswords(), testTokens).routes()
+	for i := 1; i <= 5; i++ {
+		name := fmt.Sprintf("user%d", i)
+		require.NoError(t, users.Create(context.Background(), &User{Username: name, Email: name + "@example.com", Password: "x"}))
+	}
+
+	get := func(query url.Values) (int, usersPage) {
+		req, _ := http.NewRequest("GET", "/users?"+query.Encode(), nil)
+		authorize(req)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		var page usersPage
+		json.Unmarshal(recorder.Body.Bytes(), &page)
+		return recorder.Code, page
+	}
+
+	var seen []string
+	query := url.Values{"limit": {"2"}, "sort": {"username"}}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 5)
+		code, page := get(query)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 2, page.Meta.Limit)
+		for _, u := range page.Data {
+			seen = append(seen, u.Username)
+		}
+		if page.Meta.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", page.Meta.NextCursor)
+	}
+	assert.Equal(t, []string{"user1", "user2", "user3", "user4", "user5"}, seen)
+
+	code, page := get(url.Values{"email": {"user3@"}})
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, "user3", page.Data[0].Username)
+	assert.Empty(t, page.Meta.NextCursor)
+
+	code, page = get(url.Values{"limit": {"1000"}})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, maxPageSize, page.Meta.Limit)
+	assert.Equal(t, "user5", page.Data[0].Username)
+}
+
+// Test rejected list parameters
+func TestGetUsersInvalidParameters(t *testing.T) {
+	_, router := setupTest(t)
+
+	cursor := (&store.Cursor{Sort: "username", Value: "bob", ID: 2}).Encode()
+	for _, query := range []string{
+		"limit=0",
+		"limit=abc",
+		"sort=password",
+		"cursor=not-a-cursor",
+		"cursor=" + cursor,
+		"created_after=yesterday",
+	} {
+		t.Run(query, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/users?"+query, nil)
+			authorize(req)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+	}
+}
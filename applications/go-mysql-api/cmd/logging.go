@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"goapp_CI/auth"
+	"goapp_CI/conff"
+	"goapp_CI/logging"
+)
+
+// logLevel is the level of the default logger; it follows LOG_LEVEL on reload
+var logLevel = new(slog.LevelVar)
+
+// setupLogging makes the logger configured in cfg the default, which the
+// log package writes to as well
+func setupLogging(cfg *conff.Config) error {
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+	logLevel.Set(level)
+
+	logger, err := logging.New(os.Stderr, cfg.LogFormat, logLevel)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger.With(slog.String("env", cfg.AppEnv)))
+	return nil
+}
+
+// reloadLogLevel applies a changed LOG_LEVEL
+func reloadLogLevel(ctx context.Context, cfg *conff.Config, changed []string) (change, error) {
+	if !containsAny(changed, []string{"LOG_LEVEL"}) {
+		return change{}, nil
+	}
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return change{}, err
+	}
+	return change{apply: func() { logLevel.Set(level) }}, nil
+}
+
+// fatal logs msg with args at error level and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// logIdentity adds the authenticated caller to the log lines of the request
+func logIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := auth.FromContext(r.Context()); ok {
+			switch {
+			case id.APIKeyID != 0:
+				logging.AddAttrs(r.Context(), slog.Int("api_key_id", id.APIKeyID))
+			case id.ClientCert != "":
+				logging.AddAttrs(r.Context(), slog.String("client_cert", id.ClientCert))
+			default:
+				logging.AddAttrs(r.Context(), slog.Int("user_id", id.UserID))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goapp_CI/auth"
+	"goapp_CI/authz"
+	"goapp_CI/conff"
+	"goapp_CI/logging"
+	"goapp_CI/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLogCarriesIdentity(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "json", new(slog.LevelVar))
+	require.NoError(t, err)
+	r := newServer(store.NewMemoryStore(), testPasswords(), testTokens).routes()
+	r.Use(logging.Middleware(logger))
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	authorizeAs(req, auth.Identity{UserID: 42, Username: "alice", Role: authz.RoleUser})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get(logging.RequestIDHeader))
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(buf.String())), &line))
+	assert.Equal(t, "/users/{id}", line["route"])
+	assert.Equal(t, float64(42), line["user_id"])
+	assert.Equal(t, float64(http.StatusNotFound), line["status"])
+	assert.NotContains(t, buf.String(), "Bearer")
+}
+
+func TestReloadLogLevel(t *testing.T) {
+	defer logLevel.Set(logLevel.Level())
+
+	cfg := &conff.Config{LogLevel: "debug"}
+	c, err := reloadLogLevel(context.Background(), cfg, []string{"DB_PASSWORD"})
+	require.NoError(t, err)
+	assert.Nil(t, c.apply)
+
+	c, err = reloadLogLevel(context.Background(), cfg, []string{"LOG_LEVEL"})
+	require.NoError(t, err)
+	assert.NotEqual(t, slog.LevelDebug, logLevel.Level(), "preparing must not change the level")
+	c.apply()
+	assert.Equal(t, slog.LevelDebug, logLevel.Level())
+}
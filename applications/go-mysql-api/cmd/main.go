@@ -2,44 +2,41 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
-	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
-	"os/signal"
 	"strconv"
-	"time"
 
+	"goapp_CI/apierror"
+	"goapp_CI/auth"
+	"goapp_CI/authz"
 	"goapp_CI/conff"
+	"goapp_CI/dbpool"
+	"goapp_CI/lifecycle"
+	"goapp_CI/logging"
+	"goapp_CI/password"
+	"goapp_CI/ratelimit"
+	"goapp_CI/store"
+	"goapp_CI/tracing"
+	"goapp_CI/validate"
 
-	"github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
 )
 
-// User represents a user in the system
-type User struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  string    `json:"password,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-}
-
 // CreateUserRequest represents the request body for creating a user
 type CreateUserRequest struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required,username,max=50"`
+	Email    string `json:"email" validate:"required,email,max=100"`
+	Password string `json:"password" validate:"required,password"`
 }
 
 // UpdateUserRequest represents the request body for updating a user
 type UpdateUserRequest struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required,username,max=50"`
+	Email    string `json:"email" validate:"required,email,max=100"`
+	Password string `json:"password" validate:"required,password"`
 }
 
 // Response represents a generic API response
@@ -47,139 +44,256 @@ type Response struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 	Data    any    `json:"data,omitempty"`
+	Meta    *Meta  `json:"meta,omitempty"`
 }
 
-var db *sql.DB
+// Meta describes the page returned by list endpoints. NextCursor is empty
+// on the last page.
+type Meta struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
 
-func main() {
-	// Initialize database connection
-	initDB()
-	defer db.Close()
-	r := mux.NewRouter()
-	// Define routes
-	r.HandleFunc("/users", createUser).Methods("POST")
-	r.HandleFunc("/users", getUsers).Methods("GET")
-	r.HandleFunc("/users/{id}", getUser).Methods("GET")
-	r.HandleFunc("/users/{id}", updateUser).Methods("PUT")
-	r.HandleFunc("/users/{id}", deleteUser).Methods("DELETE")
-
-	// Start server
-	cfg, err := conff.LoadConfig()
-	if err != nil {
-		log.Fatalf("Error loading configuration, error: %v", err)
-	}
-	fmt.Printf("Server starting on port %s...\n", cfg.ServerPort)
+// User is the user model exposed by the API
+type User = store.User
+
+// server holds the dependencies shared by the HTTP handlers
+type server struct {
+	users     store.UserStore
+	keys      store.APIKeyStore
+	passwords *password.Manager
+	tokens    *auth.TokenService
+	apiKeys   *auth.APIKeyAuthenticator
+	// clientCerts authenticates clients by certificate in mTLS mode
+	clientCerts *auth.ClientCertAuthenticator
+	// limiter rate limits requests per client; nil disables it
+	limiter *ratelimit.Limiter
+	policy  authz.Policy
+	// validator checks request bodies, which may be maxBodyBytes long
+	validator    *validate.Validator
+	maxBodyBytes int64
+	// errorFormat is how errors are rendered unless the client asks
+	errorFormat apierror.Format
+}
 
-	var srv http.Server = http.Server{
-		Addr:    ":" + cfg.ServerPort,
-		Handler: r,
-	}
-
-	idleConnsClosed := make(chan struct{})
-	go func() {
-		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt)
-		<-sigint
-		// We received an interrupt signal, shut down.
-		if err := srv.Shutdown(context.Background()); err != nil {
-			// Error from closing listeners, or context timeout:
-			log.Printf("server shutdown: %v", err)
-		}
-		close(idleConnsClosed)
-	}()
-	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-		// Error starting or closing listener:
-		log.Fatalf("server ListenAndServe: %v", err)
+// newServer returns a server backed by the given store, password hasher and
+// token service, enforcing the default authorization policy
+func newServer(st store.Store, passwords *password.Manager, tokens *auth.TokenService) *server {
+	return &server{
+		users:     st,
+		keys:      st,
+		passwords: passwords,
+		tokens:    tokens,
+		apiKeys:   auth.NewAPIKeyAuthenticator(st),
+		policy:    authz.Default(),
+
+		validator:    validate.New(validate.DefaultPasswordPolicy),
+		maxBodyBytes: defaultMaxBodyBytes,
+		errorFormat:  apierror.FormatProblem,
 	}
+}
 
-	<-idleConnsClosed
-	log.Fatal(http.ListenAndServe(":"+cfg.ServerPort, r))
+// routes registers the API handlers on a new router
+func (s *server) routes() *mux.Router {
+	r := mux.NewRouter()
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.respondWithError(w, r, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "No such endpoint"))
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.respondWithError(w, r, apierror.New(http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "Method not allowed"))
+	})
+	r.Handle("/auth/login", s.limit(http.HandlerFunc(s.login))).Methods("POST")
+	r.Handle("/auth/refresh", s.limit(http.HandlerFunc(s.refresh))).Methods("POST")
+
+	// Requests are limited by client address before authentication, so
+	// guessing tokens or API keys is throttled too, and then per identity
+	users := r.PathPrefix("/users").Subrouter()
+	users.Use(s.limit, s.requireAuth, s.limit)
+	users.HandleFunc("", s.createUser).Methods("POST")
+	users.HandleFunc("", s.getUsers).Methods("GET")
+	users.HandleFunc("/{id}", s.getUser).Methods("GET")
+	users.HandleFunc("/{id}", s.updateUser).Methods("PUT")
+	users.HandleFunc("/{id}", s.patchUser).Methods("PATCH")
+	users.HandleFunc("/{id}", s.deleteUser).Methods("DELETE")
+
+	keys := r.PathPrefix("/admin/api-keys").Subrouter()
+	keys.Use(s.limit, s.requireAuth, s.limit)
+	keys.HandleFunc("", s.createAPIKey).Methods("POST")
+	keys.HandleFunc("", s.listAPIKeys).Methods("GET")
+	keys.HandleFunc("/{id}", s.revokeAPIKey).Methods("DELETE")
+	return r
 }
 
-func initDB() {
+var db *dbpool.Pool
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
 
-	cfg, err := conff.LoadConfig()
+// runServe implements the serve subcommand: it runs the API until SIGTERM
+// or SIGINT. args are the configuration flags.
+func runServe(args []string, _, _ io.Writer) int {
+	cfg, err := conff.Load(args)
 	if err != nil {
-		log.Fatalf("Error loading configuration, error: %v", err)
+		fatal("invalid configuration", "error", err)
+	}
+	if err := setupLogging(cfg); err != nil {
+		fatal("configuring logging", "error", err)
+	}
+	shutdownTracing, err := setupTracing(context.Background(), cfg)
+	if err != nil {
+		fatal("configuring tracing", "error", err)
 	}
 
-	config := mysql.Config{
-		User:   cfg.DBUser,
-		Passwd: cfg.DBPassword,
-		Net:    "tcp",
-		Addr:   fmt.Sprintf("%s:%s", cfg.DBHost, cfg.DBPort),
-		DBName: cfg.DBName,
+	// ctx stops the background tasks: token renewal, credential rotation
+	// and config reloads
+	ctx, stopBackground := context.WithCancel(context.Background())
+	if v := cfg.Vault(); v != nil {
+		go v.Run(ctx)
 	}
 
-	db, err = sql.Open("mysql", config.FormatDSN())
-	if err != nil {
-		log.Fatal("Error opening database:", err)
+	// Initialize database connection
+	if err := initDB(ctx, cfg); err != nil {
+		fatal("connecting to MySQL database", "error", err)
 	}
 
-	// Test the connection
-	err = db.Ping()
+	migrator, err := newMigrator(cfg, db)
 	if err != nil {
-		log.Fatalf("error connecting to MySQL database, error: %v", err)
-	} else {
-		log.Println("successfully connected to MySQL database")
+		fatal("loading migrations", "error", err)
+	}
+	if cfg.MigrateOnStart {
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			fatal("applying migrations", "error", err)
+		}
+		for _, mig := range applied {
+			slog.Info("applied migration", "version", mig.Version, "name", mig.Name)
+		}
 	}
 
-	createTable()
-}
+	passwords, err := newPasswordManager(cfg)
+	if err != nil {
+		fatal("configuring password hashing", "error", err)
+	}
+	tokens, err := newTokenService(cfg)
+	if err != nil {
+		fatal("configuring authentication", "error", err)
+	}
+	s := newServer(store.NewMySQLStore(tracing.WrapDB(db, cfg.DBName)), passwords, tokens)
+	if err := configureStaticAPIKey(s, cfg); err != nil {
+		fatal("configuring API key", "error", err)
+	}
+	s.validator.Password = validate.PasswordPolicy{
+		MinLength:  cfg.PasswordMinLength,
+		MaxLength:  cfg.PasswordMaxLength,
+		MinClasses: cfg.PasswordMinClasses,
+	}
+	s.maxBodyBytes = int64(cfg.MaxRequestBodyBytes)
+	if s.errorFormat, err = apierror.ParseFormat(cfg.ErrorFormat); err != nil {
+		fatal("configuring error responses", "error", err)
+	}
+	limiter, limiterStore, err := newRateLimiter(ctx, cfg)
+	if err != nil {
+		fatal("configuring rate limiting", "error", err)
+	}
+	s.limiter = limiter
+	r := s.routes()
+	r.Use(logging.Middleware(slog.Default()))
+	r.Use(tracing.Middleware)
 
-func createTable() {
-	query := `
-	CREATE TABLE IF NOT EXISTS users (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		username VARCHAR(50) UNIQUE NOT NULL,
-		email VARCHAR(100) UNIQUE NOT NULL,
-		password VARCHAR(255) NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
-	)`
-
-	_, err := db.Exec(query)
+	h, err := newHealth(cfg, db, migrator)
 	if err != nil {
-		log.Fatal("Error creating table:", err)
+		fatal("configuring health checks", "error", err)
+	}
+	registerHealthRoutes(r, h)
+
+	if cfg.MetricsEnabled {
+		m, err := newMetrics(cfg, db)
+		if err != nil {
+			fatal("configuring metrics", "error", err)
+		}
+		registerMetricsRoutes(r, m, cfg.MetricsPath)
+	}
+
+	reloads := newReloader(cfg, args)
+	reloads.onChange(reloadLogLevel)
+	reloads.onChange(reloadDB)
+	reloads.onChange(s.reloadRateLimits)
+	go reloads.run(ctx)
+
+	srv := &http.Server{
+		Addr:    ":" + cfg.ServerPort,
+		Handler: secure(r, cfg),
+	}
+	if err := configureTLS(ctx, cfg, srv, s); err != nil {
+		fatal("configuring TLS", "error", err)
+	}
+	lc := lifecycle.New(srv, cfg.ShutdownDelay, cfg.ShutdownTimeout)
+	lc.OnDrain(h.Drain)
+	lc.OnStop("background tasks", func(context.Context) error {
+		stopBackground()
+		return nil
+	})
+	lc.OnStop("database", func(context.Context) error { return db.Close() })
+	if limiterStore != nil {
+		lc.OnStop("rate limit store", func(context.Context) error { return limiterStore.Close() })
 	}
+	lc.OnStop("tracing", shutdownTracing)
 
-	fmt.Println("Users table created or already exists")
+	slog.Info("server starting", "port", cfg.ServerPort, "tls", srv.TLSConfig != nil, "version", version)
+	if err := lc.Run(context.Background()); err != nil {
+		slog.Error("server stopped", "error", err)
+		return 1
+	}
+	return 0
 }
 
-func createUser(w http.ResponseWriter, r *http.Request) {
-	var req CreateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
-		return
+// initDB opens the connection pool described by cfg as db
+func initDB(ctx context.Context, cfg *conff.Config) error {
+	if cfg.DBVaultRole != "" {
+		pool, err := openDynamicDB(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		db = pool
+		slog.Info("connected to MySQL database", "host", cfg.DBHost, "vault_role", cfg.DBVaultRole)
+		return nil
 	}
 
-	// Validate required fields
-	if req.Username == "" || req.Email == "" || req.Password == "" {
-		respondWithError(w, http.StatusBadRequest, "Username, email, and password are required")
+	sqlDB, err := openDB(ctx, cfg, cfg.DBUser, cfg.DBPassword)
+	if err != nil {
+		return err
+	}
+	db = dbpool.New(sqlDB)
+	db.DrainTimeout = cfg.DBDrainTimeout
+	slog.Info("connected to MySQL database", "host", cfg.DBHost, "user", cfg.DBUser)
+	return nil
+}
+
+func (s *server) createUser(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, authz.ActionCreate, userResource(0)) {
 		return
 	}
 
-	// Insert user into database
-	query := "INSERT INTO users (username, email, password) VALUES (?, ?, ?)"
-	result, err := db.Exec(Escape(query), req.Username, req.Email, req.Password)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error creating user: "+err.Error())
+	var req CreateUserRequest
+	if !s.decodeJSON(w, r, &req) || !s.valid(w, r, &req) {
 		return
 	}
 
-	userID, err := result.LastInsertId()
+	hash, err := s.passwords.Hash(req.Password)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "error getting user ID")
+		s.respondWithError(w, r, apierror.From(err, ""))
 		return
 	}
 
-	// Get the created user
-	user, err := getUserByID(int(userID))
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "error retrieving created user")
+	// Insert user into database
+	user := User{Username: req.Username, Email: req.Email, Password: hash, Role: authz.RoleUser}
+	if err := s.users.Create(r.Context(), &user); err != nil {
+		s.respondWithError(w, r, apierror.From(err, "User"))
 		return
 	}
 
+	w.Header().Set("ETag", etag(&user))
 	respondWithJSON(w, http.StatusCreated, Response{
 		Success: true,
 		Message: "User created successfully",
@@ -187,47 +301,54 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func getUsers(w http.ResponseWriter, r *http.Request) {
-	query := "SELECT id, username, email, created_at, updated_at FROM users ORDER BY created_at DESC"
-	rows, err := db.Query(query)
+func (s *server) getUsers(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, authz.ActionList, userResource(0)) {
+		return
+	}
+
+	opts, err := parseListOptions(r.URL.Query())
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "error fetching users")
+		s.respondWithError(w, r, apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, err.Error()))
 		return
 	}
-	defer rows.Close()
 
-	var users []User
-	for rows.Next() {
-		var user User
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt)
-		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "error scanning user data")
-			return
-		}
-		users = append(users, user)
+	users, next, err := s.users.List(r.Context(), opts)
+	if err != nil {
+		s.respondWithError(w, r, apierror.From(err, "User"))
+		return
 	}
 
+	meta := &Meta{Limit: opts.Limit}
+	if next != nil {
+		meta.NextCursor = next.Encode()
+	}
 	respondWithJSON(w, http.StatusOK, Response{
 		Success: true,
 		Message: "Users retrieved successfully",
 		Data:    users,
+		Meta:    meta,
 	})
 }
 
-func getUser(w http.ResponseWriter, r *http.Request) {
+func (s *server) getUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		s.respondWithError(w, r, apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "Invalid user ID"))
 		return
 	}
 
-	user, err := getUserByID(id)
+	if !s.allow(w, r, authz.ActionRead, userResource(id)) {
+		return
+	}
+
+	user, err := s.users.Get(r.Context(), id)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "User not found")
+		s.respondWithError(w, r, apierror.From(err, "User"))
 		return
 	}
 
+	w.Header().Set("ETag", etag(user))
 	respondWithJSON(w, http.StatusOK, Response{
 		Success: true,
 		Message: "User retrieved successfully",
@@ -235,69 +356,67 @@ func getUser(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func updateUser(w http.ResponseWriter, r *http.Request) {
+func (s *server) updateUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		s.respondWithError(w, r, apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "Invalid user ID"))
+		return
+	}
+
+	if !s.allow(w, r, authz.ActionUpdate, userResource(id)) {
 		return
 	}
 
+	// PUT replaces the whole user, so every field is required
 	var req UpdateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+	if !s.decodeJSON(w, r, &req) || !s.valid(w, r, &req) {
 		return
 	}
 
 	// Check if user exists
-	_, err = getUserByID(id)
+	current, err := s.users.Get(r.Context(), id)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "User not found")
+		s.respondWithError(w, r, apierror.From(err, "User"))
 		return
 	}
-
-	// Update user
-	query := "UPDATE users SET username = ?, email = ?, password = ? WHERE id = ?"
-	_, err = db.Exec(Escape(query), req.Username, req.Email, req.Password, id)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error updating user: "+err.Error())
+	if !ifMatch(r, current) {
+		s.respondWithError(w, r, apierror.New(http.StatusPreconditionFailed, apierror.CodePreconditionFailed, "User was modified by another request"))
 		return
 	}
 
-	// Get updated user
-	user, err := getUserByID(id)
+	hash, err := s.passwords.Hash(req.Password)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error retrieving updated user")
+		s.respondWithError(w, r, apierror.From(err, ""))
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, Response{
-		Success: true,
-		Message: "User updated successfully",
-		Data:    user,
-	})
+	// Update user
+	user := User{ID: id, Username: req.Username, Email: req.Email, Password: hash, Version: current.Version}
+	s.saveUser(w, r, &user)
 }
 
-func deleteUser(w http.ResponseWriter, r *http.Request) {
+func (s *server) deleteUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		s.respondWithError(w, r, apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "Invalid user ID"))
+		return
+	}
+
+	if !s.allow(w, r, authz.ActionDelete, userResource(id)) {
 		return
 	}
 
 	// Check if user exists
-	_, err = getUserByID(id)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "User not found")
+	if _, err := s.users.Get(r.Context(), id); err != nil {
+		s.respondWithError(w, r, apierror.From(err, "User"))
 		return
 	}
 
 	// Delete user
-	query := "DELETE FROM users WHERE id = ?"
-	_, err = db.Exec(Escape(query), id)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error deleting user: "+err.Error())
+	if err := s.users.Delete(r.Context(), id); err != nil {
+		s.respondWithError(w, r, apierror.From(err, "User"))
 		return
 	}
 
@@ -307,27 +426,16 @@ func deleteUser(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func getUserByID(id int) (*User, error) {
-	query := "SELECT id, username, email, created_at, updated_at FROM users WHERE id = ?"
-	var user User
-	err := db.QueryRow(Escape(query), id).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt)
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
-}
-
 func respondWithJSON(w http.ResponseWriter, status int, data any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(data)
 }
 
-func respondWithError(w http.ResponseWriter, status int, message string) {
-	respondWithJSON(w, status, Response{
-		Success: false,
-		Message: message,
-	})
+// respondWithError responds with err as application/problem+json, or in the
+// legacy Response envelope for clients asking for application/json
+func (s *server) respondWithError(w http.ResponseWriter, r *http.Request, err error) {
+	apierror.Write(w, r, err, s.errorFormat)
 }
 
 // Escape is a helper function to escape special characters in SQL queries
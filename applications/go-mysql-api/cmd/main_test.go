@@ -2,64 +2,26 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/json"
 	"fmt"
+	"goapp_CI/apierror"
+	"goapp_CI/auth"
+	"goapp_CI/authz"
 	"goapp_CI/conff"
+	"goapp_CI/password"
+	"goapp_CI/store"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
-// Mock database for testing
-type MockDB struct {
-	users  map[int]*User
-	nextID int
-}
-
-func NewMockDB() *MockDB {
-	return &MockDB{
-		users:  make(map[int]*User),
-		nextID: 1,
-	}
-}
-
-func (m *MockDB) Exec(query string, args ...interface{}) (sql.Result, error) {
-	// Mock implementation for testing
-	return &MockResult{lastInsertID: int64(m.nextID)}, nil
-}
-
-func (m *MockDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	// Mock implementation for testing
-	return nil, nil
-}
-
-func (m *MockDB) QueryRow(query string, args ...interface{}) *sql.Row {
-	// Mock implementation for testing
-	return nil
-}
-
-func (m *MockDB) Close() error {
-	return nil
-}
-
-type MockResult struct {
-	lastInsertID int64
-}
-
-func (m *MockResult) LastInsertId() (int64, error) {
-	return m.lastInsertID, nil
-}
-
-func (m *MockResult) RowsAffected() (int64, error) {
-	return 1, nil
-}
-
 // Test setup
 func setupTest(t *testing.T) (*httptest.ResponseRecorder, *mux.Router) {
 	// Set test environment variables
@@ -70,16 +32,46 @@ func setupTest(t *testing.T) (*httptest.ResponseRecorder, *mux.Router) {
 	os.Setenv("DB_NAME", "test_db")
 	os.Setenv("SERVER_PORT", "8080")
 
-	router := mux.NewRouter()
-	router.HandleFunc("/users", createUser).Methods("POST")
-	router.HandleFunc("/users", getUsers).Methods("GET")
-	router.HandleFunc("/users/{id}", getUser).Methods("GET")
-	router.HandleFunc("/users/{id}", updateUser).Methods("PUT")
-	router.HandleFunc("/users/{id}", deleteUser).Methods("DELETE")
+	router := newServer(store.NewMemoryStore(), testPasswords(), testTokens).routes()
 
 	return httptest.NewRecorder(), router
 }
 
+// testPasswords returns a password manager with cheap parameters for fast tests
+func testPasswords() *password.Manager {
+	return password.NewManager(
+		&password.Argon2id{Memory: 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32},
+		&password.Bcrypt{Cost: bcrypt.MinCost},
+	)
+}
+
+// testTokens signs the tokens used by authorize
+var testTokens = func() *auth.TokenService {
+	key, err := auth.NewHMACKey("test", []byte("test-secret-test-secret-test-secret"))
+	if err != nil {
+		panic(err)
+	}
+	keys, err := auth.NewKeySet(key)
+	if err != nil {
+		panic(err)
+	}
+	return auth.NewTokenService(keys, "test", "test", time.Minute, time.Hour)
+}()
+
+// authorize adds an access token for a test admin to req
+func authorize(req *http.Request) {
+	authorizeAs(req, auth.Identity{UserID: 1, Username: "admin", Role: authz.RoleAdmin})
+}
+
+// authorizeAs adds an access token for id to req
+func authorizeAs(req *http.Request, id auth.Identity) {
+	pair, err := testTokens.Issue(id)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+}
+
 // Test configuration loading
 func TestLoadConfig(t *testing.T) {
 	// Test with environment variables
@@ -107,6 +99,7 @@ func TestCreateUser(t *testing.T) {
 
 	jsonData, _ := json.Marshal(userData)
 	req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(jsonData))
+	authorize(req)
 	req.Header.Set("Content-Type", "application/json")
 
 	router.ServeHTTP(recorder, req)
@@ -132,7 +125,9 @@ func TestCreateUserInvalidData(t *testing.T) {
 
 	jsonData, _ := json.Marshal(userData)
 	req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(jsonData))
+	authorize(req)
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
 
 	router.ServeHTTP(recorder, req)
 
@@ -150,6 +145,7 @@ func TestGetUsers(t *testing.T) {
 	recorder, router := setupTest(t)
 
 	req, _ := http.NewRequest("GET", "/users", nil)
+	authorize(req)
 	router.ServeHTTP(recorder, req)
 
 	assert.Equal(t, http.StatusOK, recorder.Code)
@@ -166,16 +162,20 @@ func TestGetUserByID(t *testing.T) {
 	recorder, router := setupTest(t)
 
 	req, _ := http.NewRequest("GET", "/users/1", nil)
+	authorize(req)
 	router.ServeHTTP(recorder, req)
 
 	// Should return 404 for non-existent user
 	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, "application/problem+json", recorder.Header().Get("Content-Type"))
 
-	var response Response
-	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	var problem apierror.Problem
+	err := json.Unmarshal(recorder.Body.Bytes(), &problem)
 	require.NoError(t, err)
-	assert.False(t, response.Success)
-	assert.Equal(t, "User not found", response.Message)
+	assert.Equal(t, http.StatusNotFound, problem.Status)
+	assert.Equal(t, apierror.CodeNotFound, problem.Code)
+	assert.Equal(t, "User not found", problem.Detail)
+	assert.Equal(t, "/users/1", problem.Instance)
 }
 
 // Test update user
@@ -190,6 +190,7 @@ func TestUpdateUser(t *testing.T) {
 
 	jsonData, _ := json.Marshal(userData)
 	req, _ := http.NewRequest("PUT", "/users/1", bytes.NewBuffer(jsonData))
+	authorize(req)
 	req.Header.Set("Content-Type", "application/json")
 
 	router.ServeHTTP(recorder, req)
@@ -203,17 +204,78 @@ func TestDeleteUser(t *testing.T) {
 	recorder, router := setupTest(t)
 
 	req, _ := http.NewRequest("DELETE", "/users/1", nil)
+	authorize(req)
 	router.ServeHTTP(recorder, req)
 
 	// Should return 404 for non-existent user
 	assert.Equal(t, http.StatusNotFound, recorder.Code)
 }
 
+// Test full lifecycle against the in-memory store
+func TestUserLifecycleInMemory(t *testing.T) {
+	_, router := setupTest(t)
+
+	jsonData, _ := json.Marshal(CreateUserRequest{Username: "memuser", Email: "mem@example.com", Password: "password123"})
+	req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(jsonData))
+	authorize(req)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	req, _ = http.NewRequest("GET", "/users/1", nil)
+	authorize(req)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	jsonData, _ = json.Marshal(UpdateUserRequest{Username: "memuser2", Email: "mem2@example.com", Password: "newpassword123"})
+	req, _ = http.NewRequest("PUT", "/users/1", bytes.NewBuffer(jsonData))
+	authorize(req)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	req, _ = http.NewRequest("DELETE", "/users/1", nil)
+	authorize(req)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	req, _ = http.NewRequest("GET", "/users/1", nil)
+	authorize(req)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+// Test that a taken username is a conflict, not a server error
+func TestCreateDuplicateUser(t *testing.T) {
+	_, router := setupTest(t)
+
+	body, _ := json.Marshal(CreateUserRequest{Username: "alice", Email: "alice@example.com", Password: "password123"})
+	for _, want := range []int{http.StatusCreated, http.StatusConflict} {
+		req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(body))
+		authorize(req)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		require.Equal(t, want, recorder.Code)
+
+		if want == http.StatusConflict {
+			var problem apierror.Problem
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+			assert.Equal(t, apierror.CodeDuplicate, problem.Code)
+			assert.Equal(t, "User already exists", problem.Detail)
+		}
+	}
+}
+
 // Test invalid user ID
 func TestInvalidUserID(t *testing.T) {
 	recorder, router := setupTest(t)
 
 	req, _ := http.NewRequest("GET", "/users/invalid", nil)
+	authorize(req)
+	req.Header.Set("Accept", "application/json")
 	router.ServeHTTP(recorder, req)
 
 	assert.Equal(t, http.StatusBadRequest, recorder.Code)
@@ -249,8 +311,11 @@ func TestResponseFormatting(t *testing.T) {
 // Test error response
 func TestErrorResponse(t *testing.T) {
 	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Accept", "application/json")
 
-	respondWithError(recorder, http.StatusBadRequest, "Test error")
+	s := newServer(store.NewMemoryStore(), testPasswords(), testTokens)
+	s.respondWithError(recorder, req, apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "Test error"))
 
 	assert.Equal(t, http.StatusBadRequest, recorder.Code)
 
@@ -299,6 +364,7 @@ func BenchmarkCreateUser(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(jsonData))
+		authorize(req)
 		req.Header.Set("Content-Type", "application/json")
 		router.ServeHTTP(recorder, req)
 	}
@@ -310,6 +376,7 @@ func BenchmarkGetUsers(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		req, _ := http.NewRequest("GET", "/users", nil)
+		authorize(req)
 		router.ServeHTTP(recorder, req)
 	}
 }
@@ -323,6 +390,7 @@ func TestMain(m *testing.M) {
 	os.Setenv("DB_PORT", "3306")
 	os.Setenv("DB_NAME", "test_db")
 	os.Setenv("SERVER_PORT", "8080")
+	os.Setenv("JWT_SECRET", "test-secret-test-secret-test-secret")
 
 	// Run tests
 	code := m.Run()
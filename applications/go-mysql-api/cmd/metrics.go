@@ -0,0 +1,35 @@
+package main
+
+import (
+	"goapp_CI/conff"
+	"goapp_CI/dbpool"
+	"goapp_CI/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// version and commit identify the build; set them with
+// -ldflags "-X main.version=... -X main.commit=..."
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
+// newMetrics returns the HTTP metrics together with pool and build collectors
+func newMetrics(cfg *conff.Config, db *dbpool.Pool) (*metrics.Metrics, error) {
+	m := metrics.New()
+	err := m.Register(
+		metrics.NewDBStatsCollector(cfg.DBName, db.Stats),
+		metrics.NewBuildInfo(version, commit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// registerMetricsRoutes instruments every route on r and serves the metrics on path
+func registerMetricsRoutes(r *mux.Router, m *metrics.Metrics, path string) {
+	r.Use(m.Middleware)
+	r.Handle(path, m.Handler()).Methods("GET")
+}
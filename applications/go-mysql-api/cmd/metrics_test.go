@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"goapp_CI/metrics"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that API requests show up on the metrics endpoint by route template
+func TestMetricsRoute(t *testing.T) {
+	_, router := setupTest(t)
+	registerMetricsRoutes(router, metrics.New(), "/metrics")
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	authorize(req)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `http_requests_total{code="404",method="GET",route="/users/{id}"} 1`)
+}
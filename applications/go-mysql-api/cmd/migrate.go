@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"goapp_CI/conff"
+	"goapp_CI/migrate"
+)
+
+const migrateUsage = "usage: main migrate up|down [steps]|status [flags]"
+
+// newMigrator returns a migrator for the embedded migrations using cfg's lock timeout
+func newMigrator(cfg *conff.Config, db migrate.DB) (*migrate.Migrator, error) {
+	m, err := migrate.New(db)
+	if err != nil {
+		return nil, err
+	}
+	m.LockTimeout = cfg.MigrateLockTimeout
+	return m, nil
+}
+
+// runMigrate implements the migrate subcommand. The action and its steps
+// come first; the remaining args are the same flags as the server takes.
+func runMigrate(args []string, out, errOut io.Writer) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(errOut, migrateUsage)
+		return 2
+	}
+	n := 1
+	if args[0] == "down" && len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+		n = 2
+	}
+	command, flags := args[:n], args[n:]
+
+	cfg, err := conff.Load(flags)
+	if err != nil {
+		fmt.Fprintf(errOut, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+	if err := setupLogging(cfg); err != nil {
+		fmt.Fprintf(errOut, "configuring logging: %v\n", err)
+		return 1
+	}
+
+	// ctx stops the credential rotation of a pool with Vault credentials
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := initDB(ctx, cfg); err != nil {
+		fmt.Fprintf(errOut, "migrate: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	m, err := newMigrator(cfg, db)
+	if err != nil {
+		fmt.Fprintf(errOut, "migrate: %v\n", err)
+		return 1
+	}
+
+	if err := migrateCommand(ctx, m, command, out); err != nil {
+		fmt.Fprintf(errOut, "migrate: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func migrateCommand(ctx context.Context, m *migrate.Migrator, args []string, out io.Writer) error {
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, mig := range applied {
+			fmt.Fprintf(out, "applied %d_%s\n", mig.Version, mig.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := m.Down(ctx, steps)
+		for _, mig := range reverted {
+			fmt.Fprintf(out, "reverted %d_%s\n", mig.Version, mig.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], migrateUsage)
+	}
+}
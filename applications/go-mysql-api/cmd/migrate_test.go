@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"goapp_CI/migrate"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test argument validation of the migrate subcommand
+func TestMigrateCommandArguments(t *testing.T) {
+	m, err := migrate.New(nil)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.ErrorContains(t, migrateCommand(context.Background(), m, []string{"sideways"}, &out), "unknown command")
+	assert.ErrorContains(t, migrateCommand(context.Background(), m, []string{"down", "zero"}, &out), "invalid number of steps")
+	assert.ErrorContains(t, migrateCommand(context.Background(), m, []string{"down", "0"}, &out), "invalid number of steps")
+}
+
+// Test that the migrate subcommand takes the server flags and reports
+// failures through its exit status
+func TestRunMigrate(t *testing.T) {
+	var out, errOut bytes.Buffer
+	assert.Equal(t, 2, runMigrate(nil, &out, &errOut))
+	assert.Contains(t, errOut.String(), "usage: main migrate")
+
+	errOut.Reset()
+	assert.Equal(t, 1, runMigrate([]string{"down", "2", "-db-port", "0"}, &out, &errOut))
+	assert.Contains(t, errOut.String(), "DB_PORT: must be a port number")
+
+	errOut.Reset()
+	code := runMigrate([]string{"status", "-db-host", "127.0.0.1", "-db-port", "1", "-db-dial-timeout", "1s"}, &out, &errOut)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut.String(), "migrate: connecting to MySQL database")
+	assert.Empty(t, out.String())
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"goapp_CI/apierror"
+	"goapp_CI/authz"
+	"goapp_CI/store"
+	"goapp_CI/validate"
+
+	"github.com/gorilla/mux"
+)
+
+// patchableFields are the user fields a merge patch may set, with their
+// validation rules
+var patchableFields = map[string]string{
+	"username": "required,username,max=50",
+	"email":    "required,email,max=100",
+	"password": "required,password",
+}
+
+// etag returns the entity tag of the current version of u
+func etag(u *User) string {
+	return fmt.Sprintf(`"%d"`, u.Version)
+}
+
+// ifMatch reports whether the If-Match header of r, if any, matches the
+// current version of u
+func ifMatch(r *http.Request, u *User) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" || strings.TrimSpace(header) == "*" {
+		return true
+	}
+	current := etag(u)
+	for _, tag := range strings.Split(header, ",") {
+		// Weak tags never match under the strong comparison If-Match requires
+		if strings.TrimSpace(tag) == current {
+			return true
+		}
+	}
+	return false
+}
+
+// patchUser applies a JSON Merge Patch (RFC 7396) to a user
+func (s *server) patchUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		s.respondWithError(w, r, apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "Invalid user ID"))
+		return
+	}
+
+	if !s.allow(w, r, authz.ActionUpdate, userResource(id)) {
+		return
+	}
+
+	var patch map[string]json.RawMessage
+	if !s.decodeJSON(w, r, &patch, "application/merge-patch+json", "application/json") {
+		return
+	}
+
+	current, err := s.users.Get(r.Context(), id)
+	if err != nil {
+		s.respondWithError(w, r, apierror.From(err, "User"))
+		return
+	}
+	if !ifMatch(r, current) {
+		s.respondWithError(w, r, apierror.New(http.StatusPreconditionFailed, apierror.CodePreconditionFailed, "User was modified by another request"))
+		return
+	}
+
+	values := map[string]string{"username": current.Username, "email": current.Email}
+	var errs validate.Errors
+	for _, field := range sortedKeys(patch) {
+		if _, ok := patchableFields[field]; !ok {
+			errs.Add(field, validate.CodeReadOnly, "cannot be changed")
+			continue
+		}
+		// A null member removes the field, which no user field allows
+		var value *string
+		if err := json.Unmarshal(patch[field], &value); err != nil {
+			errs.Add(field, validate.CodeInvalidType, "must be a string")
+			continue
+		}
+		if value == nil {
+			errs.Add(field, validate.CodeRequired, "cannot be removed")
+			continue
+		}
+		values[field] = *value
+		s.validator.Value(&errs, field, *value, patchableFields[field])
+	}
+	if len(errs) > 0 {
+		s.respondWithError(w, r, errs)
+		return
+	}
+
+	// A patch that changes nothing, such as {}, leaves the version alone
+	if _, ok := values["password"]; !ok && values["username"] == current.Username && values["email"] == current.Email {
+		w.Header().Set("ETag", etag(current))
+		respondWithJSON(w, http.StatusOK, Response{
+			Success: true,
+			Message: "User updated successfully",
+			Data:    current,
+		})
+		return
+	}
+
+	user := User{ID: id, Username: values["username"], Email: values["email"], Version: current.Version}
+	if plain, ok := values["password"]; ok {
+		user.Password, err = s.passwords.Hash(plain)
+		if err != nil {
+			s.respondWithError(w, r, apierror.From(err, ""))
+			return
+		}
+	}
+	s.saveUser(w, r, &user)
+}
+
+// saveUser stores user if it is still at the version it was read at and
+// responds with the result. Losing to a concurrent update is a failed
+// precondition only when the request sent one (RFC 9110 §13.1.1), and a
+// conflict otherwise.
+func (s *server) saveUser(w http.ResponseWriter, r *http.Request, user *User) {
+	if err := s.users.Update(r.Context(), user); err != nil {
+		if errors.Is(err, store.ErrConflict) && r.Header.Get("If-Match") != "" {
+			s.respondWithError(w, r, apierror.New(http.StatusPreconditionFailed, apierror.CodePreconditionFailed, "User was modified by another request"))
+			return
+		}
+		s.respondWithError(w, r, apierror.From(err, "User"))
+		return
+	}
+
+	w.Header().Set("ETag", etag(user))
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "User updated successfully",
+		Data:    user,
+	})
+}
+
+// sortedKeys returns the members of a JSON object in a stable order, so that
+// field errors are reported consistently
+func sortedKeys(obj map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
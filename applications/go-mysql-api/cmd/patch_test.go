@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goapp_CI/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPatchTestServer returns a router with one user, alice, whose password
+// is password123
+func newPatchTestServer(t *testing.T) http.Handler {
+	users := store.NewMemoryStore()
+	srv := newServer(users, testPasswords(), testTokens)
+	hash, err := srv.passwords.Hash("password123")
+	require.NoError(t, err)
+	require.NoError(t, users.Create(context.Background(), &User{Username: "alice", Email: "alice@example.com", Password: hash}))
+	return srv.routes()
+}
+
+func sendUser(router http.Handler, method, body string, header map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/users/1", bytes.NewBufferString(body))
+	authorize(req)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// Test merge patch semantics of PATCH /users/{id}
+func TestPatchUser(t *testing.T) {
+	router := newPatchTestServer(t)
+	mergePatch := map[string]string{"Content-Type": "application/merge-patch+json"}
+
+	recorder := sendUser(router, "PATCH", `{"email": "alice@example.org"}`, mergePatch)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, `"2"`, recorder.Header().Get("ETag"))
+
+	var response struct {
+		Data User `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, "alice", response.Data.Username)
+	assert.Equal(t, "alice@example.org", response.Data.Email)
+
+	// The password was left untouched
+	recorder = postJSON(router, "/auth/login", LoginRequest{Username: "alice", Password: "password123"})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = sendUser(router, "PATCH", `{"password": "newpassword123"}`, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = postJSON(router, "/auth/login", LoginRequest{Username: "alice", Password: "newpassword123"})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	tests := []struct {
+		name   string
+		body   string
+		header map[string]string
+		status int
+	}{
+		{"remove field", `{"email": null}`, mergePatch, http.StatusBadRequest},
+		{"empty field", `{"username": ""}`, mergePatch, http.StatusBadRequest},
+		{"read-only field", `{"role": "admin"}`, mergePatch, http.StatusBadRequest},
+		{"wrong type", `{"username": 5}`, mergePatch, http.StatusBadRequest},
+		{"not an object", `["username"]`, mergePatch, http.StatusBadRequest},
+		{"invalid email", `{"email": "alice"}`, mergePatch, http.StatusBadRequest},
+		{"long username", `{"username": "` + strings.Repeat("a", 51) + `"}`, mergePatch, http.StatusBadRequest},
+		{"wrong content type", `{"username": "bob"}`, map[string]string{"Content-Type": "text/plain"}, http.StatusUnsupportedMediaType},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.status, sendUser(router, "PATCH", test.body, test.header).Code)
+		})
+	}
+}
+
+// Test that PUT replaces the whole user
+func TestPutRequiresAllFields(t *testing.T) {
+	router := newPatchTestServer(t)
+
+	recorder := sendUser(router, "PUT", `{"username": "alice", "email": "alice@example.com"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = sendUser(router, "PUT", `{"username": "alice2", "email": "alice2@example.com", "password": "newpassword123"}`, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, `"2"`, recorder.Header().Get("ETag"))
+}
+
+// Test optimistic concurrency with ETag and If-Match
+func TestUpdateIfMatch(t *testing.T) {
+	router := newPatchTestServer(t)
+
+	recorder := sendUser(router, "GET", "", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	tag := recorder.Header().Get("ETag")
+	require.Equal(t, `"1"`, tag)
+
+	// The first writer wins, the second one read the same version and loses
+	recorder = sendUser(router, "PATCH", `{"username": "first"}`, map[string]string{"If-Match": tag})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = sendUser(router, "PATCH", `{"username": "second"}`, map[string]string{"If-Match": tag})
+	assert.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+	recorder = sendUser(router, "PUT", `{"username": "second", "email": "s@example.com", "password": "password123"}`, map[string]string{"If-Match": tag})
+	assert.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+
+	recorder = sendUser(router, "PATCH", `{"username": "second"}`, map[string]string{"If-Match": `"1", "2"`})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = sendUser(router, "PATCH", `{"username": "third"}`, map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = sendUser(router, "PATCH", `{"username": "fourth"}`, map[string]string{"If-Match": `W/"4"`})
+	assert.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+}
+
+// Test that a patch changing nothing does not write a new version
+func TestPatchWithoutChanges(t *testing.T) {
+	router := newPatchTestServer(t)
+
+	for _, body := range []string{`{}`, `{"username": "alice"}`} {
+		recorder := sendUser(router, "PATCH", body, nil)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, `"1"`, recorder.Header().Get("ETag"), body)
+	}
+}
+
+// losingStore loses every update to a concurrent writer
+type losingStore struct {
+	store.Store
+}
+
+func (losingStore) Update(context.Context, *User) error {
+	return store.ErrConflict
+}
+
+// Test that a lost race is 412 only for requests with If-Match
+func TestUpdateConflict(t *testing.T) {
+	users := store.NewMemoryStore()
+	srv := newServer(losingStore{users}, testPasswords(), testTokens)
+	require.NoError(t, users.Create(context.Background(), &User{Username: "alice", Email: "alice@example.com", Password: "x"}))
+	router := srv.routes()
+
+	put := `{"username": "alice2", "email": "alice2@example.com", "password": "newpassword123"}`
+	recorder := sendUser(router, "PUT", put, nil)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"code":"conflict"`)
+
+	recorder = sendUser(router, "PATCH", `{"username": "bob"}`, map[string]string{"If-Match": `"1"`})
+	assert.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"code":"precondition_failed"`)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"goapp_CI/apierror"
+	"goapp_CI/conff"
+	"goapp_CI/health"
+	"goapp_CI/ratelimit"
+)
+
+// rateLimitSettings are the settings of the rate limit policy
+var rateLimitSettings = []string{"RATE_LIMIT_ENABLED", "RATE_LIMIT_DEFAULT", "RATE_LIMIT_ROUTES", "RATE_LIMIT_TRUSTED_PROXIES"}
+
+// newRateLimiter builds the rate limiter described by cfg. With the redis
+// backend it also returns the store, to be closed on shutdown.
+func newRateLimiter(ctx context.Context, cfg *conff.Config) (*ratelimit.Limiter, *ratelimit.RedisStore, error) {
+	policy, err := rateLimitPolicy(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.RateLimitBackend != "redis" {
+		return ratelimit.New(ratelimit.NewMemoryStore(), policy), nil, nil
+	}
+
+	redis, err := ratelimit.NewRedisStore(ratelimit.RedisOptions{
+		URL:     cfg.RateLimitRedisURL,
+		Timeout: cfg.RateLimitRedisTimeout,
+		Prefix:  "go-mysql-api:ratelimit:",
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// Requests are let through while Redis is down, so an unreachable
+	// Redis only warrants a warning
+	if err := redis.Ping(ctx); err != nil {
+		slog.Warn("rate limit backend unreachable", "error", err)
+	}
+	return ratelimit.New(redis, policy), redis, nil
+}
+
+// rateLimitPolicy returns the rate limit policy configured in cfg
+func rateLimitPolicy(cfg *conff.Config) (ratelimit.Policy, error) {
+	policy, err := ratelimit.ParsePolicy(cfg.RateLimitDefault, cfg.RateLimitRoutes)
+	if err != nil {
+		return ratelimit.Policy{}, fmt.Errorf("RATE_LIMIT_DEFAULT or RATE_LIMIT_ROUTES: %w", err)
+	}
+	policy.Disabled = !cfg.RateLimitEnabled
+	if policy.TrustedProxies, err = health.ParseCIDRs(cfg.RateLimitTrustedProxies); err != nil {
+		return ratelimit.Policy{}, fmt.Errorf("RATE_LIMIT_TRUSTED_PROXIES: %w", err)
+	}
+	return policy, nil
+}
+
+// reloadRateLimits applies the new rate limit policy; buckets are kept
+func (s *server) reloadRateLimits(ctx context.Context, cfg *conff.Config, changed []string) (change, error) {
+	if s.limiter == nil || !containsAny(changed, rateLimitSettings) {
+		return change{}, nil
+	}
+	policy, err := rateLimitPolicy(cfg)
+	if err != nil {
+		return change{}, err
+	}
+	return change{apply: func() { s.limiter.SetPolicy(policy) }}, nil
+}
+
+// limit rate limits next, if the server has a rate limiter
+func (s *server) limit(next http.Handler) http.Handler {
+	if s.limiter == nil {
+		return next
+	}
+	return s.limiter.Middleware(s.tooManyRequests)(next)
+}
+
+func (s *server) tooManyRequests(w http.ResponseWriter, r *http.Request) {
+	s.respondWithError(w, r, apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "Too many requests"))
+}
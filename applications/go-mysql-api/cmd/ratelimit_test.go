@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goapp_CI/apierror"
+	"goapp_CI/conff"
+	"goapp_CI/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginIsRateLimited(t *testing.T) {
+	t.Setenv("RATE_LIMIT_ROUTES", "POST /auth/login=2/m")
+	cfg, err := conff.Load(nil)
+	require.NoError(t, err)
+
+	s := newServer(store.NewMemoryStore(), testPasswords(), testTokens)
+	s.limiter, _, err = newRateLimiter(context.Background(), cfg)
+	require.NoError(t, err)
+	router := s.routes()
+
+	login := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(`{"username":"nobody","password":"wrong"}`))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	assert.Equal(t, http.StatusUnauthorized, login().Code)
+	assert.Equal(t, http.StatusUnauthorized, login().Code)
+
+	rec := login()
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+	var problem apierror.Problem
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+	assert.Equal(t, apierror.CodeRateLimited, problem.Code)
+	assert.Equal(t, "Too many requests", problem.Detail)
+
+	// Limits change at runtime
+	t.Setenv("RATE_LIMIT_ENABLED", "false")
+	cfg, err = conff.Load(nil)
+	require.NoError(t, err)
+	c, err := s.reloadRateLimits(context.Background(), cfg, []string{"RATE_LIMIT_ENABLED"})
+	require.NoError(t, err)
+	c.apply()
+	assert.Equal(t, http.StatusUnauthorized, login().Code)
+
+	t.Setenv("RATE_LIMIT_DEFAULT", "often")
+	cfg, err = conff.Load(nil)
+	require.NoError(t, err)
+	_, err = s.reloadRateLimits(context.Background(), cfg, []string{"RATE_LIMIT_DEFAULT"})
+	assert.ErrorContains(t, err, "RATE_LIMIT_DEFAULT")
+}
+
+func TestLoginLimitBehindProxy(t *testing.T) {
+	t.Setenv("RATE_LIMIT_ROUTES", "POST /auth/login=1/m")
+	t.Setenv("RATE_LIMIT_TRUSTED_PROXIES", "127.0.0.0/8")
+	cfg, err := conff.Load(nil)
+	require.NoError(t, err)
+
+	s := newServer(store.NewMemoryStore(), testPasswords(), testTokens)
+	s.limiter, _, err = newRateLimiter(context.Background(), cfg)
+	require.NoError(t, err)
+	router := s.routes()
+
+	login := func(client string) int {
+		req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(`{"username":"nobody","password":"wrong"}`))
+		req.RemoteAddr = "127.0.0.1:40000"
+		req.Header.Set("X-Forwarded-For", client)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, login("203.0.113.7"))
+	assert.Equal(t, http.StatusTooManyRequests, login("203.0.113.7"))
+	// Another client behind the same sidecar has a bucket of its own
+	assert.Equal(t, http.StatusUnauthorized, login("198.51.100.4"))
+}
+
+func TestFailedAuthenticationIsRateLimited(t *testing.T) {
+	t.Setenv("RATE_LIMIT_DEFAULT", "2/m")
+	cfg, err := conff.Load(nil)
+	require.NoError(t, err)
+
+	s := newServer(store.NewMemoryStore(), testPasswords(), testTokens)
+	s.limiter, _, err = newRateLimiter(context.Background(), cfg)
+	require.NoError(t, err)
+	router := s.routes()
+
+	guess := func() int {
+		req := httptest.NewRequest("GET", "/users", nil)
+		req.Header.Set("X-API-Key", "gma_guessed")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, guess())
+	assert.Equal(t, http.StatusUnauthorized, guess())
+	assert.Equal(t, http.StatusTooManyRequests, guess())
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"goapp_CI/conff"
+)
+
+// applyFunc prepares applying the settings in changed from cfg at runtime.
+// It must not change anything live itself: every applier is prepared
+// before any change is applied, so a reload takes effect as a whole or not
+// at all.
+type applyFunc func(ctx context.Context, cfg *conff.Config, changed []string) (change, error)
+
+// change is a prepared runtime change. apply makes it live and cannot fail;
+// discard releases what was prepared when the reload is abandoned. Either
+// may be nil, and the zero change does nothing.
+type change struct {
+	apply   func()
+	discard func()
+}
+
+// reloader reloads the configuration on SIGHUP and when its files change,
+// applying the settings that can change at runtime
+type reloader struct {
+	args []string
+
+	mu       sync.Mutex
+	cfg      *conff.Config
+	appliers []applyFunc
+}
+
+func newReloader(cfg *conff.Config, args []string) *reloader {
+	return &reloader{cfg: cfg, args: args}
+}
+
+// onChange registers apply to run on every reload that changes a setting
+func (r *reloader) onChange(apply applyFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.appliers = append(r.appliers, apply)
+}
+
+// reload loads the configuration again, reading remote secrets again when
+// refresh is set. An invalid configuration, or one an applier fails to
+// prepare, is rejected as a whole. Otherwise the changed settings are
+// applied, and the ones that only take effect after a restart are returned.
+func (r *reloader) reload(ctx context.Context, refresh bool) (applied, restart []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := conff.Reload(r.args, r.cfg, refresh)
+	if err != nil {
+		return nil, nil, err
+	}
+	changed := r.cfg.Changed(cfg)
+	if len(changed) == 0 {
+		return nil, nil, nil
+	}
+
+	for _, name := range changed {
+		if conff.Reloadable(name) {
+			applied = append(applied, name)
+		} else {
+			restart = append(restart, name)
+		}
+	}
+	changes := make([]change, 0, len(r.appliers))
+	for _, prepare := range r.appliers {
+		c, err := prepare(ctx, cfg, applied)
+		if err != nil {
+			// Nothing was applied; keep the old configuration so the next
+			// reload tries again
+			for _, c := range changes {
+				if c.discard != nil {
+					c.discard()
+				}
+			}
+			return nil, restart, err
+		}
+		changes = append(changes, c)
+	}
+	for _, c := range changes {
+		if c.apply != nil {
+			c.apply()
+		}
+	}
+	r.cfg = cfg
+	return applied, restart, nil
+}
+
+// files returns the files of the current configuration
+func (r *reloader) files() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cfg.Files()
+}
+
+// run reloads on SIGHUP and on file changes until ctx is done. Only SIGHUP
+// reads Vault and AWS secrets again, so that rotating one is a matter of
+// signalling the process.
+func (r *reloader) run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	changed := make(chan struct{}, 1)
+	if interval := r.cfg.ConfigWatchInterval; interval > 0 {
+		go conff.Watch(ctx, r.files, interval, func() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+	}
+
+	for {
+		var refresh bool
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			slog.Info("SIGHUP received, reloading configuration")
+			refresh = true
+		case <-changed:
+			slog.Info("configuration files changed, reloading configuration")
+		}
+
+		applied, restart, err := r.reload(ctx, refresh)
+		if err != nil {
+			slog.Error("configuration reload failed, keeping the current settings", "error", err)
+			continue
+		}
+		if len(applied) > 0 {
+			slog.Info("configuration reloaded", "applied", applied)
+		}
+		if len(restart) > 0 {
+			slog.Warn("configuration reloaded, restart required for some settings", "settings", restart)
+		}
+	}
+}
+
+// dbSettings are the settings of the connection pool
+var dbSettings = []string{
+	"DB_USER", "DB_PASSWORD", "DB_HOST", "DB_PORT", "DB_NAME",
+	"DB_PARSE_TIME", "DB_LOCATION", "DB_COLLATION", "DB_DIAL_TIMEOUT", "DB_READ_TIMEOUT", "DB_WRITE_TIMEOUT",
+	"DB_TLS_MODE", "DB_TLS_CA_FILE", "DB_TLS_SERVER_NAME", "DB_PARAMS",
+	"DB_MAX_OPEN_CONNS", "DB_MAX_IDLE_CONNS", "DB_CONN_MAX_LIFETIME", "DB_CONN_MAX_IDLE_TIME",
+}
+
+// reloadDB opens a pool with the new database settings, to be swapped in.
+// Pools with credentials from Vault are rotated by their dbpool.Rotator
+// instead.
+func reloadDB(ctx context.Context, cfg *conff.Config, changed []string) (change, error) {
+	if cfg.DBVaultRole != "" || !containsAny(changed, dbSettings) {
+		return change{}, nil
+	}
+	sqlDB, err := openDB(ctx, cfg, cfg.DBUser, cfg.DBPassword)
+	if err != nil {
+		return change{}, err
+	}
+	return change{
+		apply:   func() { db.Swap(sqlDB) },
+		discard: func() { sqlDB.Close() },
+	}, nil
+}
+
+func containsAny(names, wanted []string) bool {
+	for _, name := range names {
+		for _, w := range wanted {
+			if name == w {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"goapp_CI/conff"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloaderAppliesChanges(t *testing.T) {
+	cfg, err := conff.Load(nil)
+	require.NoError(t, err)
+	r := newReloader(cfg, nil)
+
+	var got []string
+	r.onChange(func(ctx context.Context, cfg *conff.Config, changed []string) (change, error) {
+		return change{apply: func() { got = changed }}, nil
+	})
+
+	applied, restart, err := r.reload(context.Background(), true)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+	assert.Empty(t, restart)
+
+	t.Setenv("DB_PASSWORD", "rotated")
+	t.Setenv("JWT_ISSUER", "other-issuer")
+	applied, restart, err = r.reload(context.Background(), true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"DB_PASSWORD"}, applied)
+	assert.Equal(t, []string{"JWT_ISSUER"}, restart)
+	assert.Equal(t, []string{"DB_PASSWORD"}, got)
+
+	// Applied changes are not reported again
+	applied, restart, err = r.reload(context.Background(), true)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+	assert.Empty(t, restart)
+}
+
+func TestReloaderRejectsInvalidConfig(t *testing.T) {
+	cfg, err := conff.Load(nil)
+	require.NoError(t, err)
+	r := newReloader(cfg, nil)
+	called := false
+	r.onChange(func(ctx context.Context, cfg *conff.Config, changed []string) (change, error) {
+		called = true
+		return change{}, nil
+	})
+
+	t.Setenv("DB_PASSWORD", "rotated")
+	t.Setenv("DB_PORT", "0")
+	_, _, err = r.reload(context.Background(), true)
+	assert.ErrorContains(t, err, "DB_PORT")
+	assert.False(t, called)
+}
+
+func TestReloaderRetriesFailedApply(t *testing.T) {
+	cfg, err := conff.Load(nil)
+	require.NoError(t, err)
+	r := newReloader(cfg, nil)
+
+	var applied, discarded int
+	r.onChange(func(ctx context.Context, cfg *conff.Config, changed []string) (change, error) {
+		return change{apply: func() { applied++ }, discard: func() { discarded++ }}, nil
+	})
+	fail := errors.New("pool unreachable")
+	r.onChange(func(ctx context.Context, cfg *conff.Config, changed []string) (change, error) {
+		return change{}, fail
+	})
+
+	// A failing applier leaves the changes prepared by the others unapplied
+	t.Setenv("DB_PASSWORD", "rotated")
+	_, _, err = r.reload(context.Background(), true)
+	assert.ErrorIs(t, err, fail)
+	assert.Zero(t, applied)
+	assert.Equal(t, 1, discarded)
+
+	fail = nil
+	names, _, err := r.reload(context.Background(), true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"DB_PASSWORD"}, names)
+	assert.Equal(t, 1, applied)
+	assert.Equal(t, 1, discarded)
+}
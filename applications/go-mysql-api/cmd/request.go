@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"goapp_CI/apierror"
+	"goapp_CI/validate"
+)
+
+// defaultMaxBodyBytes bounds request bodies unless configured otherwise
+const defaultMaxBodyBytes = 64 << 10
+
+// decodeJSON decodes the JSON body of r into dst, responding with an error
+// and returning false if it cannot. The body must be a single JSON value of
+// at most maxBodyBytes with no fields dst does not have. A Content-Type
+// other than application/json, or one of mediaTypes if given, is rejected;
+// a missing one is taken to be JSON.
+func (s *server) decodeJSON(w http.ResponseWriter, r *http.Request, dst any, mediaTypes ...string) bool {
+	if len(mediaTypes) == 0 {
+		mediaTypes = []string{"application/json"}
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, _ := mime.ParseMediaType(ct)
+		if !contains(mediaTypes, mediaType) {
+			s.respondWithError(w, r, apierror.New(http.StatusUnsupportedMediaType, apierror.CodeUnsupportedMediaType, "Content-Type must be "+strings.Join(mediaTypes, " or ")))
+			return false
+		}
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBodyBytes))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if err == nil {
+		// Anything but whitespace after the value is an error, and reading
+		// to the end notices an oversized body
+		if _, err = dec.Token(); err == io.EOF {
+			err = nil
+		} else if err == nil {
+			err = errors.New("unexpected data after the JSON value")
+		}
+	}
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	var errs validate.Errors
+	switch {
+	case errors.As(err, &tooLarge):
+		s.respondWithError(w, r, apierror.New(http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, fmt.Sprintf("Request body must be at most %d bytes", tooLarge.Limit)))
+		return false
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		errs.Add(typeErr.Field, validate.CodeInvalidType, "must be a %s", jsonType(typeErr.Type.Kind().String()))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		errs.Add(field, validate.CodeUnknown, "is not a known field")
+	default:
+		s.respondWithError(w, r, apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "Invalid request body"))
+		return false
+	}
+	s.respondWithError(w, r, errs)
+	return false
+}
+
+// jsonType names a Go kind the way a JSON client would know it
+func jsonType(kind string) string {
+	switch {
+	case kind == "string":
+		return "string"
+	case kind == "bool":
+		return "boolean"
+	case kind == "slice" || kind == "array":
+		return "array"
+	case kind == "map" || kind == "struct" || kind == "ptr":
+		return "object"
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "number"
+	}
+	return kind
+}
+
+// valid checks req against its validate tags, responding with the field
+// errors and returning false if any fail
+func (s *server) valid(w http.ResponseWriter, r *http.Request, req any) bool {
+	if err := s.validator.Struct(req); err != nil {
+		s.respondWithError(w, r, err)
+		return false
+	}
+	return true
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goapp_CI/apierror"
+	"goapp_CI/store"
+	"goapp_CI/validate"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postUser(router http.Handler, body, contentType string) (*httptest.ResponseRecorder, apierror.Problem) {
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(body))
+	authorize(req)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	var response apierror.Problem
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder, response
+}
+
+// Test that request bodies are decoded strictly
+func TestDecodeJSONIsStrict(t *testing.T) {
+	s := newServer(store.NewMemoryStore(), testPasswords(), testTokens)
+	s.maxBodyBytes = 256
+	router := s.routes()
+
+	valid := `{"username": "alice", "email": "alice@example.com", "password": "password123"}`
+	recorder, _ := postUser(router, valid, "application/json; charset=utf-8")
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		status      int
+		errors      validate.Errors
+	}{
+		{"form content type", "username=bob", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType, nil},
+		{"malformed", `{"username": "bob"`, "application/json", http.StatusBadRequest, nil},
+		{"trailing data", valid + ` {"username": "eve"}`, "application/json", http.StatusBadRequest, nil},
+		{"trailing garbage", valid + ` x`, "application/json", http.StatusBadRequest, nil},
+		{"too large", `{"username": "` + strings.Repeat("a", 300) + `"}`, "application/json", http.StatusRequestEntityTooLarge, nil},
+		{"unknown field", `{"username": "bob", "role": "admin"}`, "application/json", http.StatusBadRequest,
+			validate.Errors{{Field: "role", Code: validate.CodeUnknown, Message: "is not a known field"}}},
+		{"wrong type", `{"username": 5}`, "application/json", http.StatusBadRequest,
+			validate.Errors{{Field: "username", Code: validate.CodeInvalidType, Message: "must be a string"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder, response := postUser(router, test.body, test.contentType)
+			assert.Equal(t, test.status, recorder.Code)
+			assert.Equal(t, test.status, response.Status)
+			assert.Equal(t, test.errors, response.Errors)
+		})
+	}
+}
+
+// Test that every invalid field is reported together
+func TestCreateUserReportsAllFieldErrors(t *testing.T) {
+	s := newServer(store.NewMemoryStore(), testPasswords(), testTokens)
+	s.validator.Password = validate.PasswordPolicy{MinLength: 10, MinClasses: 3}
+	router := s.routes()
+
+	body := `{"username": "bob smith", "email": "bob@", "password": "password123"}`
+	recorder, response := postUser(router, body, "application/json")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	codes := map[string]string{}
+	for _, e := range response.Errors {
+		codes[e.Field] = e.Code
+	}
+	assert.Equal(t, map[string]string{
+		"username": validate.CodeInvalidChars,
+		"email":    validate.CodeInvalidEmail,
+		"password": validate.CodeWeakPassword,
+	}, codes)
+
+	body = `{"username": "` + strings.Repeat("b", 51) + `", "email": "bob@example.com", "password": "Password123"}`
+	recorder, response = postUser(router, body, "application/json")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, validate.FieldError{Field: "username", Code: validate.CodeTooLong, Message: "must be at most 50 characters"}, response.Errors[0])
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"goapp_CI/auth"
+	"goapp_CI/authz"
+	"goapp_CI/conff"
+	"goapp_CI/tlsconfig"
+)
+
+// configureTLS makes srv serve HTTPS when cfg has a certificate. The
+// certificate and client CA files are reloaded when they change until ctx
+// is done. With client authentication enabled, s accepts verified client
+// certificates as credentials.
+func configureTLS(ctx context.Context, cfg *conff.Config, srv *http.Server, s *server) error {
+	if cfg.TLSCertFile == "" {
+		return nil
+	}
+	r, err := tlsconfig.New(tlsconfig.Options{
+		CertFile:     cfg.TLSCertFile,
+		KeyFile:      cfg.TLSKeyFile,
+		ClientCAFile: cfg.TLSClientCAFile,
+		ClientAuth:   cfg.TLSClientAuth,
+		MinVersion:   cfg.TLSMinVersion,
+		CipherSuites: cfg.TLSCipherSuites,
+	})
+	if err != nil {
+		return err
+	}
+	srv.TLSConfig = r.Config()
+
+	if cfg.ConfigWatchInterval > 0 {
+		go conff.Watch(ctx, r.Files, cfg.ConfigWatchInterval, func() {
+			if err := r.Reload(); err != nil {
+				slog.Error("reloading TLS certificate", "error", err)
+				return
+			}
+			slog.Info("reloaded TLS certificate")
+		})
+	}
+
+	if cfg.TLSClientAuth == "none" {
+		return nil
+	}
+	for _, scope := range cfg.TLSClientScopes {
+		if !authz.ValidScope(scope) {
+			return fmt.Errorf("unknown scope %q in TLS_CLIENT_SCOPES", scope)
+		}
+	}
+	s.clientCerts = auth.NewClientCertAuthenticator(cfg.TLSClientNames, cfg.TLSClientScopes)
+	return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+
+	"goapp_CI/conff"
+	"goapp_CI/tracing"
+)
+
+// setupTracing installs the tracer provider configured in cfg. The returned
+// function flushes the spans still buffered.
+func setupTracing(ctx context.Context, cfg *conff.Config) (func(context.Context) error, error) {
+	return tracing.Setup(ctx, tracing.Options{
+		Exporter:    cfg.TracingExporter,
+		Protocol:    cfg.TracingProtocol,
+		Endpoint:    cfg.TracingEndpoint,
+		ServiceName: cfg.TracingServiceName,
+		Version:     version,
+		Environment: cfg.AppEnv,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+}
@@ -0,0 +1,197 @@
+package conff
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// awsClient calls AWS JSON 1.1 APIs such as SSM and Secrets Manager
+type awsClient struct {
+	region   string
+	endpoint string
+	creds    awsCredentials
+	client   *http.Client
+	now      func() time.Time
+}
+
+// newAWSClient returns a client for the AWS settings in c
+func newAWSClient(c *Config) (*awsClient, error) {
+	if c.AWSAccessKeyID == "" || c.AWSSecretAccessKey == "" {
+		return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+	}
+	return &awsClient{
+		region:   c.AWSRegion,
+		endpoint: c.AWSEndpoint,
+		creds: awsCredentials{
+			AccessKeyID:     c.AWSAccessKeyID,
+			SecretAccessKey: c.AWSSecretAccessKey,
+			SessionToken:    c.AWSSessionToken,
+		},
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}, nil
+}
+
+// awsError is the error body of AWS JSON APIs
+type awsError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+	// Some services capitalise the field
+	MessageUpper string `json:"Message"`
+}
+
+// call invokes target, e.g. AmazonSSM.GetParameter, of service
+func (c *awsClient) call(ctx context.Context, service, target string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	// AWS_ENDPOINT replaces the regional endpoint of every service, as
+	// LocalStack serves them all from one address
+	endpoint := c.endpoint
+	if endpoint == "" {
+		endpoint = "https://" + service + "." + c.region + ".amazonaws.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	signV4(req, body, service, c.region, c.creds, c.now())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var ae awsError
+		json.NewDecoder(resp.Body).Decode(&ae)
+		// __type may be qualified, e.g. com.amazonaws.ssm#ParameterNotFound
+		kind := ae.Type[strings.LastIndex(ae.Type, "#")+1:]
+		if kind == "ParameterNotFound" || kind == "ResourceNotFoundException" {
+			return ErrSecretNotFound
+		}
+		msg := ae.Message
+		if msg == "" {
+			msg = ae.MessageUpper
+		}
+		return fmt.Errorf("%s %s: %s %s: %s", service, target, resp.Status, kind, msg)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ssmProvider reads SSM Parameter Store parameters, decrypting SecureStrings.
+// A parameter has a single value, so references need no key, e.g.
+// ssm:///prod/go-mysql-api/database/password.
+type ssmProvider struct {
+	aws *awsClient
+}
+
+func newSSMProvider(ctx context.Context, c *Config) (SecretProvider, error) {
+	client, err := newAWSClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return cached(ssmProvider{aws: client}, "ssm/"+c.AWSRegion+c.AWSEndpoint, c.AWSSecretsCacheTTL), nil
+}
+
+func (p ssmProvider) Secret(ctx context.Context, name string) (map[string]string, error) {
+	var resp struct {
+		Parameter struct {
+			Value string `json:"Value"`
+		} `json:"Parameter"`
+	}
+	in := map[string]any{"Name": name, "WithDecryption": true}
+	if err := p.aws.call(ctx, "ssm", "AmazonSSM.GetParameter", in, &resp); err != nil {
+		return nil, err
+	}
+	return map[string]string{"value": resp.Parameter.Value}, nil
+}
+
+// secretsManagerProvider reads Secrets Manager secrets. Secrets holding a
+// JSON object are split into its keys, e.g.
+// secretsmanager://prod/go-mysql-api/database#password; any other secret
+// is returned as a single value.
+type secretsManagerProvider struct {
+	aws *awsClient
+}
+
+func newSecretsManagerProvider(ctx context.Context, c *Config) (SecretProvider, error) {
+	client, err := newAWSClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return cached(secretsManagerProvider{aws: client}, "secretsmanager/"+c.AWSRegion+c.AWSEndpoint, c.AWSSecretsCacheTTL), nil
+}
+
+func (p secretsManagerProvider) Secret(ctx context.Context, id string) (map[string]string, error) {
+	var resp struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := p.aws.call(ctx, "secretsmanager", "secretsmanager.GetSecretValue", map[string]string{"SecretId": id}, &resp); err != nil {
+		return nil, err
+	}
+
+	var object map[string]any
+	if err := json.Unmarshal([]byte(resp.SecretString), &object); err == nil {
+		return stringMap(object), nil
+	}
+	return map[string]string{"value": resp.SecretString}, nil
+}
+
+// secretCache keeps secrets read from AWS across loads of the
+// configuration, so that reloads do not call the APIs for every setting
+var secretCache = struct {
+	sync.Mutex
+	entries map[string]cacheEntry
+}{entries: make(map[string]cacheEntry)}
+
+type cacheEntry struct {
+	data    map[string]string
+	expires time.Time
+}
+
+// cachedProvider serves secrets of p from secretCache for ttl
+type cachedProvider struct {
+	p      SecretProvider
+	prefix string
+	ttl    time.Duration
+}
+
+// cached wraps p in secretCache; a ttl of zero disables caching
+func cached(p SecretProvider, prefix string, ttl time.Duration) SecretProvider {
+	if ttl <= 0 {
+		return p
+	}
+	return cachedProvider{p: p, prefix: prefix, ttl: ttl}
+}
+
+func (c cachedProvider) Secret(ctx context.Context, path string) (map[string]string, error) {
+	key := c.prefix + "|" + path
+	secretCache.Lock()
+	e, ok := secretCache.entries[key]
+	secretCache.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.data, nil
+	}
+
+	data, err := c.p.Secret(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	secretCache.Lock()
+	secretCache.entries[key] = cacheEntry{data: data, expires: time.Now().Add(c.ttl)}
+	secretCache.Unlock()
+	return data, nil
+}
@@ -0,0 +1,201 @@
+package conff
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAWS serves SSM GetParameter and Secrets Manager GetSecretValue,
+// checking the SigV4 signature of every request
+type fakeAWS struct {
+	*httptest.Server
+	creds      awsCredentials
+	parameters map[string]string
+	secrets    map[string]string
+
+	mu    sync.Mutex
+	calls int
+}
+
+func newFakeAWS(t *testing.T) *fakeAWS {
+	fa := &fakeAWS{
+		creds: awsCredentials{AccessKeyID: "AKIDTEST", SecretAccessKey: "secret-access-key", SessionToken: "session"},
+		parameters: map[string]string{
+			"/dev/go-mysql-api/database/password": "ssm-pass",
+		},
+		secrets: map[string]string{
+			"dev/go-mysql-api/app":   `{"jwt_secret":"` + testSecret + `","api_key":"gma_from_sm"}`,
+			"dev/go-mysql-api/plain": "plain-value",
+		},
+	}
+	fa.Server = httptest.NewServer(http.HandlerFunc(fa.serve))
+	t.Cleanup(fa.Close)
+
+	// Start every test with an empty cache
+	secretCache.Lock()
+	secretCache.entries = make(map[string]cacheEntry)
+	secretCache.Unlock()
+	return fa
+}
+
+func (fa *fakeAWS) serve(w http.ResponseWriter, r *http.Request) {
+	fa.mu.Lock()
+	fa.calls++
+	fa.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	fail := func(status int, kind, msg string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"__type": kind, "message": msg})
+	}
+	if !fa.validSignature(r, body) {
+		fail(http.StatusForbidden, "SignatureDoesNotMatch", "signature mismatch")
+		return
+	}
+
+	switch r.Header.Get("X-Amz-Target") {
+	case "AmazonSSM.GetParameter":
+		var in struct {
+			Name           string
+			WithDecryption bool
+		}
+		json.Unmarshal(body, &in)
+		value, ok := fa.parameters[in.Name]
+		if !ok || !in.WithDecryption {
+			fail(http.StatusBadRequest, "ParameterNotFound", "")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"Parameter": map[string]any{"Name": in.Name, "Value": value, "Type": "SecureString"}})
+	case "secretsmanager.GetSecretValue":
+		var in struct{ SecretId string }
+		json.Unmarshal(body, &in)
+		value, ok := fa.secrets[in.SecretId]
+		if !ok {
+			fail(http.StatusBadRequest, "ResourceNotFoundException", "Secrets Manager can't find the specified secret.")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"Name": in.SecretId, "SecretString": value})
+	default:
+		fail(http.StatusBadRequest, "UnknownOperationException", "")
+	}
+}
+
+// validSignature signs the request again with the known credentials
+func (fa *fakeAWS) validSignature(r *http.Request, body []byte) bool {
+	at, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	_, rest, _ := strings.Cut(auth, "Credential="+fa.creds.AccessKeyID+"/")
+	parts := strings.Split(rest, "/")
+	if len(parts) < 3 {
+		return false
+	}
+	_, signed, _ := strings.Cut(auth, "SignedHeaders=")
+	signed, _, _ = strings.Cut(signed, ",")
+
+	check, _ := http.NewRequest(r.Method, r.URL.String(), bytes.NewReader(body))
+	check.Host = r.Host
+	for _, name := range strings.Split(signed, ";") {
+		if name != "host" && name != "x-amz-date" && name != "x-amz-security-token" {
+			check.Header.Set(name, r.Header.Get(name))
+		}
+	}
+	signV4(check, body, parts[2], parts[1], fa.creds, at)
+	return check.Header.Get("Authorization") == auth
+}
+
+func (fa *fakeAWS) callCount() int {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	return fa.calls
+}
+
+// useFakeAWS points the AWS settings at fa
+func useFakeAWS(t *testing.T, fa *fakeAWS) {
+	t.Setenv("AWS_ENDPOINT", fa.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", fa.creds.AccessKeyID)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", fa.creds.SecretAccessKey)
+	t.Setenv("AWS_SESSION_TOKEN", fa.creds.SessionToken)
+}
+
+func TestLoadResolvesAWSReferences(t *testing.T) {
+	fa := newFakeAWS(t)
+	useFakeAWS(t, fa)
+	t.Setenv("DB_PASSWORD", "ssm:///dev/go-mysql-api/database/password")
+	t.Setenv("JWT_SECRET", "secretsmanager://dev/go-mysql-api/app#jwt_secret")
+	t.Setenv("API_KEY", "secretsmanager://dev/go-mysql-api/plain")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ssm-pass", cfg.DBPassword)
+	assert.Equal(t, testSecret, cfg.JWTSecret)
+	assert.Equal(t, "plain-value", cfg.APIKey)
+	assert.Equal(t, SourceEnv+"+ssm", cfg.Source("DB_PASSWORD"))
+	assert.Equal(t, SourceEnv+"+secretsmanager", cfg.Source("JWT_SECRET"))
+}
+
+func TestAWSSecretsAreCached(t *testing.T) {
+	fa := newFakeAWS(t)
+	useFakeAWS(t, fa)
+	t.Setenv("JWT_SECRET", "secretsmanager://dev/go-mysql-api/app#jwt_secret")
+	t.Setenv("API_KEY", "secretsmanager://dev/go-mysql-api/app#api_key")
+
+	for i := 0; i < 3; i++ {
+		_, err := Load(nil)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, fa.callCount())
+
+	t.Setenv("AWS_SECRETS_CACHE_TTL", "0")
+	for i := 0; i < 2; i++ {
+		_, err := Load(nil)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, fa.callCount())
+}
+
+func TestLoadReportsAWSErrors(t *testing.T) {
+	fa := newFakeAWS(t)
+	useFakeAWS(t, fa)
+	t.Setenv("JWT_SECRET", testSecret)
+
+	t.Run("missing parameter", func(t *testing.T) {
+		t.Setenv("DB_PASSWORD", "ssm:///dev/go-mysql-api/database/missing")
+		_, err := Load(nil)
+		assert.ErrorIs(t, err, ErrSecretNotFound)
+	})
+
+	t.Run("missing secret key", func(t *testing.T) {
+		t.Setenv("DB_PASSWORD", "secretsmanager://dev/go-mysql-api/app#password")
+		_, err := Load(nil)
+		assert.ErrorIs(t, err, ErrSecretNotFound)
+	})
+
+	t.Run("wrong credentials", func(t *testing.T) {
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "wrong")
+		t.Setenv("DB_PASSWORD", "ssm:///dev/go-mysql-api/database/password")
+		_, err := Load(nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "SignatureDoesNotMatch")
+	})
+
+	t.Run("no credentials", func(t *testing.T) {
+		t.Setenv("AWS_ACCESS_KEY_ID", "")
+		t.Setenv("DB_PASSWORD", "ssm:///dev/go-mysql-api/database/password")
+		_, err := Load(nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "AWS_ACCESS_KEY_ID")
+	})
+}
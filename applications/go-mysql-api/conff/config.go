@@ -1,24 +1,537 @@
+// Package conff loads the API configuration.
+//
+// Every setting is resolved from these sources, later ones taking precedence:
+//
+//  1. the built-in default
+//  2. the INI file named by -config or APP_CONFIG_FILE (e.g. the app.conf
+//     rendered by the Helm chart)
+//  3. environment variables; empty variables are ignored
+//  4. command line flags, named after the variable in lower case with
+//     dashes, e.g. -db-host for DB_HOST
+//
+// A string setting may instead hold a reference to a secret kept elsewhere,
+// such as vault://secret/data/go-mysql-api/database#password,
+// ssm:///prod/go-mysql-api/database/password or
+// secretsmanager://prod/go-mysql-api/database#password. References are
+// resolved through the SecretProvider of their scheme once all sources have
+// been applied.
 package conff
 
 import (
-	"log"
-
-	"github.com/caarlos0/env"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	DBUser     string `env:"DB_USER" envDefault:"mock_user"`
-	DBPassword string `env:"DB_PASSWORD" envDefault:"mock_pass"`
-	DBHost     string `env:"DB_HOST" envDefault:"localhost"`
-	DBPort     string `env:"DB_PORT" envDefault:"3306"`
-	DBName     string `env:"DB_NAME" envDefault:"users"`
-	ServerPort string `env:"SERVER_PORT" envDefault:"8080"`
+	// Server and environment. APP_PORT is what the Helm chart sets;
+	// SERVER_PORT is still accepted.
+	ServerPort string `env:"APP_PORT,SERVER_PORT" ini:"app.port" flag:"port" default:"8080"`
+	AppEnv     string `env:"APP_ENV" ini:"app.environment" default:"development"`
+	LogLevel   string `env:"LOG_LEVEL" ini:"app.log_level" default:"info" reload:"true"`
+	LogFormat  string `env:"LOG_FORMAT" ini:"app.log_format" default:"json"`
+
+	// Request bodies larger than MaxRequestBodyBytes are rejected with 413
+	MaxRequestBodyBytes int `env:"MAX_REQUEST_BODY_BYTES" ini:"app.max_request_body_bytes" default:"65536"`
+
+	// Errors are sent as RFC 7807 problem+json, or with ErrorFormat "legacy"
+	// in the {"success": false} envelope; clients can ask for either with
+	// their Accept header
+	ErrorFormat string `env:"ERROR_FORMAT" ini:"app.error_format" default:"problem"`
+
+	// Graceful shutdown. On SIGTERM readiness fails at once; requests keep
+	// being served for ShutdownDelay while load balancers catch up, then
+	// in-flight requests get ShutdownTimeout to finish. Together they should
+	// fit in the pod's terminationGracePeriodSeconds.
+	ShutdownDelay   time.Duration `env:"SHUTDOWN_DELAY" ini:"app.shutdown_delay" default:"5s"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" ini:"app.shutdown_timeout" default:"20s"`
+
+	// TLS. The server speaks HTTPS when TLSCertFile and TLSKeyFile are set;
+	// they are reloaded when they change, like TLSClientCAFile. With
+	// TLSClientAuth "optional" or "require", clients presenting a
+	// certificate signed by a CA in TLSClientCAFile whose common name is in
+	// TLSClientNames (any, when empty) are granted TLSClientScopes.
+	TLSCertFile     string   `env:"TLS_CERT_FILE" ini:"tls.cert_file"`
+	TLSKeyFile      string   `env:"TLS_KEY_FILE" ini:"tls.key_file"`
+	TLSMinVersion   string   `env:"TLS_MIN_VERSION" ini:"tls.min_version" default:"1.2"`
+	TLSCipherSuites []string `env:"TLS_CIPHER_SUITES" ini:"tls.cipher_suites"`
+	TLSClientAuth   string   `env:"TLS_CLIENT_AUTH" ini:"tls.client_auth" default:"none"`
+	TLSClientCAFile string   `env:"TLS_CLIENT_CA_FILE" ini:"tls.client_ca_file"`
+	TLSClientNames  []string `env:"TLS_CLIENT_NAMES" ini:"tls.client_names"`
+	TLSClientScopes []string `env:"TLS_CLIENT_SCOPES" ini:"tls.client_scopes" default:"users:read"`
+
+	// Security headers sent with every response; empty values leave a
+	// header out. Responses under SecurityNoStorePaths carry user data and
+	// are sent with Cache-Control: no-store.
+	SecurityHSTSMaxAge     time.Duration `env:"SECURITY_HSTS_MAX_AGE" ini:"security.hsts_max_age" default:"8760h"`
+	SecurityHSTSSubdomains bool          `env:"SECURITY_HSTS_INCLUDE_SUBDOMAINS" ini:"security.hsts_include_subdomains" default:"false"`
+	SecurityCSP            string        `env:"SECURITY_CSP" ini:"security.content_security_policy" default:"default-src 'none'; frame-ancestors 'none'"`
+	SecurityReferrerPolicy string        `env:"SECURITY_REFERRER_POLICY" ini:"security.referrer_policy" default:"no-referrer"`
+	SecurityFrameOptions   string        `env:"SECURITY_FRAME_OPTIONS" ini:"security.frame_options" default:"DENY"`
+	SecurityNoStorePaths   []string      `env:"SECURITY_NO_STORE_PATHS" ini:"security.no_store_paths" default:"/users,/admin,/auth"`
+
+	// CORS for browser clients such as the admin tool. Empty
+	// CORSAllowedOrigins disables cross-origin access; "*" allows any
+	// origin but cannot be combined with CORSAllowCredentials.
+	CORSAllowedOrigins   []string      `env:"CORS_ALLOWED_ORIGINS" ini:"cors.allowed_origins"`
+	CORSAllowedMethods   []string      `env:"CORS_ALLOWED_METHODS" ini:"cors.allowed_methods" default:"GET,POST,PUT,PATCH,DELETE"`
+	CORSAllowedHeaders   []string      `env:"CORS_ALLOWED_HEADERS" ini:"cors.allowed_headers" default:"Authorization,Content-Type,If-Match,X-API-Key,X-Request-ID"`
+	CORSExposedHeaders   []string      `env:"CORS_EXPOSED_HEADERS" ini:"cors.exposed_headers" default:"ETag,X-Request-ID,RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset,Retry-After"`
+	CORSAllowCredentials bool          `env:"CORS_ALLOW_CREDENTIALS" ini:"cors.allow_credentials" default:"false"`
+	CORSMaxAge           time.Duration `env:"CORS_MAX_AGE" ini:"cors.max_age" default:"10m"`
+
+	// Rate limiting per client and route. Limits are rate/period[:burst],
+	// e.g. 300/m; RateLimitRoutes gives "METHOD /template=limit" routes a
+	// budget of their own, the others share RateLimitDefault. Buckets are
+	// kept in memory, per replica, or in Redis at RateLimitRedisURL.
+	// Anonymous clients behind RateLimitTrustedProxies are identified by
+	// X-Forwarded-For rather than by the proxy's address.
+	RateLimitEnabled        bool          `env:"RATE_LIMIT_ENABLED" ini:"rate_limit.enabled" default:"true" reload:"true"`
+	RateLimitDefault        string        `env:"RATE_LIMIT_DEFAULT" ini:"rate_limit.default" default:"300/m" reload:"true"`
+	RateLimitRoutes         []string      `env:"RATE_LIMIT_ROUTES" ini:"rate_limit.routes" default:"POST /auth/login=10/m,POST /auth/refresh=30/m,POST /users=20/m" reload:"true"`
+	RateLimitTrustedProxies []string      `env:"RATE_LIMIT_TRUSTED_PROXIES" ini:"rate_limit.trusted_proxies" reload:"true"`
+	RateLimitBackend        string        `env:"RATE_LIMIT_BACKEND" ini:"rate_limit.backend" default:"memory"`
+	RateLimitRedisURL       string        `env:"RATE_LIMIT_REDIS_URL" ini:"rate_limit.redis_url" secret:"true"`
+	RateLimitRedisTimeout   time.Duration `env:"RATE_LIMIT_REDIS_TIMEOUT" ini:"rate_limit.redis_timeout" default:"100ms"`
+
+	// Changes to the database settings are applied at runtime by swapping
+	// the connection pool
+	DBUser     string `env:"DB_USER" ini:"database.user" default:"mock_user" reload:"true"`
+	DBPassword string `env:"DB_PASSWORD" ini:"database.password" default:"mock_pass" secret:"true" reload:"true"`
+	DBHost     string `env:"DB_HOST" ini:"database.host" default:"localhost" reload:"true"`
+	DBPort     string `env:"DB_PORT" ini:"database.port" default:"3306" reload:"true"`
+	DBName     string `env:"DB_NAME" ini:"database.name" default:"users" reload:"true"`
+
+	// Dynamic credentials from the Vault database secrets engine mounted at
+	// DBVaultMount. When DBVaultRole is set, DBUser and DBPassword are
+	// ignored and the pool is rotated before each lease expires; a replaced
+	// pool gets DBDrainTimeout to finish its queries.
+	DBVaultRole    string        `env:"DB_VAULT_ROLE" ini:"database.vault_role"`
+	DBVaultMount   string        `env:"DB_VAULT_MOUNT" ini:"database.vault_mount" default:"database"`
+	DBDrainTimeout time.Duration `env:"DB_DRAIN_TIMEOUT" ini:"database.drain_timeout" default:"30s"`
+
+	// Driver settings. DBTLSMode follows MySQL's ssl-mode: disabled,
+	// preferred, required, verify-ca or verify-identity, which also checks
+	// that the certificate was issued to DBTLSServerName (DB_HOST by
+	// default). DBTLSCAFile replaces the system roots, e.g. with the RDS
+	// global bundle. DBParams are system variables set on every connection,
+	// as &-separated name=value pairs like a DSN query, so values may contain
+	// commas, e.g. sql_mode='STRICT_TRANS_TABLES,NO_ZERO_DATE'&time_zone='+00:00'.
+	DBParseTime     bool          `env:"DB_PARSE_TIME" ini:"database.parse_time" default:"true" reload:"true"`
+	DBLocation      string        `env:"DB_LOCATION" ini:"database.location" default:"UTC" reload:"true"`
+	DBCollation     string        `env:"DB_COLLATION" ini:"database.collation" default:"utf8mb4_unicode_ci" reload:"true"`
+	DBDialTimeout   time.Duration `env:"DB_DIAL_TIMEOUT" ini:"database.dial_timeout" default:"5s" reload:"true"`
+	DBReadTimeout   time.Duration `env:"DB_READ_TIMEOUT" ini:"database.read_timeout" default:"30s" reload:"true"`
+	DBWriteTimeout  time.Duration `env:"DB_WRITE_TIMEOUT" ini:"database.write_timeout" default:"30s" reload:"true"`
+	DBTLSMode       string        `env:"DB_TLS_MODE" ini:"database.tls_mode" default:"preferred" reload:"true"`
+	DBTLSCAFile     string        `env:"DB_TLS_CA_FILE" ini:"database.tls_ca_file" reload:"true"`
+	DBTLSServerName string        `env:"DB_TLS_SERVER_NAME" ini:"database.tls_server_name" reload:"true"`
+	DBParams        string        `env:"DB_PARAMS" ini:"database.params" reload:"true"`
+
+	// Connection pool sizing; 0 leaves the limit off
+	DBMaxOpenConns    int           `env:"DB_MAX_OPEN_CONNS" ini:"database.max_open_conns" default:"25" reload:"true"`
+	DBMaxIdleConns    int           `env:"DB_MAX_IDLE_CONNS" ini:"database.max_idle_conns" default:"25" reload:"true"`
+	DBConnMaxLifetime time.Duration `env:"DB_CONN_MAX_LIFETIME" ini:"database.conn_max_lifetime" default:"5m" reload:"true"`
+	DBConnMaxIdleTime time.Duration `env:"DB_CONN_MAX_IDLE_TIME" ini:"database.conn_max_idle_time" default:"1m" reload:"true"`
+
+	// Password hashing; PasswordHasher is "argon2id" or "bcrypt"
+	PasswordHasher        string `env:"PASSWORD_HASHER" ini:"password.hasher" default:"argon2id"`
+	PasswordArgon2Memory  uint   `env:"PASSWORD_ARGON2_MEMORY" ini:"password.argon2_memory" default:"65536"`
+	PasswordArgon2Time    uint   `env:"PASSWORD_ARGON2_TIME" ini:"password.argon2_time" default:"3"`
+	PasswordArgon2Threads uint   `env:"PASSWORD_ARGON2_THREADS" ini:"password.argon2_threads" default:"2"`
+	PasswordBcryptCost    int    `env:"PASSWORD_BCRYPT_COST" ini:"password.bcrypt_cost" default:"10"`
+
+	// Password policy for new passwords. PasswordMinClasses is how many of
+	// lower case, upper case, digits and symbols they must mix.
+	PasswordMinLength  int `env:"PASSWORD_MIN_LENGTH" ini:"password.min_length" default:"8"`
+	PasswordMaxLength  int `env:"PASSWORD_MAX_LENGTH" ini:"password.max_length" default:"128"`
+	PasswordMinClasses int `env:"PASSWORD_MIN_CLASSES" ini:"password.min_classes" default:"1"`
+
+	// JWT authentication. JWTAlgorithm is HS256 (JWTSecret), RS256 or EdDSA
+	// (JWTPrivateKeyFile). Keys retired by a rotation stay valid for
+	// verification through JWTPreviousSecrets or JWTPublicKeyFiles, given as
+	// kid=secret and kid=path lists.
+	JWTAlgorithm       string        `env:"JWT_ALGORITHM" ini:"jwt.algorithm" default:"HS256"`
+	JWTKeyID           string        `env:"JWT_KEY_ID" ini:"jwt.key_id" default:"default"`
+	JWTSecret          string        `env:"JWT_SECRET" ini:"jwt.secret" secret:"true"`
+	JWTPreviousSecrets []string      `env:"JWT_PREVIOUS_SECRETS" ini:"jwt.previous_secrets" secret:"true"`
+	JWTPrivateKeyFile  string        `env:"JWT_PRIVATE_KEY_FILE" ini:"jwt.private_key_file"`
+	JWTPublicKeyFiles  []string      `env:"JWT_PUBLIC_KEY_FILES" ini:"jwt.public_key_files"`
+	JWTIssuer          string        `env:"JWT_ISSUER" ini:"jwt.issuer" default:"go-mysql-api"`
+	JWTAudience        string        `env:"JWT_AUDIENCE" ini:"jwt.audience" default:"go-mysql-api"`
+	JWTAccessTTL       time.Duration `env:"JWT_ACCESS_TTL" ini:"jwt.access_ttl" default:"15m"`
+	JWTRefreshTTL      time.Duration `env:"JWT_REFRESH_TTL" ini:"jwt.refresh_ttl" default:"24h"`
+
+	// A static API key provisioned outside the API (e.g. by load-secrets.sh),
+	// accepted alongside the keys stored in the database
+	APIKey       string   `env:"API_KEY" ini:"api_key.key" secret:"true"`
+	APIKeyScopes []string `env:"API_KEY_SCOPES" ini:"api_key.scopes" default:"users:read"`
+
+	// Health checks; details are only shown to callers in HealthInternalCIDRs,
+	// which is empty by default. Behind a proxy or sidecar every request
+	// arrives from loopback, so loopback must not be listed there.
+	HealthCheckTimeout   time.Duration `env:"HEALTH_CHECK_TIMEOUT" ini:"health.check_timeout" default:"2s"`
+	HealthPoolSaturation float64       `env:"HEALTH_POOL_SATURATION" ini:"health.pool_saturation" default:"0.9"`
+	HealthInternalCIDRs  []string      `env:"HEALTH_INTERNAL_CIDRS" ini:"health.internal_cidrs"`
+
+	// Schema migrations
+	MigrateOnStart     bool          `env:"MIGRATE_ON_START" ini:"migrate.on_start" default:"true"`
+	MigrateLockTimeout time.Duration `env:"MIGRATE_LOCK_TIMEOUT" ini:"migrate.lock_timeout" default:"1m"`
+
+	// Prometheus metrics
+	MetricsEnabled bool   `env:"METRICS_ENABLED" ini:"metrics.enabled" default:"true"`
+	MetricsPath    string `env:"METRICS_PATH" ini:"metrics.path" default:"/metrics"`
+
+	// AWS, used to resolve ssm:// and secretsmanager:// references.
+	// AWSEndpoint replaces the regional endpoints, e.g. for LocalStack.
+	// Secrets are cached for AWSSecretsCacheTTL; zero disables the cache.
+	AWSRegion          string        `env:"AWS_REGION" ini:"aws.region" default:"us-east-1"`
+	AWSEndpoint        string        `env:"AWS_ENDPOINT" ini:"aws.endpoint"`
+	AWSAccessKeyID     string        `env:"AWS_ACCESS_KEY_ID" ini:"aws.access_key_id"`
+	AWSSecretAccessKey string        `env:"AWS_SECRET_ACCESS_KEY" ini:"aws.secret_access_key" secret:"true"`
+	AWSSessionToken    string        `env:"AWS_SESSION_TOKEN" ini:"aws.session_token" secret:"true"`
+	AWSSecretsCacheTTL time.Duration `env:"AWS_SECRETS_CACHE_TTL" ini:"aws.secrets_cache_ttl" default:"5m"`
+
+	// HashiCorp Vault, used to resolve vault:// references. VaultAuthMethod
+	// is "kubernetes", logging in as VaultAuthRole with the service account
+	// token in VaultJWTPath, or "token" (VaultToken).
+	VaultAddr       string        `env:"VAULT_ADDR" ini:"vault.addr"`
+	VaultAuthMethod string        `env:"VAULT_AUTH_METHOD" ini:"vault.auth_method" default:"kubernetes"`
+	VaultAuthRole   string        `env:"VAULT_AUTH_ROLE" ini:"vault.auth_role"`
+	VaultAuthMount  string        `env:"VAULT_AUTH_MOUNT" ini:"vault.auth_mount" default:"kubernetes"`
+	VaultJWTPath    string        `env:"VAULT_JWT_PATH" ini:"vault.jwt_path" default:"/var/run/secrets/kubernetes.io/serviceaccount/token"`
+	VaultToken      string        `env:"VAULT_TOKEN" ini:"vault.token" secret:"true"`
+	VaultSkipVerify bool          `env:"VAULT_SKIP_VERIFY" ini:"vault.skip_verify" default:"false"`
+	VaultTimeout    time.Duration `env:"VAULT_TIMEOUT" ini:"vault.timeout" default:"10s"`
+
+	// OpenTelemetry tracing. TracingExporter is "none", "otlp" or "stdout";
+	// OTLP spans go to TracingEndpoint, e.g. http://otel-collector:4317,
+	// over TracingProtocol, "grpc" or "http/protobuf". New traces are
+	// sampled at TracingSampleRatio; traces continued from a caller follow
+	// the caller's decision.
+	TracingExporter    string  `env:"OTEL_TRACES_EXPORTER" ini:"tracing.exporter" default:"none"`
+	TracingProtocol    string  `env:"OTEL_EXPORTER_OTLP_PROTOCOL" ini:"tracing.protocol" default:"grpc"`
+	TracingEndpoint    string  `env:"OTEL_EXPORTER_OTLP_ENDPOINT" ini:"tracing.endpoint"`
+	TracingServiceName string  `env:"OTEL_SERVICE_NAME" ini:"tracing.service_name" default:"go-mysql-api"`
+	TracingSampleRatio float64 `env:"OTEL_TRACES_SAMPLER_ARG" ini:"tracing.sample_ratio" default:"1"`
+
+	// Files are checked for changes every ConfigWatchInterval; zero only
+	// reloads on SIGHUP
+	ConfigWatchInterval time.Duration `env:"CONFIG_WATCH_INTERVAL" ini:"app.config_watch_interval" default:"10s"`
+
+	// file is the INI file the settings were read from, if any
+	file string
+	// refs holds the secret reference each resolved setting was read from
+	refs map[string]string
+	// sources records where each setting, by env name, was taken from
+	sources map[string]string
+	// resolved marks the settings read from a secret provider
+	resolved map[string]bool
+	// vault is the client that resolved vault:// references, if any
+	vault *Vault
+}
+
+// Sources of a setting, reported by Print
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// ConfigFileEnv names the variable holding the config file path
+const ConfigFileEnv = "APP_CONFIG_FILE"
+
+// field describes one setting of Config
+type field struct {
+	index  int
+	env    []string
+	ini    string
+	flag   string
+	def    string
+	hasDef bool
+	secret bool
+	// reload is set for settings that can change without a restart
+	reload bool
 }
 
+// name is the canonical environment variable of f
+func (f field) name() string { return f.env[0] }
+
+var fields = func() []field {
+	t := reflect.TypeOf(Config{})
+	var fs []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		env := sf.Tag.Get("env")
+		if env == "" {
+			continue
+		}
+		f := field{
+			index:  i,
+			env:    strings.Split(env, ","),
+			ini:    sf.Tag.Get("ini"),
+			flag:   sf.Tag.Get("flag"),
+			secret: sf.Tag.Get("secret") == "true",
+			reload: sf.Tag.Get("reload") == "true",
+		}
+		f.def, f.hasDef = sf.Tag.Lookup("default")
+		if f.flag == "" {
+			f.flag = strings.ReplaceAll(strings.ToLower(f.name()), "_", "-")
+		}
+		fs = append(fs, f)
+	}
+	return fs
+}()
+
+// LoadConfig loads the configuration without command line flags
 func LoadConfig() (*Config, error) {
-	var cfg Config
-	if err := env.Parse(&cfg); err != nil {
-		log.Fatalf("Error parsing configuration, error: %v", err)
+	return Load(nil)
+}
+
+// Load resolves the configuration from defaults, the config file, the
+// environment and args, then validates it. All problems are reported
+// together. On error the returned Config holds every value that could be
+// resolved, so that it can still be inspected.
+func Load(args []string) (*Config, error) {
+	return load(args, nil, false)
+}
+
+// Reload loads the configuration again like Load, on top of current.
+// vault:// references use current's Vault client, so a reload never logs in
+// to Vault again. With refresh, remote secret references are read again so
+// that rotated values are picked up; one that cannot be read keeps the value
+// current resolved. Without refresh, as when only files changed, unchanged
+// references keep their value without asking the backends.
+func Reload(args []string, current *Config, refresh bool) (*Config, error) {
+	return load(args, current, refresh)
+}
+
+func load(args []string, prev *Config, refresh bool) (*Config, error) {
+	cfg := &Config{sources: make(map[string]string), resolved: make(map[string]bool), refs: make(map[string]string)}
+	v := reflect.ValueOf(cfg).Elem()
+	var errs []error
+
+	set := func(f field, source, raw string) {
+		if err := setValue(v.Field(f.index), raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value %q from %s: %v", f.name(), raw, source, err))
+			return
+		}
+		cfg.sources[f.name()] = source
+	}
+
+	// Flags are parsed first because they may name the config file
+	flags, configFile, err := parseFlags(args)
+	if err != nil {
+		return cfg, err
+	}
+	if configFile == "" {
+		configFile = os.Getenv(ConfigFileEnv)
+	}
+
+	for _, f := range fields {
+		if f.hasDef {
+			set(f, SourceDefault, f.def)
+		}
+	}
+
+	if configFile != "" {
+		cfg.file = configFile
+		file, err := readINIFile(configFile)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		known := make(map[string]bool)
+		for _, f := range fields {
+			known[f.ini] = true
+			if e, ok := file[f.ini]; ok && e.value != "" {
+				set(f, SourceFile, e.value)
+			}
+		}
+		for key, e := range file {
+			if !known[key] {
+				errs = append(errs, fmt.Errorf("%s:%d: unknown setting %q", configFile, e.line, key))
+			}
+		}
+	}
+
+	for _, f := range fields {
+		for _, name := range f.env {
+			if raw := os.Getenv(name); raw != "" {
+				set(f, SourceEnv, raw)
+				break
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if raw, ok := flags[f.flag]; ok {
+			set(f, SourceFlag, raw)
+		}
+	}
+
+	if prev != nil {
+		cfg.vault = prev.vault
+	}
+	if len(errs) == 0 {
+		errs = cfg.resolveSecrets(context.Background(), prev, refresh)
+	}
+	if len(errs) == 0 && cfg.DBVaultRole != "" && cfg.vault == nil {
+		if _, err := newVaultProvider(context.Background(), cfg); err != nil {
+			errs = append(errs, fmt.Errorf("DB_VAULT_ROLE: vault: %w", err))
+		}
+	}
+	if len(errs) == 0 {
+		errs = cfg.validate()
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// Vault returns the client that resolved vault:// references or issues
+// database credentials, or nil when Vault is not used. Its token must be
+// kept alive with Run.
+func (c *Config) Vault() *Vault {
+	return c.vault
+}
+
+// RawValue returns the value of the setting named by its environment
+// variable as Load finds it in the environment or else in the config file
+// named by APP_CONFIG_FILE, without defaults, flags or resolving secret
+// references. It lets probes read a setting without reaching Vault or AWS.
+// ok is false when neither sets it.
+func RawValue(name string) (value string, ok bool, err error) {
+	var f *field
+	for i := range fields {
+		if fields[i].name() == name {
+			f = &fields[i]
+		}
+	}
+	if f == nil {
+		return "", false, fmt.Errorf("unknown setting %q", name)
+	}
+	for _, env := range f.env {
+		if raw := os.Getenv(env); raw != "" {
+			return raw, true, nil
+		}
+	}
+	path := os.Getenv(ConfigFileEnv)
+	if path == "" {
+		return "", false, nil
+	}
+	file, err := readINIFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	e, ok := file[f.ini]
+	return e.value, ok && e.value != "", nil
+}
+
+// DBParamMap splits DBParams into system variable names and values. Values
+// are passed through verbatim, quotes included.
+func (c *Config) DBParamMap() (map[string]string, error) {
+	if c.DBParams == "" {
+		return nil, nil
+	}
+	params := make(map[string]string)
+	for _, param := range strings.Split(c.DBParams, "&") {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("entries must be name=value separated by &, got %q", param)
+		}
+		params[name] = value
+	}
+	return params, nil
+}
+
+// parseFlags returns the raw value of every flag in args and the -config path
+func parseFlags(args []string) (map[string]string, string, error) {
+	fs := flag.NewFlagSet("go-mysql-api", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var configFile string
+	fs.StringVar(&configFile, "config", "", "path of an INI config file")
+
+	values := make(map[string]string)
+	t := reflect.TypeOf(Config{})
+	for _, f := range fields {
+		name := f.flag
+		store := func(s string) error { values[name] = s; return nil }
+		if t.Field(f.index).Type.Kind() == reflect.Bool {
+			fs.BoolFunc(name, f.name(), func(s string) error {
+				if _, err := strconv.ParseBool(s); err != nil {
+					return err
+				}
+				return store(s)
+			})
+		} else {
+			fs.Func(name, f.name(), store)
+		}
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+	if fs.NArg() > 0 {
+		return nil, "", fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return values, configFile, nil
+}
+
+// setValue parses raw into the setting v
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint:
+		n, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
 	}
-	return &cfg, nil
+	return nil
 }
@@ -0,0 +1,206 @@
+package conff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// writeConfig writes an INI file and points APP_CONFIG_FILE at it
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "app.conf")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	t.Setenv(ConfigFileEnv, path)
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "8080", cfg.ServerPort)
+	assert.Equal(t, "info", cfg.LogLevel)
+	assert.Equal(t, 15*time.Minute, cfg.JWTAccessTTL)
+	assert.True(t, cfg.MetricsEnabled)
+	assert.Equal(t, []string{"users:read"}, cfg.APIKeyScopes)
+	assert.Empty(t, cfg.HealthInternalCIDRs)
+	assert.Equal(t, SourceDefault, cfg.Source("DB_HOST"))
+	assert.Equal(t, SourceEnv, cfg.Source("JWT_SECRET"))
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	writeConfig(t, `
+# rendered by the Helm chart
+[app]
+port = 8088
+log_level = warn
+environment = "staging"
+
+[database]
+host = db.internal
+port = 3307
+name = mock_user
+user = db_user
+
+[aws]
+region = eu-west-1
+endpoint =
+`)
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("DB_HOST", "db.env")
+	t.Setenv("DB_NAME", "")
+	t.Setenv("APP_PORT", "9000")
+	t.Setenv("SERVER_PORT", "9001")
+
+	cfg, err := Load([]string{"-db-host", "db.flag", "-metrics-enabled=false"})
+	require.NoError(t, err)
+
+	// file over default
+	assert.Equal(t, "warn", cfg.LogLevel)
+	assert.Equal(t, "staging", cfg.AppEnv)
+	assert.Equal(t, "3307", cfg.DBPort)
+	assert.Equal(t, "eu-west-1", cfg.AWSRegion)
+	assert.Equal(t, SourceFile, cfg.Source("DB_PORT"))
+	// empty env does not hide the file value
+	assert.Equal(t, "mock_user", cfg.DBName)
+	// env over file; APP_PORT wins over SERVER_PORT
+	assert.Equal(t, "9000", cfg.ServerPort)
+	assert.Equal(t, SourceEnv, cfg.Source("APP_PORT"))
+	// flags over env
+	assert.Equal(t, "db.flag", cfg.DBHost)
+	assert.False(t, cfg.MetricsEnabled)
+	assert.Equal(t, SourceFlag, cfg.Source("DB_HOST"))
+}
+
+func TestLoadConfigFlag(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	path := filepath.Join(t.TempDir(), "app.conf")
+	require.NoError(t, os.WriteFile(path, []byte("[app]\nport = 7000\n"), 0o600))
+
+	cfg, err := Load([]string{"--config", path})
+	require.NoError(t, err)
+	assert.Equal(t, "7000", cfg.ServerPort)
+}
+
+func TestLoadReportsAllErrors(t *testing.T) {
+	path := writeConfig(t, "[app]\nport = 8088\nverbose = true\n")
+	t.Setenv("JWT_SECRET", "short")
+	t.Setenv("DB_PORT", "mysql")
+	t.Setenv("LOG_LEVEL", "chatty")
+	t.Setenv("JWT_ACCESS_TTL", "forever")
+
+	_, err := Load(nil)
+	require.Error(t, err)
+	for _, want := range []string{
+		path + ":3: unknown setting \"app.verbose\"",
+		"JWT_ACCESS_TTL: invalid value \"forever\" from env",
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+
+	// Validation runs once the values themselves parse
+	os.Unsetenv(ConfigFileEnv)
+	t.Setenv("JWT_ACCESS_TTL", "15m")
+	cfg, err := Load(nil)
+	require.Error(t, err)
+	require.NotNil(t, cfg)
+	for _, want := range []string{"DB_PORT", "LOG_LEVEL", "JWT_SECRET"} {
+		assert.Contains(t, err.Error(), want)
+	}
+	assert.Len(t, strings.Split(err.Error(), "\n"), 3)
+}
+
+func TestLoadValidatesDatabaseDriverSettings(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("DB_TLS_MODE", "required")
+	t.Setenv("DB_TLS_CA_FILE", "/etc/ssl/rds/global-bundle.pem")
+	t.Setenv("DB_LOCATION", "Mars/Olympus_Mons")
+	t.Setenv("DB_PARAMS", "sql_mode")
+	t.Setenv("DB_MAX_OPEN_CONNS", "-1")
+
+	_, err := Load(nil)
+	require.Error(t, err)
+	for _, want := range []string{"DB_TLS_CA_FILE", "DB_LOCATION", "DB_PARAMS", "DB_MAX_OPEN_CONNS"} {
+		assert.Contains(t, err.Error(), want)
+	}
+
+	t.Setenv("DB_TLS_MODE", "verify-identity")
+	t.Setenv("DB_LOCATION", "Europe/Berlin")
+	t.Setenv("DB_PARAMS", "sql_mode='STRICT_TRANS_TABLES,NO_ZERO_DATE'&time_zone='+00:00'")
+	t.Setenv("DB_MAX_OPEN_CONNS", "50")
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	params, err := cfg.DBParamMap()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"sql_mode": "'STRICT_TRANS_TABLES,NO_ZERO_DATE'", "time_zone": "'+00:00'"}, params)
+	assert.True(t, cfg.DBParseTime)
+	assert.Equal(t, 5*time.Minute, cfg.DBConnMaxLifetime)
+}
+
+// Test that argon2id settings stay within what password.Argon2id can verify
+func TestLoadValidatesArgon2Limits(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("PASSWORD_ARGON2_TIME", "20")
+	t.Setenv("PASSWORD_ARGON2_THREADS", "255")
+	t.Setenv("PASSWORD_ARGON2_MEMORY", "2097152")
+
+	_, err := Load(nil)
+	require.Error(t, err)
+	for _, want := range []string{"PASSWORD_ARGON2_TIME", "PASSWORD_ARGON2_THREADS", "PASSWORD_ARGON2_MEMORY"} {
+		assert.Contains(t, err.Error(), want)
+	}
+
+	t.Setenv("PASSWORD_ARGON2_TIME", "16")
+	t.Setenv("PASSWORD_ARGON2_THREADS", "64")
+	t.Setenv("PASSWORD_ARGON2_MEMORY", "1048576")
+	_, err = Load(nil)
+	assert.NoError(t, err)
+}
+
+func TestLoadRejectsUnknownFlags(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	_, err := Load([]string{"-no-such-flag"})
+	assert.Error(t, err)
+	_, err = Load([]string{"stray"})
+	assert.Error(t, err)
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("DB_PASSWORD", "hunter2-hunter2")
+	t.Setenv("JWT_PREVIOUS_SECRETS", "old=fedcba9876543210fedcba9876543210")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, cfg.Print(&out))
+	assert.NotContains(t, out.String(), testSecret)
+	assert.NotContains(t, out.String(), "hunter2")
+	assert.NotContains(t, out.String(), "fedcba")
+	assert.Regexp(t, `DB_PASSWORD\s+\[REDACTED\]\s+env`, out.String())
+	assert.Regexp(t, `DB_HOST\s+localhost\s+default`, out.String())
+	assert.Regexp(t, `API_KEY\s+unset`, out.String())
+}
+
+func TestParseINI(t *testing.T) {
+	entries, err := parseINI(strings.NewReader("top = 1\n; comment\n[a]\nb = 'quoted value'\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "1", entries["top"].value)
+	assert.Equal(t, "quoted value", entries["a.b"].value)
+	assert.Equal(t, 4, entries["a.b"].line)
+
+	_, err = parseINI(strings.NewReader("[a\n"))
+	assert.Error(t, err)
+	_, err = parseINI(strings.NewReader("[a]\njust a line\n"))
+	assert.Error(t, err)
+}
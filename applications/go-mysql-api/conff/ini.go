@@ -0,0 +1,67 @@
+package conff
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// iniEntry is a value read from a config file and the line it was on
+type iniEntry struct {
+	value string
+	line  int
+}
+
+func readINIFile(path string) (map[string]iniEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	defer f.Close()
+
+	entries, err := parseINI(f)
+	if err != nil {
+		return entries, fmt.Errorf("%s:%w", path, err)
+	}
+	return entries, nil
+}
+
+// parseINI reads "key = value" lines grouped by "[section]" headers into a
+// map keyed by "section.key". Lines starting with # or ; are comments and
+// values may be quoted.
+func parseINI(r io.Reader) (map[string]iniEntry, error) {
+	entries := make(map[string]iniEntry)
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return entries, fmt.Errorf("%d: malformed section header", n)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return entries, fmt.Errorf("%d: expected key = value", n)
+		}
+		key = strings.TrimSpace(key)
+		if section != "" {
+			key = section + "." + key
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		entries[key] = iniEntry{value: value, line: n}
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,45 @@
+package conff
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+)
+
+// Redacted replaces the value of secret settings in Print
+const Redacted = "[REDACTED]"
+
+// Print writes every setting with its value and source. Secrets, and values
+// read from a secret provider, are replaced by Redacted.
+func (c *Config) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+
+	v := reflect.ValueOf(c).Elem()
+	for _, f := range fields {
+		value := formatValue(v.Field(f.index))
+		if (f.secret || c.resolved[f.name()]) && value != "" {
+			value = Redacted
+		}
+		source := c.sources[f.name()]
+		if source == "" {
+			source = "unset"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.name(), value, source)
+	}
+	return tw.Flush()
+}
+
+// Source reports where the setting with the given env name came from
+func (c *Config) Source(name string) string {
+	return c.sources[name]
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Kind() == reflect.Slice {
+		return strings.Join(v.Interface().([]string), ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
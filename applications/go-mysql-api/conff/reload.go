@@ -0,0 +1,108 @@
+package conff
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Reloadable reports whether the setting with the given env name can be
+// applied without a restart
+func Reloadable(name string) bool {
+	for _, f := range fields {
+		if f.name() == name {
+			return f.reload
+		}
+	}
+	return false
+}
+
+// Changed returns the env names of the settings whose values differ
+// between c and other
+func (c *Config) Changed(other *Config) []string {
+	a, b := reflect.ValueOf(c).Elem(), reflect.ValueOf(other).Elem()
+	var names []string
+	for _, f := range fields {
+		if !reflect.DeepEqual(a.Field(f.index).Interface(), b.Field(f.index).Interface()) {
+			names = append(names, f.name())
+		}
+	}
+	return names
+}
+
+// Files returns the files the configuration was read from: the INI file and
+// the files named by file:// references
+func (c *Config) Files() []string {
+	var files []string
+	if c.file != "" {
+		files = append(files, c.file)
+	}
+	for _, ref := range c.refs {
+		if path, ok := strings.CutPrefix(ref, "file://"); ok {
+			path, _, _ = strings.Cut(path, "#")
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Watch calls onChange when the content of one of the files returned by
+// files changes, checking every interval until ctx is done. Files are
+// compared by content rather than modification time, so that atomic
+// replacements are noticed too, including the symlink swap Kubernetes uses
+// to update ConfigMap and Secret volumes.
+func Watch(ctx context.Context, files func() []string, interval time.Duration, onChange func()) {
+	sums := checksums(files())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := checksums(files())
+		if !sameChecksums(sums, current) {
+			onChange()
+			// The file list may have changed with the configuration
+			current = checksums(files())
+		}
+		sums = current
+	}
+}
+
+// checksums hashes every file, following symlinks; missing files hash to nil
+func checksums(files []string) map[string][]byte {
+	sums := make(map[string][]byte, len(files))
+	for _, path := range files {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			sums[path] = nil
+			continue
+		}
+		sum := sha256.Sum256(b)
+		sums[path] = sum[:]
+	}
+	return sums
+}
+
+func sameChecksums(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, sum := range a {
+		other, ok := b[path]
+		if !ok || !bytes.Equal(sum, other) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package conff
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedAndReloadable(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	a, err := Load(nil)
+	require.NoError(t, err)
+
+	t.Setenv("DB_PASSWORD", "rotated")
+	t.Setenv("JWT_ISSUER", "other")
+	b, err := Load(nil)
+	require.NoError(t, err)
+
+	assert.Empty(t, a.Changed(a))
+	assert.Equal(t, []string{"DB_PASSWORD", "JWT_ISSUER"}, a.Changed(b))
+	assert.True(t, Reloadable("DB_PASSWORD"))
+	assert.False(t, Reloadable("JWT_ISSUER"))
+	assert.False(t, Reloadable("NO_SUCH_SETTING"))
+}
+
+func TestFileReferences(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "db-password")
+	require.NoError(t, os.WriteFile(secret, []byte("from-file\n"), 0o600))
+	conf := writeConfig(t, "[database]\npassword = file://"+secret+"\n")
+	t.Setenv("JWT_SECRET", testSecret)
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", cfg.DBPassword)
+	assert.Equal(t, SourceFile+"+file", cfg.Source("DB_PASSWORD"))
+	assert.ElementsMatch(t, []string{conf, secret}, cfg.Files())
+
+	require.NoError(t, os.Remove(secret))
+	_, err = Load(nil)
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+}
+
+// TestWatchNoticesSymlinkSwap updates a file the way Kubernetes updates
+// ConfigMap volumes: app.conf -> ..data/app.conf, ..data -> a versioned
+// directory that is replaced by renaming a new symlink over ..data
+func TestWatchNoticesSymlinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	version := func(name, content string) {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, name), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name, "app.conf"), []byte(content), 0o644))
+		require.NoError(t, os.Symlink(name, filepath.Join(dir, "..data_tmp")))
+		require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	}
+	version("..v1", "[app]\nlog_level = info\n")
+	path := filepath.Join(dir, "app.conf")
+	require.NoError(t, os.Symlink("..data/app.conf", path))
+
+	var changes atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Watch(ctx, func() []string { return []string{path} }, 5*time.Millisecond, func() { changes.Add(1) })
+		close(done)
+	}()
+	defer func() { cancel(); <-done }()
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Zero(t, changes.Load())
+
+	version("..v2", "[app]\nlog_level = debug\n")
+	assert.Eventually(t, func() bool { return changes.Load() == 1 }, time.Second, time.Millisecond)
+
+	// Rewriting the same content is not a change
+	version("..v3", "[app]\nlog_level = debug\n")
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(1), changes.Load())
+}
@@ -0,0 +1,159 @@
+package conff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// ErrSecretNotFound is returned by a SecretProvider when a path or key does
+// not exist
+var ErrSecretNotFound = errors.New("conff: secret not found")
+
+// SecretProvider reads secrets kept outside the configuration
+type SecretProvider interface {
+	// Secret returns the key/value pairs stored at path
+	Secret(ctx context.Context, path string) (map[string]string, error)
+}
+
+// secretRef is a setting value of the form <scheme>://<path>#<key>
+type secretRef struct {
+	scheme, path, key string
+}
+
+// parseSecretRef recognises references for the schemes in providers
+func parseSecretRef(value string, providers map[string]providerFactory) (secretRef, bool) {
+	scheme, rest, ok := strings.Cut(value, "://")
+	if !ok || providers[scheme] == nil {
+		return secretRef{}, false
+	}
+	path, key, _ := strings.Cut(rest, "#")
+	return secretRef{scheme: scheme, path: path, key: key}, true
+}
+
+// providerFactory builds the provider for a scheme from the settings
+// resolved so far
+type providerFactory func(ctx context.Context, c *Config) (SecretProvider, error)
+
+// secretProviders maps reference schemes to their providers
+var secretProviders = map[string]providerFactory{
+	"vault":          newVaultProvider,
+	"ssm":            newSSMProvider,
+	"secretsmanager": newSecretsManagerProvider,
+	"file":           newFileProvider,
+}
+
+// resolveSecrets replaces every string setting holding a secret reference
+// with the referenced value. Providers are only created when a reference
+// needs them. Remote references unchanged since prev, if not nil, take the
+// value prev resolved: without reading them again unless refresh is set,
+// and otherwise when their backend fails. file:// references are always
+// read, since reloads are triggered by their content changing.
+func (c *Config) resolveSecrets(ctx context.Context, prev *Config, refresh bool) []error {
+	var errs []error
+	providers := make(map[string]SecretProvider)
+	cache := make(map[secretRef]map[string]string)
+
+	v := reflect.ValueOf(c).Elem()
+	for _, f := range fields {
+		fv := v.Field(f.index)
+		if fv.Kind() != reflect.String {
+			continue
+		}
+		ref, ok := parseSecretRef(fv.String(), secretProviders)
+		if !ok {
+			continue
+		}
+
+		unchanged := prev != nil && ref.scheme != "file" && prev.resolved[f.name()] && prev.refs[f.name()] == fv.String()
+		keep := func(err error) {
+			if err != nil {
+				slog.Warn("conff: reading secret failed, keeping the current value", "setting", f.name(), "error", err)
+			}
+			c.refs[f.name()] = fv.String()
+			fv.SetString(reflect.ValueOf(prev).Elem().Field(f.index).String())
+			c.sources[f.name()] += "+" + ref.scheme
+			c.resolved[f.name()] = true
+		}
+		if unchanged && !refresh {
+			keep(nil)
+			continue
+		}
+
+		p, ok := providers[ref.scheme]
+		if !ok && ref.scheme == "vault" && c.vault != nil {
+			p, ok = c.vault, true
+			providers[ref.scheme] = p
+		}
+		if !ok {
+			var err error
+			p, err = secretProviders[ref.scheme](ctx, c)
+			if err != nil && unchanged {
+				keep(err)
+				continue
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s secrets: %w", f.name(), ref.scheme, err))
+				continue
+			}
+			providers[ref.scheme] = p
+		}
+
+		pathKey := secretRef{scheme: ref.scheme, path: ref.path}
+		data, ok := cache[pathKey]
+		if !ok {
+			var err error
+			data, err = p.Secret(ctx, ref.path)
+			if err != nil && unchanged && !errors.Is(err, ErrSecretNotFound) {
+				keep(err)
+				continue
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: reading %s://%s: %w", f.name(), ref.scheme, ref.path, err))
+				continue
+			}
+			cache[pathKey] = data
+		}
+
+		value, ok := data[ref.key]
+		if ref.key == "" && len(data) == 1 {
+			for _, only := range data {
+				value, ok = only, true
+			}
+		}
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: reading %s://%s: key %q: %w", f.name(), ref.scheme, ref.path, ref.key, ErrSecretNotFound))
+			continue
+		}
+		c.refs[f.name()] = fv.String()
+		fv.SetString(value)
+		c.sources[f.name()] += "+" + ref.scheme
+		c.resolved[f.name()] = true
+	}
+	return errs
+}
+
+// fileProvider reads secrets mounted as files, e.g. from a Kubernetes Secret
+// volume: file:///etc/secrets/db-password. The file content, without
+// surrounding whitespace, is the only value.
+type fileProvider struct{}
+
+func newFileProvider(ctx context.Context, c *Config) (SecretProvider, error) {
+	return fileProvider{}, nil
+}
+
+func (fileProvider) Secret(ctx context.Context, path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrSecretNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"value": strings.TrimSpace(string(b))}, nil
+}
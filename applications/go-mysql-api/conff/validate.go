@@ -0,0 +1,152 @@
+package conff
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"goapp_CI/password"
+)
+
+// validate returns every problem with the resolved settings
+func (c *Config) validate() []error {
+	var errs []error
+	check := func(ok bool, name, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{name}, args...)...))
+		}
+	}
+
+	check(validPort(c.ServerPort), "APP_PORT", "must be a port number, got %q", c.ServerPort)
+	check(oneOf(strings.ToLower(c.LogLevel), "debug", "info", "warn", "error"), "LOG_LEVEL", "must be debug, info, warn or error, got %q", c.LogLevel)
+	check(oneOf(c.LogFormat, "json", "text"), "LOG_FORMAT", "must be json or text, got %q", c.LogFormat)
+	check(c.AppEnv != "", "APP_ENV", "must not be empty")
+	check(c.MaxRequestBodyBytes > 0, "MAX_REQUEST_BODY_BYTES", "must be positive")
+	check(oneOf(c.ErrorFormat, "problem", "legacy"), "ERROR_FORMAT", "must be problem or legacy, got %q", c.ErrorFormat)
+	check(c.ShutdownDelay >= 0, "SHUTDOWN_DELAY", "must not be negative")
+	check(c.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT", "must be positive")
+
+	check((c.TLSCertFile == "") == (c.TLSKeyFile == ""), "TLS_CERT_FILE", "must be set together with TLS_KEY_FILE")
+	check(oneOf(c.TLSMinVersion, "1.2", "1.3"), "TLS_MIN_VERSION", "must be 1.2 or 1.3, got %q", c.TLSMinVersion)
+	check(oneOf(c.TLSClientAuth, "none", "optional", "require"), "TLS_CLIENT_AUTH", "must be none, optional or require, got %q", c.TLSClientAuth)
+	if c.TLSClientAuth != "none" {
+		check(c.TLSCertFile != "", "TLS_CLIENT_AUTH", "requires TLS_CERT_FILE")
+		check(c.TLSClientCAFile != "", "TLS_CLIENT_CA_FILE", "is required when TLS_CLIENT_AUTH is %s", c.TLSClientAuth)
+	}
+
+	check(c.SecurityHSTSMaxAge >= 0, "SECURITY_HSTS_MAX_AGE", "must not be negative")
+	for _, path := range c.SecurityNoStorePaths {
+		check(strings.HasPrefix(path, "/"), "SECURITY_NO_STORE_PATHS", "entries must start with /, got %q", path)
+	}
+	for _, origin := range c.CORSAllowedOrigins {
+		check(origin == "*" || validOrigin(origin), "CORS_ALLOWED_ORIGINS", "entries must be * or scheme://host[:port], got %q", origin)
+		check(origin != "*" || !c.CORSAllowCredentials, "CORS_ALLOWED_ORIGINS", "must list origins when CORS_ALLOW_CREDENTIALS is set")
+	}
+	check(c.CORSMaxAge >= 0, "CORS_MAX_AGE", "must not be negative")
+	check(c.RateLimitDefault != "", "RATE_LIMIT_DEFAULT", "must not be empty")
+	for _, route := range c.RateLimitRoutes {
+		check(strings.Contains(route, "="), "RATE_LIMIT_ROUTES", "entries must be route=limit, got %q", route)
+	}
+	for _, cidr := range c.RateLimitTrustedProxies {
+		_, _, err := net.ParseCIDR(cidr)
+		check(err == nil, "RATE_LIMIT_TRUSTED_PROXIES", "invalid network %q", cidr)
+	}
+	check(oneOf(c.RateLimitBackend, "memory", "redis"), "RATE_LIMIT_BACKEND", "must be memory or redis, got %q", c.RateLimitBackend)
+	if c.RateLimitBackend == "redis" {
+		check(c.RateLimitRedisURL != "", "RATE_LIMIT_REDIS_URL", "is required when RATE_LIMIT_BACKEND is redis")
+	}
+	check(c.RateLimitRedisTimeout > 0, "RATE_LIMIT_REDIS_TIMEOUT", "must be positive")
+
+	check(c.DBHost != "", "DB_HOST", "must not be empty")
+	check(validPort(c.DBPort), "DB_PORT", "must be a port number, got %q", c.DBPort)
+	check(c.DBName != "", "DB_NAME", "must not be empty")
+	check(c.DBUser != "" || c.DBVaultRole != "", "DB_USER", "must not be empty")
+	check(c.DBDrainTimeout > 0, "DB_DRAIN_TIMEOUT", "must be positive")
+	_, err := time.LoadLocation(c.DBLocation)
+	check(err == nil, "DB_LOCATION", "unknown time zone %q", c.DBLocation)
+	check(c.DBDialTimeout >= 0, "DB_DIAL_TIMEOUT", "must not be negative")
+	check(c.DBReadTimeout >= 0, "DB_READ_TIMEOUT", "must not be negative")
+	check(c.DBWriteTimeout >= 0, "DB_WRITE_TIMEOUT", "must not be negative")
+	check(oneOf(c.DBTLSMode, "disabled", "preferred", "required", "verify-ca", "verify-identity"), "DB_TLS_MODE", "must be disabled, preferred, required, verify-ca or verify-identity, got %q", c.DBTLSMode)
+	check(c.DBTLSCAFile == "" || strings.HasPrefix(c.DBTLSMode, "verify-"), "DB_TLS_CA_FILE", "requires DB_TLS_MODE verify-ca or verify-identity")
+	if _, err := c.DBParamMap(); err != nil {
+		check(false, "DB_PARAMS", "%v", err)
+	}
+	check(c.DBMaxOpenConns >= 0, "DB_MAX_OPEN_CONNS", "must not be negative")
+	check(c.DBMaxIdleConns >= 0, "DB_MAX_IDLE_CONNS", "must not be negative")
+	check(c.DBConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME", "must not be negative")
+	check(c.DBConnMaxIdleTime >= 0, "DB_CONN_MAX_IDLE_TIME", "must not be negative")
+
+	check(oneOf(c.PasswordHasher, "argon2id", "bcrypt"), "PASSWORD_HASHER", "must be argon2id or bcrypt, got %q", c.PasswordHasher)
+	check(c.PasswordArgon2Time >= 1 && c.PasswordArgon2Time <= password.MaxArgon2idTime, "PASSWORD_ARGON2_TIME", "must be between 1 and %d", password.MaxArgon2idTime)
+	check(c.PasswordArgon2Threads >= 1 && c.PasswordArgon2Threads <= password.MaxArgon2idThreads, "PASSWORD_ARGON2_THREADS", "must be between 1 and %d", password.MaxArgon2idThreads)
+	check(c.PasswordArgon2Memory >= 8*c.PasswordArgon2Threads && c.PasswordArgon2Memory <= password.MaxArgon2idMemory, "PASSWORD_ARGON2_MEMORY", "must be between 8 KiB per thread and %d KiB", password.MaxArgon2idMemory)
+	check(c.PasswordBcryptCost >= 4 && c.PasswordBcryptCost <= 31, "PASSWORD_BCRYPT_COST", "must be between 4 and 31")
+	check(c.PasswordMinLength >= 1, "PASSWORD_MIN_LENGTH", "must be at least 1")
+	check(c.PasswordMaxLength == 0 || c.PasswordMaxLength >= c.PasswordMinLength, "PASSWORD_MAX_LENGTH", "must be 0 or at least PASSWORD_MIN_LENGTH")
+	check(c.PasswordMinClasses >= 1 && c.PasswordMinClasses <= 4, "PASSWORD_MIN_CLASSES", "must be between 1 and 4")
+
+	switch c.JWTAlgorithm {
+	case "HS256":
+		check(len(c.JWTSecret) >= 32, "JWT_SECRET", "must be set to at least 32 bytes for HS256")
+	case "RS256", "EdDSA":
+		check(c.JWTPrivateKeyFile != "", "JWT_PRIVATE_KEY_FILE", "is required for %s", c.JWTAlgorithm)
+	default:
+		check(false, "JWT_ALGORITHM", "must be HS256, RS256 or EdDSA, got %q", c.JWTAlgorithm)
+	}
+	for _, entry := range c.JWTPreviousSecrets {
+		_, _, ok := strings.Cut(entry, "=")
+		check(ok, "JWT_PREVIOUS_SECRETS", "entries must be kid=secret")
+	}
+	for _, entry := range c.JWTPublicKeyFiles {
+		_, _, ok := strings.Cut(entry, "=")
+		check(ok, "JWT_PUBLIC_KEY_FILES", "entries must be kid=path")
+	}
+	check(c.JWTAccessTTL > 0, "JWT_ACCESS_TTL", "must be positive")
+	check(c.JWTRefreshTTL >= c.JWTAccessTTL, "JWT_REFRESH_TTL", "must not be shorter than JWT_ACCESS_TTL")
+
+	check(c.HealthCheckTimeout > 0, "HEALTH_CHECK_TIMEOUT", "must be positive")
+	check(c.HealthPoolSaturation > 0 && c.HealthPoolSaturation <= 1, "HEALTH_POOL_SATURATION", "must be in (0, 1]")
+	for _, cidr := range c.HealthInternalCIDRs {
+		_, _, err := net.ParseCIDR(cidr)
+		check(err == nil, "HEALTH_INTERNAL_CIDRS", "invalid network %q", cidr)
+	}
+
+	check(c.MigrateLockTimeout >= 0, "MIGRATE_LOCK_TIMEOUT", "must not be negative")
+	check(strings.HasPrefix(c.MetricsPath, "/"), "METRICS_PATH", "must start with /")
+
+	check(oneOf(c.TracingExporter, "none", "otlp", "stdout"), "OTEL_TRACES_EXPORTER", "must be none, otlp or stdout, got %q", c.TracingExporter)
+	check(oneOf(c.TracingProtocol, "grpc", "http/protobuf"), "OTEL_EXPORTER_OTLP_PROTOCOL", "must be grpc or http/protobuf, got %q", c.TracingProtocol)
+	check(c.TracingSampleRatio >= 0 && c.TracingSampleRatio <= 1, "OTEL_TRACES_SAMPLER_ARG", "must be in [0, 1]")
+
+	check(c.ConfigWatchInterval >= 0, "CONFIG_WATCH_INTERVAL", "must not be negative")
+	check(c.AWSRegion != "", "AWS_REGION", "must not be empty")
+	check(c.AWSSecretsCacheTTL >= 0, "AWS_SECRETS_CACHE_TTL", "must not be negative")
+	check(oneOf(c.VaultAuthMethod, "kubernetes", "token"), "VAULT_AUTH_METHOD", "must be kubernetes or token, got %q", c.VaultAuthMethod)
+	check(c.VaultTimeout > 0, "VAULT_TIMEOUT", "must be positive")
+	return errs
+}
+
+func validPort(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// validOrigin reports whether s is a web origin without path, e.g.
+// https://admin.example.com
+func validOrigin(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == "" && u.RawQuery == ""
+}
+
+func oneOf(s string, values ...string) bool {
+	for _, v := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
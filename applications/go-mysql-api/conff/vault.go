@@ -0,0 +1,342 @@
+package conff
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultOptions configures a Vault client
+type VaultOptions struct {
+	Addr string
+	// AuthMethod is "kubernetes", logging in with the projected service
+	// account token in JWTPath, or "token", using Token as is
+	AuthMethod string
+	AuthMount  string
+	Role       string
+	JWTPath    string
+	Token      string
+	SkipVerify bool
+	Timeout    time.Duration
+}
+
+// vaultRetryTTL is the shortest TTL used to schedule another login after a
+// failed one, so that an outage is not retried in a busy loop
+const vaultRetryTTL = 3 * time.Second
+
+// vaultMinRenewAfter is the shortest time Run waits before renewing a token,
+// so that very short TTLs do not make it spin against Vault
+const vaultMinRenewAfter = time.Second
+
+// Vault reads KV v2 secrets from HashiCorp Vault and keeps its token alive
+type Vault struct {
+	opts   VaultOptions
+	client *http.Client
+
+	mu        sync.RWMutex
+	token     string
+	ttl       time.Duration
+	renewable bool
+
+	// renewAfter returns how long to wait before renewing a token valid for ttl
+	renewAfter func(ttl time.Duration) time.Duration
+}
+
+// NewVault returns a client for the server in opts. Call Login before use.
+func NewVault(opts VaultOptions) *Vault {
+	if opts.AuthMount == "" {
+		opts.AuthMount = opts.AuthMethod
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.SkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &Vault{
+		opts:       opts,
+		client:     &http.Client{Transport: transport, Timeout: opts.Timeout},
+		renewAfter: func(ttl time.Duration) time.Duration { return max(ttl*2/3, vaultMinRenewAfter) },
+	}
+}
+
+// newVaultProvider logs in to the Vault configured in c
+func newVaultProvider(ctx context.Context, c *Config) (SecretProvider, error) {
+	if c.VaultAddr == "" {
+		return nil, errors.New("VAULT_ADDR is not set")
+	}
+	v := NewVault(VaultOptions{
+		Addr:       c.VaultAddr,
+		AuthMethod: c.VaultAuthMethod,
+		AuthMount:  c.VaultAuthMount,
+		Role:       c.VaultAuthRole,
+		JWTPath:    c.VaultJWTPath,
+		Token:      c.VaultToken,
+		SkipVerify: c.VaultSkipVerify,
+		Timeout:    c.VaultTimeout,
+	})
+	if err := v.Login(ctx); err != nil {
+		return nil, err
+	}
+	c.vault = v
+	return v, nil
+}
+
+// vaultAuth is the auth block of Vault login and renew responses
+type vaultAuth struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+}
+
+// Login obtains a token with the configured auth method
+func (v *Vault) Login(ctx context.Context) error {
+	switch v.opts.AuthMethod {
+	case "kubernetes":
+		jwt, err := os.ReadFile(v.opts.JWTPath)
+		if err != nil {
+			return fmt.Errorf("reading service account token: %w", err)
+		}
+		var resp struct {
+			Auth vaultAuth `json:"auth"`
+		}
+		body := map[string]string{"role": v.opts.Role, "jwt": strings.TrimSpace(string(jwt))}
+		if err := v.do(ctx, "POST", "auth/"+v.opts.AuthMount+"/login", "", body, &resp); err != nil {
+			return fmt.Errorf("kubernetes login: %w", err)
+		}
+		v.setAuth(resp.Auth)
+		return nil
+
+	case "token":
+		var resp struct {
+			Data struct {
+				TTL       int  `json:"ttl"`
+				Renewable bool `json:"renewable"`
+			} `json:"data"`
+		}
+		if err := v.do(ctx, "GET", "auth/token/lookup-self", v.opts.Token, nil, &resp); err != nil {
+			return fmt.Errorf("token lookup: %w", err)
+		}
+		v.setAuth(vaultAuth{ClientToken: v.opts.Token, LeaseDuration: resp.Data.TTL, Renewable: resp.Data.Renewable})
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported auth method %q", v.opts.AuthMethod)
+	}
+}
+
+func (v *Vault) setAuth(a vaultAuth) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.token = a.ClientToken
+	v.ttl = time.Duration(a.LeaseDuration) * time.Second
+	v.renewable = a.Renewable
+}
+
+func (v *Vault) currentToken() string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.token
+}
+
+// Secret reads the KV v2 secret at path, e.g. secret/data/go-mysql-api/app
+func (v *Vault) Secret(ctx context.Context, path string) (map[string]string, error) {
+	var resp struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, "GET", path, v.currentToken(), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data.Data == nil {
+		// Deleted versions come back without data
+		return nil, ErrSecretNotFound
+	}
+	return stringMap(resp.Data.Data), nil
+}
+
+// RenewToken extends the lease of the current token
+func (v *Vault) RenewToken(ctx context.Context) error {
+	var resp struct {
+		Auth vaultAuth `json:"auth"`
+	}
+	if err := v.do(ctx, "POST", "auth/token/renew-self", v.currentToken(), struct{}{}, &resp); err != nil {
+		return err
+	}
+	v.setAuth(resp.Auth)
+	return nil
+}
+
+// Run keeps the token valid until ctx is done. Renewable tokens are renewed
+// after two thirds of their TTL; when renewal is impossible or fails, Run
+// logs in again, retrying at least every few seconds while Vault is
+// unreachable. Tokens without a TTL never expire and are left alone.
+func (v *Vault) Run(ctx context.Context) {
+	v.mu.RLock()
+	ttl, renewable := v.ttl, v.renewable
+	v.mu.RUnlock()
+	expires := time.Now().Add(ttl)
+	for {
+		if ttl <= 0 {
+			// Root and other non-expiring tokens need no upkeep
+			return
+		}
+
+		timer := time.NewTimer(v.renewAfter(ttl))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		renewed := false
+		if renewable {
+			err := v.RenewToken(ctx)
+			if err != nil {
+				slog.Warn("vault: renewing token", "error", err)
+			}
+			renewed = err == nil
+		}
+		if !renewed {
+			if err := v.Login(ctx); err != nil {
+				slog.Error("vault: logging in again", "error", err)
+				// Try again well before the current token expires
+				ttl = max(time.Until(expires), vaultRetryTTL)
+				continue
+			}
+		}
+
+		v.mu.RLock()
+		ttl, renewable = v.ttl, v.renewable
+		v.mu.RUnlock()
+		expires = time.Now().Add(ttl)
+	}
+}
+
+// vaultError is the error body returned by the Vault API
+type vaultError struct {
+	Errors []string `json:"errors"`
+}
+
+// do calls the Vault HTTP API at /v1/<path> and decodes the JSON response
+// into out
+func (v *Vault) do(ctx context.Context, method, path, token string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(v.opts.Addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), body)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrSecretNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		var ve vaultError
+		json.NewDecoder(resp.Body).Decode(&ve)
+		return fmt.Errorf("vault: %s %s: %s %s", method, path, resp.Status, strings.Join(ve.Errors, "; "))
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Lease is a secret with a limited lifetime issued by a Vault secrets engine
+type Lease struct {
+	ID        string
+	Duration  time.Duration
+	Renewable bool
+	Data      map[string]string
+}
+
+// vaultLease is the JSON form of a leased secret
+type vaultLease struct {
+	LeaseID       string         `json:"lease_id"`
+	LeaseDuration int            `json:"lease_duration"`
+	Renewable     bool           `json:"renewable"`
+	Data          map[string]any `json:"data"`
+}
+
+func (l vaultLease) lease() *Lease {
+	return &Lease{
+		ID:        l.LeaseID,
+		Duration:  time.Duration(l.LeaseDuration) * time.Second,
+		Renewable: l.Renewable,
+		Data:      stringMap(l.Data),
+	}
+}
+
+// DatabaseCredentials asks the database secrets engine mounted at mount for
+// a new user of role
+func (v *Vault) DatabaseCredentials(ctx context.Context, mount, role string) (*Lease, error) {
+	var resp vaultLease
+	if err := v.do(ctx, "GET", mount+"/creds/"+role, v.currentToken(), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.LeaseID == "" {
+		return nil, fmt.Errorf("vault: %s/creds/%s returned no lease", mount, role)
+	}
+	return resp.lease(), nil
+}
+
+// RenewLease extends the lease id by increment and returns its new
+// duration, which Vault caps at the lease's maximum TTL
+func (v *Vault) RenewLease(ctx context.Context, id string, increment time.Duration) (time.Duration, error) {
+	var resp vaultLease
+	body := map[string]any{"lease_id": id, "increment": int(increment / time.Second)}
+	if err := v.do(ctx, "PUT", "sys/leases/renew", v.currentToken(), body, &resp); err != nil {
+		return 0, err
+	}
+	return time.Duration(resp.LeaseDuration) * time.Second, nil
+}
+
+// RevokeLease revokes the lease id, e.g. dropping a database user
+func (v *Vault) RevokeLease(ctx context.Context, id string) error {
+	return v.do(ctx, "PUT", "sys/leases/revoke", v.currentToken(), map[string]string{"lease_id": id}, nil)
+}
+
+// stringMap converts the values of a Vault data object to strings
+func stringMap(m map[string]any) map[string]string {
+	if m == nil {
+		return nil
+	}
+	data := make(map[string]string, len(m))
+	for k, val := range m {
+		if s, ok := val.(string); ok {
+			data[k] = s
+		} else {
+			data[k] = fmt.Sprint(val)
+		}
+	}
+	return data
+}
@@ -0,0 +1,423 @@
+package conff
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVault implements the parts of the Vault HTTP API used by Vault
+type fakeVault struct {
+	*httptest.Server
+
+	role, jwt string
+	ttl       int
+	renewable bool
+	secrets   map[string]map[string]any
+
+	mu sync.Mutex
+	// down makes every request fail as during an outage
+	down    bool
+	logins  int
+	renews  int
+	reads   map[string]int
+	tokens  map[string]bool
+	nextTok int
+	// leases maps database lease IDs to their remaining TTL in seconds
+	leases    map[string]int
+	nextLease int
+}
+
+func newFakeVault(t *testing.T) *fakeVault {
+	fv := &fakeVault{
+		role:      "go-mysql-api",
+		jwt:       "service-account-jwt",
+		ttl:       3600,
+		renewable: true,
+		secrets: map[string]map[string]any{
+			"secret/data/go-mysql-api/database": {"password": "s3cret", "user": "app", "port": 3306},
+			"secret/data/go-mysql-api/app":      {"jwt_secret": testSecret, "api_key": "gma_static"},
+		},
+		reads:  make(map[string]int),
+		tokens: map[string]bool{"root-token": true},
+		leases: make(map[string]int),
+	}
+	fv.Server = httptest.NewServer(http.HandlerFunc(fv.serve))
+	t.Cleanup(fv.Close)
+	return fv
+}
+
+func (fv *fakeVault) serve(w http.ResponseWriter, r *http.Request) {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	fail := func(status int, msg string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(vaultError{Errors: []string{msg}})
+	}
+	if fv.down {
+		fail(http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+	auth := func() map[string]any {
+		fv.nextTok++
+		token := fmt.Sprintf("token-%d", fv.nextTok)
+		fv.tokens[token] = true
+		return map[string]any{"auth": map[string]any{"client_token": token, "lease_duration": fv.ttl, "renewable": fv.renewable}}
+	}
+
+	if path == "auth/kubernetes/login" && r.Method == "POST" {
+		var body struct{ Role, JWT string }
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Role != fv.role || body.JWT != fv.jwt {
+			fail(http.StatusForbidden, "permission denied")
+			return
+		}
+		fv.logins++
+		json.NewEncoder(w).Encode(auth())
+		return
+	}
+
+	token := r.Header.Get("X-Vault-Token")
+	if !fv.tokens[token] {
+		fail(http.StatusForbidden, "permission denied")
+		return
+	}
+	switch {
+	case path == "database/creds/go-mysql-api" && r.Method == "GET":
+		fv.nextLease++
+		id := fmt.Sprintf("database/creds/go-mysql-api/%d", fv.nextLease)
+		fv.leases[id] = 600
+		json.NewEncoder(w).Encode(map[string]any{
+			"lease_id": id, "lease_duration": 600, "renewable": true,
+			"data": map[string]any{"username": fmt.Sprintf("v-k8s-go-mysql-api-%d", fv.nextLease), "password": "dynamic"},
+		})
+	case path == "sys/leases/renew" && r.Method == "PUT":
+		var body struct {
+			LeaseID   string `json:"lease_id"`
+			Increment int    `json:"increment"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := fv.leases[body.LeaseID]; !ok {
+			fail(http.StatusBadRequest, "lease not found")
+			return
+		}
+		// Renewals are capped as if the lease were close to its max TTL
+		ttl := min(body.Increment, 120)
+		fv.leases[body.LeaseID] = ttl
+		json.NewEncoder(w).Encode(map[string]any{"lease_id": body.LeaseID, "lease_duration": ttl, "renewable": true})
+	case path == "sys/leases/revoke" && r.Method == "PUT":
+		var body struct {
+			LeaseID string `json:"lease_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		delete(fv.leases, body.LeaseID)
+		w.WriteHeader(http.StatusNoContent)
+	case path == "auth/token/lookup-self":
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"ttl": 0, "renewable": false}})
+	case path == "auth/token/renew-self" && r.Method == "POST":
+		if !fv.renewable {
+			fail(http.StatusBadRequest, "lease is not renewable")
+			return
+		}
+		fv.renews++
+		json.NewEncoder(w).Encode(map[string]any{"auth": map[string]any{"client_token": token, "lease_duration": fv.ttl, "renewable": true}})
+	default:
+		data, ok := fv.secrets[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		fv.reads[path]++
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"data": data, "metadata": map[string]any{"version": 1}}})
+	}
+}
+
+func (fv *fakeVault) counts() (logins, renews int) {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+	return fv.logins, fv.renews
+}
+
+// useFakeVault points the Vault settings at fv, logging in with Kubernetes auth
+func useFakeVault(t *testing.T, fv *fakeVault) {
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(jwtPath, []byte(fv.jwt+"\n"), 0o600))
+	t.Setenv("VAULT_ADDR", fv.URL)
+	t.Setenv("VAULT_AUTH_ROLE", fv.role)
+	t.Setenv("VAULT_JWT_PATH", jwtPath)
+}
+
+func TestLoadResolvesVaultReferences(t *testing.T) {
+	fv := newFakeVault(t)
+	useFakeVault(t, fv)
+	t.Setenv("DB_PASSWORD", "vault://secret/data/go-mysql-api/database#password")
+	t.Setenv("DB_USER", "vault://secret/data/go-mysql-api/database#user")
+	t.Setenv("DB_PORT", "vault://secret/data/go-mysql-api/database#port")
+	t.Setenv("JWT_SECRET", "vault://secret/data/go-mysql-api/app#jwt_secret")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", cfg.DBPassword)
+	assert.Equal(t, "app", cfg.DBUser)
+	assert.Equal(t, "3306", cfg.DBPort)
+	assert.Equal(t, testSecret, cfg.JWTSecret)
+	assert.Equal(t, SourceEnv+"+vault", cfg.Source("DB_PASSWORD"))
+	require.NotNil(t, cfg.Vault())
+
+	// Each path is read once however many settings refer to it
+	assert.Equal(t, 1, fv.reads["secret/data/go-mysql-api/database"])
+	logins, _ := fv.counts()
+	assert.Equal(t, 1, logins)
+
+	var out bytes.Buffer
+	require.NoError(t, cfg.Print(&out))
+	assert.NotContains(t, out.String(), "s3cret")
+	assert.Contains(t, out.String(), Redacted)
+}
+
+func TestReloadReusesVault(t *testing.T) {
+	fv := newFakeVault(t)
+	useFakeVault(t, fv)
+	t.Setenv("DB_PASSWORD", "vault://secret/data/go-mysql-api/database#password")
+	t.Setenv("JWT_SECRET", testSecret)
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+
+	// Unchanged references keep their value when Vault is down, so a
+	// reload still works
+	fv.mu.Lock()
+	fv.down = true
+	fv.mu.Unlock()
+	t.Setenv("LOG_LEVEL", "debug")
+	next, err := Reload(nil, cfg, true)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", next.DBPassword)
+	assert.Equal(t, SourceEnv+"+vault", next.Source("DB_PASSWORD"))
+	assert.Equal(t, []string{"LOG_LEVEL"}, cfg.Changed(next))
+	assert.Same(t, cfg.Vault(), next.Vault())
+
+	// A refreshing reload picks up a rotated password, one triggered by
+	// file changes does not ask Vault
+	fv.mu.Lock()
+	fv.down = false
+	fv.secrets["secret/data/go-mysql-api/database"]["password"] = "rotated"
+	fv.mu.Unlock()
+	cached, err := Reload(nil, next, false)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", cached.DBPassword)
+	next, err = Reload(nil, next, true)
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", next.DBPassword)
+	assert.Equal(t, []string{"DB_PASSWORD"}, cached.Changed(next))
+
+	// New references are read with the running client, without a new login
+	t.Setenv("DB_USER", "vault://secret/data/go-mysql-api/database#user")
+	next, err = Reload(nil, next, false)
+	require.NoError(t, err)
+	assert.Equal(t, "app", next.DBUser)
+	assert.Equal(t, "rotated", next.DBPassword)
+	logins, _ := fv.counts()
+	assert.Equal(t, 1, logins)
+}
+
+func TestLoadWithoutVaultReferences(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("VAULT_ADDR", "http://127.0.0.1:1")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Nil(t, cfg.Vault())
+}
+
+func TestLoadReportsVaultErrors(t *testing.T) {
+	fv := newFakeVault(t)
+	useFakeVault(t, fv)
+	t.Setenv("JWT_SECRET", testSecret)
+
+	t.Run("missing key", func(t *testing.T) {
+		t.Setenv("DB_PASSWORD", "vault://secret/data/go-mysql-api/database#nope")
+		_, err := Load(nil)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrSecretNotFound)
+		assert.Contains(t, err.Error(), "DB_PASSWORD")
+	})
+
+	t.Run("missing path", func(t *testing.T) {
+		t.Setenv("DB_PASSWORD", "vault://secret/data/other#password")
+		_, err := Load(nil)
+		assert.ErrorIs(t, err, ErrSecretNotFound)
+	})
+
+	t.Run("login denied", func(t *testing.T) {
+		t.Setenv("VAULT_AUTH_ROLE", "intruder")
+		t.Setenv("DB_PASSWORD", "vault://secret/data/go-mysql-api/database#password")
+		_, err := Load(nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "permission denied")
+	})
+
+	t.Run("no address", func(t *testing.T) {
+		t.Setenv("VAULT_ADDR", "")
+		t.Setenv("DB_PASSWORD", "vault://secret/data/go-mysql-api/database#password")
+		_, err := Load(nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "VAULT_ADDR")
+	})
+}
+
+func TestVaultTokenAuth(t *testing.T) {
+	fv := newFakeVault(t)
+	v := NewVault(VaultOptions{Addr: fv.URL, AuthMethod: "token", Token: "root-token"})
+	require.NoError(t, v.Login(context.Background()))
+
+	data, err := v.Secret(context.Background(), "secret/data/go-mysql-api/app")
+	require.NoError(t, err)
+	assert.Equal(t, "gma_static", data["api_key"])
+
+	v = NewVault(VaultOptions{Addr: fv.URL, AuthMethod: "token", Token: "bogus"})
+	assert.Error(t, v.Login(context.Background()))
+}
+
+func TestVaultRunRenewsToken(t *testing.T) {
+	fv := newFakeVault(t)
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(jwtPath, []byte(fv.jwt), 0o600))
+
+	v := NewVault(VaultOptions{Addr: fv.URL, AuthMethod: "kubernetes", Role: fv.role, JWTPath: jwtPath})
+	v.renewAfter = func(time.Duration) time.Duration { return time.Millisecond }
+	require.NoError(t, v.Login(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { v.Run(ctx); close(done) }()
+
+	assert.Eventually(t, func() bool { _, renews := fv.counts(); return renews >= 3 }, time.Second, time.Millisecond)
+	logins, _ := fv.counts()
+	assert.Equal(t, 1, logins)
+
+	// Once renewal is refused, Run logs in again
+	fv.mu.Lock()
+	fv.renewable = false
+	fv.mu.Unlock()
+	assert.Eventually(t, func() bool { logins, _ := fv.counts(); return logins >= 3 }, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+	_, err := v.Secret(context.Background(), "secret/data/go-mysql-api/app")
+	assert.NoError(t, err)
+}
+
+// Test that Run keeps retrying at a bounded rate while Vault is down
+func TestVaultRunRetriesLoginDuringOutage(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.ttl = 30
+	fv.renewable = false
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(jwtPath, []byte(fv.jwt), 0o600))
+
+	v := NewVault(VaultOptions{Addr: fv.URL, AuthMethod: "kubernetes", Role: fv.role, JWTPath: jwtPath})
+	var mu sync.Mutex
+	var waits []time.Duration
+	v.renewAfter = func(ttl time.Duration) time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		waits = append(waits, ttl)
+		return time.Millisecond
+	}
+	require.NoError(t, v.Login(context.Background()))
+
+	fv.mu.Lock()
+	fv.down = true
+	fv.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { v.Run(ctx); close(done) }()
+
+	attempts := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(waits)
+	}
+	assert.Eventually(t, func() bool { return attempts() >= 20 }, 5*time.Second, time.Millisecond)
+	mu.Lock()
+	for _, ttl := range waits {
+		assert.GreaterOrEqual(t, ttl, vaultRetryTTL)
+	}
+	mu.Unlock()
+
+	// Failed logins do not make Run mistake the token for a non-expiring one
+	select {
+	case <-done:
+		t.Fatal("Run stopped during the outage")
+	default:
+	}
+
+	fv.mu.Lock()
+	fv.down = false
+	fv.mu.Unlock()
+	assert.Eventually(t, func() bool { logins, _ := fv.counts(); return logins >= 2 }, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+	assert.Equal(t, time.Second, NewVault(VaultOptions{}).renewAfter(0))
+}
+
+func TestVaultDatabaseCredentials(t *testing.T) {
+	fv := newFakeVault(t)
+	v := NewVault(VaultOptions{Addr: fv.URL, AuthMethod: "token", Token: "root-token"})
+	require.NoError(t, v.Login(context.Background()))
+	ctx := context.Background()
+
+	lease, err := v.DatabaseCredentials(ctx, "database", "go-mysql-api")
+	require.NoError(t, err)
+	assert.Equal(t, "database/creds/go-mysql-api/1", lease.ID)
+	assert.Equal(t, 10*time.Minute, lease.Duration)
+	assert.True(t, lease.Renewable)
+	assert.Equal(t, "v-k8s-go-mysql-api-1", lease.Data["username"])
+	assert.Equal(t, "dynamic", lease.Data["password"])
+
+	ttl, err := v.RenewLease(ctx, lease.ID, lease.Duration)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, ttl)
+
+	require.NoError(t, v.RevokeLease(ctx, lease.ID))
+	_, err = v.RenewLease(ctx, lease.ID, lease.Duration)
+	assert.Error(t, err)
+
+	_, err = v.DatabaseCredentials(ctx, "database", "unknown")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+}
+
+func TestLoadLogsInForDatabaseRole(t *testing.T) {
+	fv := newFakeVault(t)
+	useFakeVault(t, fv)
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("DB_VAULT_ROLE", "go-mysql-api")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	require.NotNil(t, cfg.Vault())
+	assert.Equal(t, "database", cfg.DBVaultMount)
+
+	t.Setenv("VAULT_ADDR", "")
+	_, err = Load(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "DB_VAULT_ROLE")
+}
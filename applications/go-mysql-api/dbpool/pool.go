@@ -0,0 +1,117 @@
+// Package dbpool keeps a MySQL connection pool usable across credential
+// rotations. Pool forwards every call to the current *sql.DB, and Rotator
+// replaces that pool with one using fresh credentials before the old ones
+// expire.
+package dbpool
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+)
+
+// drainPoll is how often a replaced pool is checked for work in progress
+const drainPoll = 50 * time.Millisecond
+
+// handle is one generation of the pool
+type handle struct {
+	db *sql.DB
+	// calls counts the calls that have picked this generation but may not
+	// have checked out a connection yet
+	calls atomic.Int64
+}
+
+// Pool is a *sql.DB that can be replaced while in use
+type Pool struct {
+	cur atomic.Pointer[handle]
+	// DrainTimeout bounds how long a replaced pool may keep serving the
+	// queries started before the swap
+	DrainTimeout time.Duration
+}
+
+// New returns a Pool serving from db
+func New(db *sql.DB) *Pool {
+	p := &Pool{DrainTimeout: 30 * time.Second}
+	p.cur.Store(&handle{db: db})
+	return p
+}
+
+// acquire returns the current generation; release it when the call has its
+// connection
+func (p *Pool) acquire() *handle {
+	for {
+		h := p.cur.Load()
+		h.calls.Add(1)
+		if p.cur.Load() == h {
+			return h
+		}
+		// Swapped in between; the drain may already have started
+		h.calls.Add(-1)
+	}
+}
+
+func (h *handle) release() { h.calls.Add(-1) }
+
+// Swap makes db the current pool. The previous pool is closed in the
+// background once the queries, rows and connections taken from it are
+// done, or after DrainTimeout. The returned channel is closed after that.
+func (p *Pool) Swap(db *sql.DB) <-chan struct{} {
+	old := p.cur.Swap(&handle{db: db})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		deadline := time.Now().Add(p.DrainTimeout)
+		for (old.calls.Load() > 0 || old.db.Stats().InUse > 0) && time.Now().Before(deadline) {
+			time.Sleep(drainPoll)
+		}
+		old.db.Close()
+	}()
+	return done
+}
+
+// DB returns the current pool. It may be closed after the next Swap, so
+// prefer the Pool methods for anything but short-lived use.
+func (p *Pool) DB() *sql.DB {
+	return p.cur.Load().db
+}
+
+func (p *Pool) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	h := p.acquire()
+	defer h.release()
+	return h.db.ExecContext(ctx, query, args...)
+}
+
+func (p *Pool) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	h := p.acquire()
+	defer h.release()
+	return h.db.QueryContext(ctx, query, args...)
+}
+
+func (p *Pool) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	h := p.acquire()
+	defer h.release()
+	return h.db.QueryRowContext(ctx, query, args...)
+}
+
+func (p *Pool) Conn(ctx context.Context) (*sql.Conn, error) {
+	h := p.acquire()
+	defer h.release()
+	return h.db.Conn(ctx)
+}
+
+func (p *Pool) PingContext(ctx context.Context) error {
+	h := p.acquire()
+	defer h.release()
+	return h.db.PingContext(ctx)
+}
+
+// Stats returns the statistics of the current pool
+func (p *Pool) Stats() sql.DBStats {
+	return p.cur.Load().db.Stats()
+}
+
+// Close closes the current pool
+func (p *Pool) Close() error {
+	return p.cur.Load().db.Close()
+}
@@ -0,0 +1,202 @@
+package dbpool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openUnconnected returns a pool that never dials, identified by user
+func openUnconnected(t *testing.T, user string) *sql.DB {
+	db, err := sql.Open("mysql", user+":pass@tcp(127.0.0.1:1)/test")
+	require.NoError(t, err)
+	return db
+}
+
+// closed reports whether db has been closed
+func closed(db *sql.DB) bool {
+	_, err := db.Conn(context.Background())
+	return err != nil && err.Error() == "sql: database is closed"
+}
+
+func TestPoolSwapDrainsOldPool(t *testing.T) {
+	oldDB, newDB := openUnconnected(t, "old"), openUnconnected(t, "new")
+	p := New(oldDB)
+	p.DrainTimeout = time.Minute
+
+	// A call that picked the old pool before the swap keeps it open
+	h := p.acquire()
+	drained := p.Swap(newDB)
+	assert.Same(t, newDB, p.DB())
+
+	select {
+	case <-drained:
+		t.Fatal("old pool closed while in use")
+	case <-time.After(3 * drainPoll):
+	}
+	assert.False(t, closed(oldDB))
+
+	h.release()
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("old pool not closed after drain")
+	}
+	assert.True(t, closed(oldDB))
+	assert.False(t, closed(newDB))
+}
+
+func TestPoolSwapDrainTimeout(t *testing.T) {
+	p := New(openUnconnected(t, "old"))
+	p.DrainTimeout = drainPoll
+
+	p.acquire()
+	select {
+	case <-p.Swap(openUnconnected(t, "new")):
+	case <-time.After(time.Second):
+		t.Fatal("drain did not time out")
+	}
+}
+
+// fakeIssuer hands out numbered leases
+type fakeIssuer struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	renewTTL time.Duration
+	renewErr error
+	issued   int
+	renewed  int
+	revoked  []string
+}
+
+func (f *fakeIssuer) Issue(ctx context.Context) (*Lease, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.issued++
+	return &Lease{ID: fmt.Sprintf("lease-%d", f.issued), User: fmt.Sprintf("v-user-%d", f.issued), TTL: f.ttl, Renewable: true}, nil
+}
+
+func (f *fakeIssuer) Renew(ctx context.Context, l *Lease) (time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.renewed++
+	return f.renewTTL, f.renewErr
+}
+
+func (f *fakeIssuer) Revoke(ctx context.Context, l *Lease) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revoked = append(f.revoked, l.ID)
+	return nil
+}
+
+func (f *fakeIssuer) state() (issued, renewed int, revoked []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.issued, f.renewed, append([]string(nil), f.revoked...)
+}
+
+// startRotator runs a Rotator acting on every lease after a millisecond
+func startRotator(t *testing.T, issuer *fakeIssuer, open OpenFunc) *Pool {
+	lease, err := issuer.Issue(context.Background())
+	require.NoError(t, err)
+	p := New(openUnconnected(t, lease.User))
+	p.DrainTimeout = time.Second
+
+	r := NewRotator(p, issuer, lease, open)
+	r.renewAfter = func(time.Duration) time.Duration { return time.Millisecond }
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { r.Run(ctx); close(done) }()
+	t.Cleanup(func() { cancel(); <-done })
+	return p
+}
+
+func TestRotatorRenewsLease(t *testing.T) {
+	issuer := &fakeIssuer{ttl: time.Hour, renewTTL: time.Hour}
+	startRotator(t, issuer, func(ctx context.Context, l *Lease) (*sql.DB, error) {
+		return nil, errors.New("unexpected")
+	})
+
+	assert.Eventually(t, func() bool { _, renewed, _ := issuer.state(); return renewed >= 3 }, time.Second, time.Millisecond)
+	issued, _, revoked := issuer.state()
+	assert.Equal(t, 1, issued)
+	assert.Empty(t, revoked)
+}
+
+func TestRotatorRotatesNearMaxTTL(t *testing.T) {
+	// Vault caps renewals at the max TTL, so they come back shorter
+	issuer := &fakeIssuer{ttl: time.Hour, renewTTL: time.Minute}
+	p := startRotator(t, issuer, func(ctx context.Context, l *Lease) (*sql.DB, error) {
+		return openUnconnected(t, l.User), nil
+	})
+
+	assert.Eventually(t, func() bool {
+		_, _, revoked := issuer.state()
+		return len(revoked) >= 2
+	}, 2*time.Second, time.Millisecond)
+	_, _, revoked := issuer.state()
+	assert.Equal(t, []string{"lease-1", "lease-2"}, revoked[:2])
+	assert.NotNil(t, p.DB())
+}
+
+func TestRotatorRotatesWhenRenewalFails(t *testing.T) {
+	issuer := &fakeIssuer{ttl: time.Hour, renewErr: errors.New("lease not found")}
+	var mu sync.Mutex
+	var users []string
+	p := startRotator(t, issuer, func(ctx context.Context, l *Lease) (*sql.DB, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		users = append(users, l.User)
+		return openUnconnected(t, l.User), nil
+	})
+	first := p.DB()
+
+	assert.Eventually(t, func() bool { return p.DB() != first }, time.Second, time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, "v-user-2", users[0])
+	mu.Unlock()
+}
+
+func TestRotatorRevokesLeaseOfFailedPool(t *testing.T) {
+	issuer := &fakeIssuer{ttl: time.Hour, renewErr: errors.New("lease not found")}
+	p := startRotator(t, issuer, func(ctx context.Context, l *Lease) (*sql.DB, error) {
+		return nil, errors.New("access denied")
+	})
+	first := p.DB()
+
+	assert.Eventually(t, func() bool {
+		_, _, revoked := issuer.state()
+		return len(revoked) >= 1
+	}, time.Second, time.Millisecond)
+	_, _, revoked := issuer.state()
+	assert.Equal(t, "lease-2", revoked[0])
+	assert.Same(t, first, p.DB())
+}
+
+func TestRotatorLeavesLeasesWithoutTTL(t *testing.T) {
+	issuer := &fakeIssuer{renewTTL: time.Hour}
+	startRotator(t, issuer, func(ctx context.Context, l *Lease) (*sql.DB, error) {
+		return nil, errors.New("unexpected")
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	issued, renewed, revoked := issuer.state()
+	assert.Equal(t, 1, issued)
+	assert.Zero(t, renewed)
+	assert.Empty(t, revoked)
+}
+
+func TestRotatorWaitsAtLeastASecond(t *testing.T) {
+	r := NewRotator(New(openUnconnected(t, "user")), &fakeIssuer{}, &Lease{TTL: time.Hour}, nil)
+	assert.Equal(t, 40*time.Minute, r.renewAfter(time.Hour))
+	assert.Equal(t, time.Second, r.renewAfter(300*time.Millisecond))
+}
@@ -0,0 +1,137 @@
+package dbpool
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// Lease is a set of database credentials valid for a limited time
+type Lease struct {
+	ID        string
+	User      string
+	Password  string
+	TTL       time.Duration
+	Renewable bool
+}
+
+// Issuer hands out leased credentials, e.g. Vault's database secrets engine
+type Issuer interface {
+	Issue(ctx context.Context) (*Lease, error)
+	// Renew extends l and returns its new TTL, which may be shorter than
+	// requested once the lease approaches its maximum lifetime
+	Renew(ctx context.Context, l *Lease) (time.Duration, error)
+	Revoke(ctx context.Context, l *Lease) error
+}
+
+// retryTTL is the shortest TTL used to schedule another attempt after a
+// failed rotation, so that expired credentials are not retried in a busy loop
+const retryTTL = 3 * time.Second
+
+// minRenewAfter is the shortest time the rotator waits before acting on a
+// lease, so that very short TTLs do not make it spin against the issuer
+const minRenewAfter = time.Second
+
+// OpenFunc opens and checks a pool logging in with l
+type OpenFunc func(ctx context.Context, l *Lease) (*sql.DB, error)
+
+// Rotator keeps the credentials of a Pool valid. It renews the lease while
+// the issuer extends it by at least half of its original TTL; after that,
+// when renewal fails, or before a non-renewable lease expires, it opens a
+// pool with new credentials, swaps it in and revokes the old lease once the
+// old pool has drained. Leases without a TTL never expire and are left
+// alone.
+type Rotator struct {
+	pool   *Pool
+	issuer Issuer
+	open   OpenFunc
+	lease  *Lease
+	// issued is the TTL lease was issued with
+	issued time.Duration
+
+	// renewAfter returns how long to wait before acting on a lease valid for ttl
+	renewAfter func(ttl time.Duration) time.Duration
+}
+
+// NewRotator returns a Rotator for pool, whose current credentials are lease
+func NewRotator(pool *Pool, issuer Issuer, lease *Lease, open OpenFunc) *Rotator {
+	return &Rotator{
+		pool:       pool,
+		issuer:     issuer,
+		open:       open,
+		lease:      lease,
+		issued:     lease.TTL,
+		renewAfter: func(ttl time.Duration) time.Duration { return max(ttl*2/3, minRenewAfter) },
+	}
+}
+
+// Run rotates credentials until ctx is done
+func (r *Rotator) Run(ctx context.Context) {
+	ttl := r.lease.TTL
+	expires := time.Now().Add(ttl)
+	for {
+		if ttl <= 0 {
+			// Static credentials and other leases without a TTL need no upkeep
+			slog.Info("dbpool: lease does not expire, not rotating", "lease_id", r.lease.ID)
+			return
+		}
+
+		timer := time.NewTimer(r.renewAfter(ttl))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if r.lease.Renewable {
+			renewed, err := r.issuer.Renew(ctx, r.lease)
+			if err != nil {
+				slog.Warn("dbpool: renewing lease", "lease_id", r.lease.ID, "error", err)
+			} else if renewed >= r.issued/2 {
+				ttl, expires = renewed, time.Now().Add(renewed)
+				continue
+			} else {
+				expires = time.Now().Add(renewed)
+			}
+		}
+
+		if err := r.rotate(ctx); err != nil {
+			slog.Error("dbpool: rotating credentials", "error", err)
+			// Try again well before the current credentials expire
+			ttl = max(time.Until(expires), retryTTL)
+			continue
+		}
+		ttl, expires = r.lease.TTL, time.Now().Add(r.lease.TTL)
+	}
+}
+
+// rotate swaps in a pool using new credentials
+func (r *Rotator) rotate(ctx context.Context) error {
+	lease, err := r.issuer.Issue(ctx)
+	if err != nil {
+		return err
+	}
+	db, err := r.open(ctx, lease)
+	if err != nil {
+		if err := r.issuer.Revoke(ctx, lease); err != nil {
+			slog.Warn("dbpool: revoking unused lease", "lease_id", lease.ID, "error", err)
+		}
+		return err
+	}
+
+	old := r.lease
+	r.lease, r.issued = lease, lease.TTL
+	drained := r.pool.Swap(db)
+	slog.Info("dbpool: rotated credentials", "lease_id", lease.ID)
+
+	go func() {
+		<-drained
+		// The pool may outlive ctx during shutdown; revoke regardless
+		if err := r.issuer.Revoke(context.WithoutCancel(ctx), old); err != nil {
+			slog.Warn("dbpool: revoking lease", "lease_id", old.ID, "error", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,50 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Pinger is implemented by *sql.DB
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Ping checks that the database answers within the check timeout
+func Ping(db Pinger) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+}
+
+// PoolSaturation fails when the share of open connections in use reaches
+// max, so traffic moves to instances that still have capacity. Pools
+// without a connection limit never saturate.
+func PoolSaturation(stats func() sql.DBStats, max float64) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		s := stats()
+		if s.MaxOpenConnections <= 0 {
+			return nil
+		}
+		used := float64(s.InUse) / float64(s.MaxOpenConnections)
+		if used >= max {
+			return fmt.Errorf("connection pool saturated: %d/%d in use", s.InUse, s.MaxOpenConnections)
+		}
+		return nil
+	})
+}
+
+// Migrations fails while pending reports schema migrations that have not been applied
+func Migrations(pending func(ctx context.Context) (int, error)) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		n, err := pending(ctx)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%d schema migrations pending", n)
+		}
+		return nil
+	})
+}
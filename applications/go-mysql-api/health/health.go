@@ -0,0 +1,208 @@
+// Package health serves Kubernetes style liveness and readiness endpoints
+// backed by pluggable checkers.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Checker reports whether a dependency is healthy
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to the Checker interface
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Result is the outcome of a single check
+type Result struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Report is the detailed body returned to internal callers
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+type namedChecker struct {
+	name    string
+	checker Checker
+}
+
+// Health holds the registered liveness and readiness checks
+type Health struct {
+	timeout  time.Duration
+	internal []*net.IPNet
+
+	mu        sync.RWMutex
+	liveness  []namedChecker
+	readiness []namedChecker
+
+	// draining is set once the instance is shutting down
+	draining atomic.Bool
+}
+
+// New returns a Health that bounds every check by timeout and only shows
+// per-check details to callers whose address is within internal
+func New(timeout time.Duration, internal []*net.IPNet) *Health {
+	return &Health{timeout: timeout, internal: internal}
+}
+
+// AddLiveness registers a check that restarts the process when failing.
+// Only register checks that a restart can actually fix.
+func (h *Health) AddLiveness(name string, c Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness = append(h.liveness, namedChecker{name, c})
+}
+
+// AddReadiness registers a check that takes the instance out of rotation when failing
+func (h *Health) AddReadiness(name string, c Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness = append(h.readiness, namedChecker{name, c})
+}
+
+// Live runs the liveness checks
+func (h *Health) Live(ctx context.Context) Report {
+	h.mu.RLock()
+	checks := h.liveness
+	h.mu.RUnlock()
+	return h.run(ctx, checks)
+}
+
+// Drain makes readiness fail from now on, so that the instance is taken out
+// of rotation before it stops serving
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Ready runs the readiness checks. Once Drain has been called it fails
+// without running them.
+func (h *Health) Ready(ctx context.Context) Report {
+	if h.draining.Load() {
+		return Report{Status: StatusFail, Checks: map[string]Result{
+			"shutdown": {Status: StatusFail, Duration: "0s", Error: "shutting down"},
+		}}
+	}
+	h.mu.RLock()
+	checks := h.readiness
+	h.mu.RUnlock()
+	return h.run(ctx, checks)
+}
+
+// LivenessHandler serves the result of Live
+func (h *Health) LivenessHandler() http.Handler {
+	return h.handler(h.Live)
+}
+
+// ReadinessHandler serves the result of Ready
+func (h *Health) ReadinessHandler() http.Handler {
+	return h.handler(h.Ready)
+}
+
+func (h *Health) run(ctx context.Context, checks []namedChecker) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c namedChecker) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.checker.Check(ctx)
+			result := Result{Status: StatusOK, Duration: time.Since(start).String()}
+			if err != nil {
+				result.Status = StatusFail
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.name] = result
+			if err != nil {
+				report.Status = StatusFail
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func (h *Health) handler(run func(context.Context) Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := run(r.Context())
+
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+
+		// Check names and errors describe our infrastructure, so external
+		// callers only learn the overall status.
+		if r.URL.Query().Get("verbose") == "" || !h.isInternal(r) {
+			report.Checks = nil
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+// isInternal reports whether the direct peer of r is in an internal network.
+// Forwarding headers are ignored since any client can set them.
+func (h *Health) isInternal(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range h.internal {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCIDRs parses a list of CIDR blocks
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
@@ -0,0 +1,111 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHealth(t *testing.T) *Health {
+	internal, err := ParseCIDRs([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	return New(50*time.Millisecond, internal)
+}
+
+func serve(h http.Handler, remoteAddr, target string) (*httptest.ResponseRecorder, Report) {
+	req := httptest.NewRequest("GET", target, nil)
+	req.RemoteAddr = remoteAddr
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, req)
+
+	var report Report
+	json.Unmarshal(recorder.Body.Bytes(), &report)
+	return recorder, report
+}
+
+func TestReadinessFailsOnFailingCheck(t *testing.T) {
+	h := newTestHealth(t)
+	h.AddReadiness("ok", CheckerFunc(func(ctx context.Context) error { return nil }))
+	h.AddReadiness("mysql", CheckerFunc(func(ctx context.Context) error { return errors.New("down") }))
+
+	recorder, report := serve(h.ReadinessHandler(), "10.1.2.3:1234", "/readyz?verbose=1")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, "down", report.Checks["mysql"].Error)
+	assert.Equal(t, StatusOK, report.Checks["ok"].Status)
+
+	// Liveness is independent of readiness
+	recorder, report = serve(h.LivenessHandler(), "10.1.2.3:1234", "/livez")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, StatusOK, report.Status)
+}
+
+func TestReadinessFailsWhileDraining(t *testing.T) {
+	h := newTestHealth(t)
+	ran := false
+	h.AddReadiness("mysql", CheckerFunc(func(ctx context.Context) error { ran = true; return nil }))
+	h.Drain()
+
+	recorder, report := serve(h.ReadinessHandler(), "10.1.2.3:1234", "/readyz?verbose=1")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "shutting down", report.Checks["shutdown"].Error)
+	assert.False(t, ran)
+
+	recorder, _ = serve(h.LivenessHandler(), "10.1.2.3:1234", "/livez")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestDetailsOnlyForInternalCallers(t *testing.T) {
+	h := newTestHealth(t)
+	h.AddReadiness("mysql", CheckerFunc(func(ctx context.Context) error { return errors.New("dial tcp 10.0.0.5:3306") }))
+
+	_, report := serve(h.ReadinessHandler(), "203.0.113.7:1234", "/readyz?verbose=1")
+	assert.Nil(t, report.Checks)
+
+	_, report = serve(h.ReadinessHandler(), "10.0.0.9:1234", "/readyz")
+	assert.Nil(t, report.Checks)
+
+	_, report = serve(h.ReadinessHandler(), "10.0.0.9:1234", "/readyz?verbose=1")
+	assert.Contains(t, report.Checks, "mysql")
+}
+
+func TestCheckTimeout(t *testing.T) {
+	h := newTestHealth(t)
+	h.AddReadiness("slow", CheckerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	report := h.Ready(context.Background())
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Contains(t, report.Checks["slow"].Error, "deadline exceeded")
+}
+
+func TestPoolSaturation(t *testing.T) {
+	stats := sql.DBStats{MaxOpenConnections: 10, InUse: 9}
+	c := PoolSaturation(func() sql.DBStats { return stats }, 0.9)
+	assert.Error(t, c.Check(context.Background()))
+
+	stats.InUse = 5
+	assert.NoError(t, c.Check(context.Background()))
+
+	stats = sql.DBStats{InUse: 100}
+	assert.NoError(t, c.Check(context.Background()))
+}
+
+func TestMigrations(t *testing.T) {
+	pending := 2
+	c := Migrations(func(ctx context.Context) (int, error) { return pending, nil })
+	assert.EqualError(t, c.Check(context.Background()), "2 schema migrations pending")
+
+	pending = 0
+	assert.NoError(t, c.Check(context.Background()))
+}
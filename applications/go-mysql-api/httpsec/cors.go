@@ -0,0 +1,140 @@
+package httpsec
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures cross-origin access for browser clients
+type CORSOptions struct {
+	// AllowedOrigins are the origins, e.g. https://admin.example.com, that
+	// may call the API; "*" allows any. Empty disables CORS.
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders are the request headers a cross-origin request may
+	// set, matched case-insensitively
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight result
+	MaxAge time.Duration
+}
+
+// cors is the prepared form of CORSOptions
+type cors struct {
+	opts    CORSOptions
+	any     bool
+	origins map[string]bool
+	methods map[string]bool
+	headers map[string]bool
+	allowed string
+	exposed string
+	maxAge  string
+}
+
+// CORS returns middleware answering preflight requests and adding the CORS
+// headers to the responses for allowed origins. Like Headers it must wrap
+// the router: preflight OPTIONS requests match no route.
+func CORS(opts CORSOptions) func(http.Handler) http.Handler {
+	c := &cors{
+		opts:    opts,
+		origins: make(map[string]bool),
+		methods: make(map[string]bool),
+		headers: make(map[string]bool),
+		allowed: strings.Join(opts.AllowedMethods, ", "),
+		exposed: strings.Join(opts.ExposedHeaders, ", "),
+	}
+	for _, o := range opts.AllowedOrigins {
+		if o == "*" {
+			c.any = true
+		}
+		c.origins[strings.TrimSuffix(o, "/")] = true
+	}
+	for _, m := range opts.AllowedMethods {
+		c.methods[strings.ToUpper(m)] = true
+	}
+	for _, h := range opts.AllowedHeaders {
+		c.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	if opts.MaxAge > 0 {
+		c.maxAge = strconv.FormatInt(int64(opts.MaxAge/time.Second), 10)
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(opts.AllowedOrigins) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				c.preflight(w, r, origin)
+				return
+			}
+			if origin != "" && c.allowOrigin(origin) {
+				c.setOrigin(w, origin)
+				if c.exposed != "" {
+					w.Header().Set("Access-Control-Expose-Headers", c.exposed)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// preflight answers an OPTIONS request asking whether the actual request
+// may be sent
+func (c *cors) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	h := w.Header()
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	if origin == "" || !c.allowOrigin(origin) || !c.methods[strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))] || !c.allowHeaders(r.Header.Get("Access-Control-Request-Headers")) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	c.setOrigin(w, origin)
+	h.Set("Access-Control-Allow-Methods", c.allowed)
+	if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+		// Every requested header was checked, so echoing them is exact
+		h.Set("Access-Control-Allow-Headers", requested)
+	}
+	if c.maxAge != "" {
+		h.Set("Access-Control-Max-Age", c.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *cors) allowOrigin(origin string) bool {
+	return c.any || c.origins[origin]
+}
+
+// allowHeaders reports whether every header in the comma separated list is
+// allowed
+func (c *cors) allowHeaders(list string) bool {
+	for _, h := range strings.Split(list, ",") {
+		h = strings.TrimSpace(h)
+		if h != "" && !c.headers[http.CanonicalHeaderKey(h)] {
+			return false
+		}
+	}
+	return true
+}
+
+// setOrigin allows origin to read the response. Credentialed requests need
+// the exact origin rather than "*".
+func (c *cors) setOrigin(w http.ResponseWriter, origin string) {
+	h := w.Header()
+	if c.any && !c.opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if c.opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
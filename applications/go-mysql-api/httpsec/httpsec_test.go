@@ -0,0 +1,129 @@
+package httpsec
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func TestHeaders(t *testing.T) {
+	h := Headers(HeaderPolicy{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		ContentSecurityPolicy: "default-src 'none'",
+		ReferrerPolicy:        "no-referrer",
+		FrameOptions:          "DENY",
+		NoStorePaths:          []string{"/users", "/auth/"},
+	})(ok)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/users/1", nil))
+	assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "0", rec.Header().Get("X-XSS-Protection"))
+	assert.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "max-age=31536000; includeSubDomains", rec.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "default-src 'none'", rec.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "no-referrer", rec.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/auth/login", nil))
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	// Only whole path segments match
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/usersettings", nil))
+	assert.Empty(t, rec.Header().Get("Cache-Control"))
+
+	rec = httptest.NewRecorder()
+	Headers(HeaderPolicy{})(ok).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Empty(t, rec.Header().Get("Strict-Transport-Security"))
+	assert.Empty(t, rec.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+}
+
+func testCORS(opts CORSOptions) http.Handler {
+	if opts.AllowedMethods == nil {
+		opts.AllowedMethods = []string{"GET", "POST", "DELETE"}
+	}
+	if opts.AllowedHeaders == nil {
+		opts.AllowedHeaders = []string{"Authorization", "Content-Type"}
+	}
+	return CORS(opts)(ok)
+}
+
+func preflight(h http.Handler, origin, method, headers string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("OPTIONS", "/users", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		req.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCORSPreflight(t *testing.T) {
+	h := testCORS(CORSOptions{
+		AllowedOrigins:   []string{"https://admin.example.com"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+
+	rec := preflight(h, "https://admin.example.com", "DELETE", "authorization, content-type")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://admin.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, POST, DELETE", rec.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "authorization, content-type", rec.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+	assert.Contains(t, rec.Header().Values("Vary"), "Origin")
+
+	for name, rec := range map[string]*httptest.ResponseRecorder{
+		"origin":  preflight(h, "https://evil.example.com", "GET", ""),
+		"method":  preflight(h, "https://admin.example.com", "PATCH", ""),
+		"headers": preflight(h, "https://admin.example.com", "GET", "X-Custom"),
+	} {
+		assert.Equal(t, http.StatusForbidden, rec.Code, name)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"), name)
+	}
+}
+
+func TestCORSActualRequest(t *testing.T) {
+	h := testCORS(CORSOptions{
+		AllowedOrigins: []string{"https://admin.example.com"},
+		ExposedHeaders: []string{"ETag", "X-Request-ID"},
+	})
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Origin", "https://admin.example.com")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, "https://admin.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "ETag, X-Request-ID", rec.Header().Get("Access-Control-Expose-Headers"))
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Credentials"))
+
+	// Other origins are served without CORS headers, so browsers hide the response
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSWildcardAndDisabled(t *testing.T) {
+	rec := preflight(testCORS(CORSOptions{AllowedOrigins: []string{"*"}}), "https://any.example.com", "GET", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	// Without origins preflights reach the router, which rejects them
+	rec = preflight(testCORS(CORSOptions{}), "https://admin.example.com", "GET", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
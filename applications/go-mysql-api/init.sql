@@ -2,22 +2,22 @@
 CREATE DATABASE IF NOT EXISTS goapp_users;
 USE goapp_users;
 
--- Create users table
+-- Create users table so the seed data below can be inserted. The schema is
+-- owned by the application's migrations (migrate/migrations); this must
+-- match 0001_create_users.up.sql, which adopts the table on first start.
 CREATE TABLE IF NOT EXISTS users (
     id INT AUTO_INCREMENT PRIMARY KEY,
     username VARCHAR(50) UNIQUE NOT NULL,
     email VARCHAR(100) UNIQUE NOT NULL,
     password VARCHAR(255) NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_created_at (created_at)
 );
 
-CREATE INDEX idx_username ON users(username);
-CREATE INDEX idx_email ON users(email);
-CREATE INDEX idx_created_at ON users(created_at);
-
 -- Insert some test data (optional)
+-- Passwords are argon2id hashes of admin123 and password123
 INSERT INTO users (username, email, password) VALUES 
-    ('admin', 'admin@example.com', 'admin123'),
-    ('user1', 'user1@example.com', 'password123')
+    ('admin', 'admin@example.com', '$argon2id$v=19$m=65536,t=3,p=2$GI2mTYkXCNur/nvxG0MkYQ$tM7eAbWHwhezG1PbuH+oMyovjOHDkkWCCn9r5Y9ONnA'),
+    ('user1', 'user1@example.com', '$argon2id$v=19$m=65536,t=3,p=2$qcKPr7HWNjqOvQWcuPx6TQ$ONyUfqeowC1X0zzw/rQmFv/nv788cYTW/OY2ae4DJCI')
 ON DUPLICATE KEY UPDATE updated_at = CURRENT_TIMESTAMP;
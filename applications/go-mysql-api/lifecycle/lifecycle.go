@@ -0,0 +1,149 @@
+// Package lifecycle runs the HTTP server until the process is asked to stop
+// and then shuts it down in stages, the way Kubernetes expects: readiness
+// fails first, the endpoints controller gets time to take the pod out of
+// rotation, in-flight requests are drained and only then are the database
+// pool and telemetry exporters closed.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// stopper is a resource closed once the server has drained
+type stopper struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+// Manager serves an http.Server until SIGTERM or SIGINT
+type Manager struct {
+	server *http.Server
+
+	// Delay is how long the server keeps serving after readiness has
+	// failed, so that load balancers stop sending new requests
+	Delay time.Duration
+	// Timeout bounds draining in-flight requests and running the OnStop
+	// functions. Delay plus Timeout should fit in the pod's
+	// terminationGracePeriodSeconds.
+	Timeout time.Duration
+	// Signals start the shutdown; SIGTERM and SIGINT by default
+	Signals []os.Signal
+
+	drain    []func()
+	stoppers []stopper
+}
+
+// New returns a Manager for srv
+func New(srv *http.Server, delay, timeout time.Duration) *Manager {
+	return &Manager{
+		server:  srv,
+		Delay:   delay,
+		Timeout: timeout,
+		Signals: []os.Signal{syscall.SIGTERM, os.Interrupt},
+	}
+}
+
+// OnDrain registers fn to run as soon as shutdown starts, e.g. to fail
+// readiness
+func (m *Manager) OnDrain(fn func()) {
+	m.drain = append(m.drain, fn)
+}
+
+// OnStop registers fn to run once the server has drained. Stop functions run
+// in registration order, sharing what is left of Timeout.
+func (m *Manager) OnStop(name string, fn func(ctx context.Context) error) {
+	m.stoppers = append(m.stoppers, stopper{name: name, stop: fn})
+}
+
+// Run listens on the server's address and serves until ctx is done or a
+// signal arrives, then shuts down
+func (m *Manager) Run(ctx context.Context) error {
+	addr := m.server.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		m.stop(context.Background())
+		return err
+	}
+	return m.Serve(ctx, ln)
+}
+
+// Serve serves on ln until ctx is done or a signal arrives, then shuts
+// down. The server speaks TLS when it has a TLSConfig. It returns the error that stopped the server early, if any, or the
+// error of the first stage of the shutdown that failed.
+func (m *Manager) Serve(ctx context.Context, ln net.Listener) error {
+	ctx, cancel := signal.NotifyContext(ctx, m.Signals...)
+	defer cancel()
+
+	served := make(chan error, 1)
+	go func() {
+		if m.server.TLSConfig != nil {
+			// The certificates come from TLSConfig
+			served <- m.server.ServeTLS(ln, "", "")
+			return
+		}
+		served <- m.server.Serve(ln)
+	}()
+
+	select {
+	case err := <-served:
+		// The listener failed; nothing is left to drain
+		m.stop(context.Background())
+		return err
+	case <-ctx.Done():
+	}
+	// A second signal stops waiting for the delay and the drain
+	cancel()
+	force, stopForce := signal.NotifyContext(context.Background(), m.Signals...)
+	defer stopForce()
+
+	slog.Info("shutting down", "delay", m.Delay, "timeout", m.Timeout)
+	for _, fn := range m.drain {
+		fn()
+	}
+
+	timer := time.NewTimer(m.Delay)
+	select {
+	case <-timer.C:
+	case <-force.Done():
+		timer.Stop()
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(force, m.Timeout)
+	defer cancelShutdown()
+
+	var errs []error
+	if err := m.server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("requests still in flight at shutdown deadline", "error", err)
+		m.server.Close()
+		errs = append(errs, err)
+	}
+	if err := <-served; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		errs = append(errs, err)
+	}
+	errs = append(errs, m.stop(shutdownCtx))
+	slog.Info("shutdown complete")
+	return errors.Join(errs...)
+}
+
+// stop runs the OnStop functions in order
+func (m *Manager) stop(ctx context.Context) error {
+	var errs []error
+	for _, s := range m.stoppers {
+		if err := s.stop(ctx); err != nil {
+			slog.Error("shutdown: stopping", "resource", s.name, "error", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,144 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// events records the order of shutdown steps
+type events struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (e *events) add(s string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.list = append(e.list, s)
+}
+
+func (e *events) get() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.list...)
+}
+
+func listen(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return ln
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	var ev events
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		ev.add("request done")
+		io.WriteString(w, "ok")
+	})}
+
+	m := New(srv, 100*time.Millisecond, 5*time.Second)
+	m.OnDrain(func() { ev.add("drain") })
+	m.OnStop("db", func(ctx context.Context) error { ev.add("db"); return nil })
+	m.OnStop("tracing", func(ctx context.Context) error { ev.add("tracing"); return nil })
+
+	ln := listen(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Serve(ctx, ln) }()
+
+	resp := make(chan *http.Response, 1)
+	go func() {
+		r, err := http.Get("http://" + ln.Addr().String())
+		assert.NoError(t, err)
+		resp <- r
+	}()
+	<-started
+
+	start := time.Now()
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	// The in-flight request holds the shutdown until it completes
+	assert.Equal(t, []string{"drain"}, ev.get())
+	close(release)
+
+	require.NoError(t, <-done)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, []string{"drain", "request done", "db", "tracing"}, ev.get())
+
+	r := <-resp
+	require.NotNil(t, r)
+	assert.Equal(t, http.StatusOK, r.StatusCode)
+	r.Body.Close()
+}
+
+func TestServeGivesUpAfterTimeout(t *testing.T) {
+	var ev events
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})}
+
+	m := New(srv, 0, 50*time.Millisecond)
+	m.OnStop("db", func(ctx context.Context) error { ev.add("db"); return nil })
+
+	ln := listen(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Serve(ctx, ln) }()
+	go http.Get("http://" + ln.Addr().String())
+	<-started
+
+	cancel()
+	err := <-done
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	// Resources are closed even when requests did not finish in time
+	assert.Equal(t, []string{"db"}, ev.get())
+}
+
+func TestServeStopsOnSignal(t *testing.T) {
+	var ev events
+	m := New(&http.Server{Handler: http.NotFoundHandler()}, 0, time.Second)
+	m.Signals = []os.Signal{syscall.SIGUSR1}
+	m.OnDrain(func() { ev.add("drain") })
+
+	done := make(chan error, 1)
+	go func() { done <- m.Serve(context.Background(), listen(t)) }()
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not stop on signal")
+	}
+	assert.Equal(t, []string{"drain"}, ev.get())
+}
+
+func TestServeReportsListenerErrors(t *testing.T) {
+	var ev events
+	m := New(&http.Server{Handler: http.NotFoundHandler()}, time.Hour, time.Hour)
+	m.OnStop("db", func(ctx context.Context) error { ev.add("db"); return errors.New("close failed") })
+
+	ln := listen(t)
+	ln.Close()
+	err := m.Serve(context.Background(), ln)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"db"}, ev.get())
+}
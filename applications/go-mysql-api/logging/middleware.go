@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits inbound request IDs to what is safe to log and echo
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestLog collects the attributes of one request
+type requestLog struct {
+	base *slog.Logger
+	id   string
+
+	mu    sync.Mutex
+	attrs []any
+}
+
+type requestLogKey struct{}
+
+// Middleware assigns every request an ID, taken from a valid inbound
+// X-Request-ID or generated, echoes it in the response and logs the request
+// when it completes with its route, status and latency. Register it with
+// Router.Use so that the matched route is known.
+func Middleware(logger *slog.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID.MatchString(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				if tmpl, err := current.GetPathTemplate(); err == nil {
+					route = tmpl
+				}
+			}
+
+			rl := &requestLog{base: logger, id: id, attrs: []any{slog.String("request_id", id), slog.String("route", route)}}
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestLogKey{}, rl)))
+
+			level := slog.LevelInfo
+			if rec.status >= 500 {
+				level = slog.LevelError
+			}
+			rl.logger().LogAttrs(r.Context(), level, "request",
+				slog.String("method", r.Method),
+				slog.Int("status", rec.status),
+				slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			)
+		})
+	}
+}
+
+func (rl *requestLog) logger() *slog.Logger {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.base.With(rl.attrs...)
+}
+
+// FromContext returns a logger carrying the attributes of the request in
+// ctx, or the default logger outside of requests
+func FromContext(ctx context.Context) *slog.Logger {
+	if rl, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		return rl.logger()
+	}
+	return slog.Default()
+}
+
+// AddAttrs adds attributes, such as the authenticated user, to every later
+// log line of the request in ctx, including the final request line
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	rl, ok := ctx.Value(requestLogKey{}).(*requestLog)
+	if !ok {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for _, a := range attrs {
+		rl.attrs = append(rl.attrs, a)
+	}
+}
+
+// RequestID returns the ID of the request in ctx
+func RequestID(ctx context.Context) string {
+	if rl, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		return rl.id
+	}
+	return ""
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
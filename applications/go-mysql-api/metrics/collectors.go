@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"database/sql"
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dbStatsCollector exports sql.DBStats. It reads the stats through a
+// function so it keeps following the current pool when it is replaced.
+type dbStatsCollector struct {
+	stats func() sql.DBStats
+
+	maxOpen      *prometheus.Desc
+	open         *prometheus.Desc
+	inUse        *prometheus.Desc
+	idle         *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+}
+
+// NewDBStatsCollector returns a collector for the pool statistics of the
+// database named dbName
+func NewDBStatsCollector(dbName string, stats func() sql.DBStats) prometheus.Collector {
+	labels := prometheus.Labels{"db_name": dbName}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("db", "pool", name), help, nil, labels)
+	}
+
+	return &dbStatsCollector{
+		stats:        stats,
+		maxOpen:      desc("max_open_connections", "Maximum number of open connections to the database."),
+		open:         desc("open_connections", "Number of established connections, both in use and idle."),
+		inUse:        desc("in_use_connections", "Number of connections currently in use."),
+		idle:         desc("idle_connections", "Number of idle connections."),
+		waitCount:    desc("wait_count_total", "Total number of connections waited for."),
+		waitDuration: desc("wait_duration_seconds_total", "Total time blocked waiting for a new connection."),
+	}
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(s.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(s.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(s.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(s.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, s.WaitDuration.Seconds())
+}
+
+// NewBuildInfo returns a constant gauge identifying the running build
+func NewBuildInfo(version, commit string) prometheus.Collector {
+	g := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "build_info",
+		Help: "Build information of the running binary, always 1.",
+		ConstLabels: prometheus.Labels{
+			"version":   version,
+			"commit":    commit,
+			"goversion": runtime.Version(),
+		},
+	})
+	g.Set(1)
+	return g
+}
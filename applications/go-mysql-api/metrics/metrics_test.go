@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareUsesRouteTemplate(t *testing.T) {
+	m := New()
+	r := mux.NewRouter()
+	r.Use(m.Middleware)
+	r.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+
+	for _, path := range []string{"/users/1", "/users/2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues("/users/{id}", "GET", "404")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.inFlight.WithLabelValues("/users/{id}", "GET")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.duration))
+}
+
+func TestHandlerExposesCollectors(t *testing.T) {
+	m := New()
+	stats := sql.DBStats{MaxOpenConnections: 10, OpenConnections: 4, InUse: 3, Idle: 1, WaitCount: 7, WaitDuration: 2 * time.Second}
+	require.NoError(t, m.Register(
+		NewDBStatsCollector("users", func() sql.DBStats { return stats }),
+		NewBuildInfo("1.2.3", "abc123"),
+	))
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+
+	for _, want := range []string{
+		`db_pool_in_use_connections{db_name="users"} 3`,
+		`db_pool_idle_connections{db_name="users"} 1`,
+		`db_pool_wait_count_total{db_name="users"} 7`,
+		`db_pool_wait_duration_seconds_total{db_name="users"} 2`,
+		`build_info{commit="abc123"`,
+		`go_goroutines`,
+	} {
+		assert.True(t, strings.Contains(body, want), "missing %s", want)
+	}
+}
@@ -0,0 +1,346 @@
+// Package migrate applies the numbered SQL migrations embedded in the
+// binary and records them in the schema_migrations table.
+//
+// Migration files are named <version>_<name>.up.sql and
+// <version>_<name>.down.sql. MySQL commits DDL implicitly, so every
+// migration is applied statement by statement and recorded only after all
+// of its statements succeeded.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+//go:embed migrations/*.sql
+var embedded embed.FS
+
+// DefaultLockName is the MySQL advisory lock held while migrating
+const DefaultLockName = "goapp_schema_migrations"
+
+// ErrLockTimeout is returned when another instance holds the migration lock
+var ErrLockTimeout = errors.New("migrate: timed out waiting for migration lock")
+
+// Migration is one numbered schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes whether a migration has been applied
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// DB hands out dedicated connections; it is implemented by *sql.DB
+type DB interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+// Migrator applies migrations to a MySQL database
+type Migrator struct {
+	db          DB
+	migrations  []Migration
+	LockName    string
+	LockTimeout time.Duration
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// New returns a Migrator for the migrations embedded in the binary
+func New(db DB) (*Migrator, error) {
+	sub, err := fs.Sub(embedded, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return NewFromFS(db, sub)
+}
+
+// NewFromFS returns a Migrator for the migration files in the root of fsys
+func NewFromFS(db DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:          db,
+		migrations:  migrations,
+		LockName:    DefaultLockName,
+		LockTimeout: time.Minute,
+	}, nil
+}
+
+// Load reads and orders the migration files in the root of fsys
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		m := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s: %w", entry.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, path.Clean(entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migrate: version %d used by %q and %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if strings.TrimSpace(mig.Up) == "" {
+			return nil, fmt.Errorf("migrate: version %d has no up migration", mig.Version)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrations returns the known migrations in version order
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Up applies all pending migrations and returns the ones it applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			if err := execScript(ctx, conn, mig.Up); err != nil {
+				return fmt.Errorf("migrate: applying %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			_, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", mig.Version, mig.Name)
+			if err != nil {
+				return fmt.Errorf("migrate: recording %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the latest steps applied migrations and returns the ones it reverted
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			if strings.TrimSpace(mig.Down) == "" {
+				return fmt.Errorf("migrate: %d_%s has no down migration", mig.Version, mig.Name)
+			}
+			if err := execScript(ctx, conn, mig.Down); err != nil {
+				return fmt.Errorf("migrate: reverting %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", mig.Version); err != nil {
+				return fmt.Errorf("migrate: unrecording %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every known migration together with when it was applied.
+// It only reads schema_migrations, so readiness checks need no DDL
+// privileges; a missing table means nothing has been applied yet.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	done, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Migration: mig}
+		if at, ok := done[mig.Version]; ok {
+			at := at
+			s.AppliedAt = &at
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// Pending returns the number of migrations not applied yet
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// withLock runs fn on a single connection holding the advisory lock, so
+// replicas starting at the same time do not apply migrations twice
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var got sql.NullInt64
+	timeout := int(m.LockTimeout / time.Second)
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", m.LockName, timeout).Scan(&got); err != nil {
+		return fmt.Errorf("migrate: acquiring lock: %w", err)
+	}
+	if !got.Valid || got.Int64 != 1 {
+		return ErrLockTimeout
+	}
+	defer func() {
+		// Release on a fresh context so a cancelled ctx does not leave the lock held
+		_, releaseErr := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", m.LockName)
+		if err == nil && releaseErr != nil {
+			err = fmt.Errorf("migrate: releasing lock: %w", releaseErr)
+		}
+	}()
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("migrate: creating schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// errNoSuchTable is MySQL's ER_NO_SUCH_TABLE
+const errNoSuchTable = 1146
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errNoSuchTable {
+		return map[int64]time.Time{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = appliedAt
+	}
+	return done, rows.Err()
+}
+
+func execScript(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, stmt := range SplitStatements(script) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SplitStatements splits a migration script into single statements so it
+// runs without the driver's multiStatements option. Statements end with a
+// semicolon at the end of a line; lines starting with -- are comments.
+func SplitStatements(script string) []string {
+	var stmts []string
+	var current strings.Builder
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+
+		if strings.HasSuffix(trimmed, ";") {
+			stmt := strings.TrimSuffix(strings.TrimSpace(current.String()), ";")
+			stmts = append(stmts, stmt)
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
@@ -0,0 +1,155 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	m, err := New(nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, m.Migrations())
+
+	for i, mig := range m.Migrations() {
+		assert.Equal(t, int64(i+1), mig.Version, "migrations must be numbered without gaps")
+		assert.NotEmpty(t, mig.Down, "%d_%s has no down migration", mig.Version, mig.Name)
+	}
+}
+
+func TestLoadOrdersByVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0010_add_index.up.sql":   {Data: []byte("CREATE INDEX i ON t(c);")},
+		"0002_create_t.up.sql":    {Data: []byte("CREATE TABLE t (c INT);")},
+		"0002_create_t.down.sql":  {Data: []byte("DROP TABLE t;")},
+		"README.md":               {Data: []byte("ignored")},
+		"0010_add_index.down.sql": {Data: []byte("DROP INDEX i ON t;")},
+	}
+
+	migrations, err := Load(fsys)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, int64(2), migrations[0].Version)
+	assert.Equal(t, "create_t", migrations[0].Name)
+	assert.Equal(t, "DROP TABLE t;", migrations[0].Down)
+	assert.Equal(t, int64(10), migrations[1].Version)
+}
+
+func TestLoadRejectsInvalidSets(t *testing.T) {
+	_, err := Load(fstest.MapFS{
+		"0001_a.up.sql": {Data: []byte("SELECT 1;")},
+		"0001_b.up.sql": {Data: []byte("SELECT 2;")},
+	})
+	assert.Error(t, err)
+
+	_, err = Load(fstest.MapFS{
+		"0001_a.down.sql": {Data: []byte("SELECT 1;")},
+	})
+	assert.Error(t, err)
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- comment
+CREATE TABLE t (
+    c VARCHAR(10) DEFAULT 'a;b'
+);
+
+CREATE INDEX i ON t(c);
+INSERT INTO t VALUES ('x')`
+
+	stmts := SplitStatements(script)
+	require.Len(t, stmts, 3)
+	assert.Equal(t, "CREATE TABLE t (\n    c VARCHAR(10) DEFAULT 'a;b'\n)", stmts[0])
+	assert.Equal(t, "CREATE INDEX i ON t(c)", stmts[1])
+	assert.Equal(t, "INSERT INTO t VALUES ('x')", stmts[2])
+}
+
+// recordingConn answers the schema_migrations query and records every
+// statement it receives
+type recordingConn struct {
+	applied    map[int64]time.Time
+	noTable    bool
+	statements *[]string
+}
+
+func (c recordingConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c recordingConn) Driver() driver.Driver                        { return nil }
+func (c recordingConn) Prepare(string) (driver.Stmt, error)          { return nil, driver.ErrSkip }
+func (c recordingConn) Close() error                                 { return nil }
+func (c recordingConn) Begin() (driver.Tx, error)                    { return nil, driver.ErrSkip }
+
+func (c recordingConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	*c.statements = append(*c.statements, query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c recordingConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	*c.statements = append(*c.statements, query)
+	if c.noTable {
+		return nil, &mysql.MySQLError{Number: 1146, Message: "Table 'app.schema_migrations' doesn't exist"}
+	}
+	rows := &versionRows{}
+	for version, at := range c.applied {
+		rows.values = append(rows.values, []driver.Value{version, at})
+	}
+	return rows, nil
+}
+
+type versionRows struct{ values [][]driver.Value }
+
+func (r *versionRows) Columns() []string { return []string{"version", "applied_at"} }
+func (r *versionRows) Close() error      { return nil }
+
+func (r *versionRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func newRecordingMigrator(t *testing.T, conn recordingConn) *Migrator {
+	db := sql.OpenDB(conn)
+	t.Cleanup(func() { db.Close() })
+
+	m, err := NewFromFS(db, fstest.MapFS{
+		"0001_a.up.sql": {Data: []byte("CREATE TABLE a (c INT);")},
+		"0002_b.up.sql": {Data: []byte("CREATE TABLE b (c INT);")},
+	})
+	require.NoError(t, err)
+	return m
+}
+
+func TestPendingIsReadOnly(t *testing.T) {
+	var statements []string
+	m := newRecordingMigrator(t, recordingConn{
+		applied:    map[int64]time.Time{1: time.Now()},
+		statements: &statements,
+	})
+
+	n, err := m.Pending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	for _, stmt := range statements {
+		assert.Regexp(t, `^SELECT `, stmt)
+	}
+}
+
+func TestPendingWithoutMigrationsTable(t *testing.T) {
+	var statements []string
+	m := newRecordingMigrator(t, recordingConn{noTable: true, statements: &statements})
+
+	n, err := m.Pending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Len(t, statements, 1)
+}
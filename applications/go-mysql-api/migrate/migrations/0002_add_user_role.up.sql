@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user' AFTER password;
+
+-- The admin account seeded by init.sql was always meant to administer the API
+UPDATE users SET role = 'admin' WHERE username = 'admin';
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) UNIQUE NOT NULL,
+    secret_hash CHAR(64) NOT NULL,
+    scopes VARCHAR(255) NOT NULL DEFAULT '',
+    created_by INT NULL,
+    expires_at TIMESTAMP NULL DEFAULT NULL,
+    last_used_at TIMESTAMP NULL DEFAULT NULL,
+    revoked_at TIMESTAMP NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+-- Row version for optimistic concurrency control; exposed as the ETag
+ALTER TABLE users ADD COLUMN version INT NOT NULL DEFAULT 1 AFTER role;
@@ -66,6 +66,27 @@ Create the name of the service account to use
 
 
 
+{{/*
+Name of the ConfigMap holding app.conf
+*/}}
+{{- define "go-mysql-api.configMapName" -}}
+{{- .Values.configMap.name | default (printf "%s-config" (include "go-mysql-api.fullname" .)) }}
+{{- end }}
+
+{{/*
+Name of the Secret JWT_SECRET is read from. Empty when the secret comes from
+Vault (vault.secrets.jwt) or is set directly through env.JWT_SECRET.
+*/}}
+{{- define "go-mysql-api.jwtSecretName" -}}
+{{- if .Values.vault.enabled }}
+{{- if not .Values.vault.secrets.jwt }}
+{{- .Values.jwt.existingSecret | default (printf "%s-jwt" (include "go-mysql-api.fullname" .)) }}
+{{- end }}
+{{- else if not .Values.env.JWT_SECRET }}
+{{- .Values.jwt.existingSecret | default (printf "%s-jwt" (include "go-mysql-api.fullname" .)) }}
+{{- end }}
+{{- end }}
+
 {{/*
 Create the name of the image to use
 */}}
@@ -0,0 +1,118 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// Upper limits on argon2id parameters, enforced when hashing and when
+// verifying stored hashes. Zero passes or threads make argon2.IDKey panic,
+// and a huge memory cost would let a single bad row exhaust the server's
+// memory.
+const (
+	MaxArgon2idMemory  = 1024 * 1024 // 1 GiB in KiB
+	MaxArgon2idTime    = 16
+	MaxArgon2idThreads = 64
+)
+
+// validArgon2idParams reports whether the parameters are within the limits
+func validArgon2idParams(memory, time uint32, threads uint8) bool {
+	return memory > 0 && memory <= MaxArgon2idMemory &&
+		time > 0 && time <= MaxArgon2idTime &&
+		threads > 0 && threads <= MaxArgon2idThreads
+}
+
+// Argon2id hashes passwords with argon2id and encodes them as
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>
+type Argon2id struct {
+	Memory  uint32 // memory in KiB
+	Time    uint32 // number of passes
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultArgon2id returns argon2id parameters following RFC 9106
+func DefaultArgon2id() *Argon2id {
+	return &Argon2id{
+		Memory:  64 * 1024,
+		Time:    3,
+		Threads: 2,
+		SaltLen: 16,
+		KeyLen:  32,
+	}
+}
+
+func (a *Argon2id) Hash(plain string) (string, error) {
+	if !validArgon2idParams(a.Memory, a.Time, a.Threads) || a.SaltLen == 0 || a.KeyLen == 0 {
+		return "", fmt.Errorf("password: argon2id parameters out of range: m=%d,t=%d,p=%d", a.Memory, a.Time, a.Threads)
+	}
+	salt := make([]byte, a.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("password: generating salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(plain), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *Argon2id) Verify(plain, encoded string) (match, rehash bool, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false, fmt.Errorf("%w: malformed argon2id hash", ErrUnknownFormat)
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, false, fmt.Errorf("%w: argon2id version: %v", ErrUnknownFormat, err)
+	}
+	if version != argon2.Version {
+		return false, false, fmt.Errorf("%w: unsupported argon2id version %d", ErrUnknownFormat, version)
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, false, fmt.Errorf("%w: argon2id parameters: %v", ErrUnknownFormat, err)
+	}
+	if !validArgon2idParams(memory, time, threads) {
+		return false, false, fmt.Errorf("%w: argon2id parameters out of range: m=%d,t=%d,p=%d", ErrUnknownFormat, memory, time, threads)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, fmt.Errorf("%w: argon2id salt: %v", ErrUnknownFormat, err)
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, fmt.Errorf("%w: argon2id hash: %v", ErrUnknownFormat, err)
+	}
+	if len(salt) == 0 || len(want) == 0 {
+		// An empty hash would match every password
+		return false, false, fmt.Errorf("%w: argon2id salt or hash is empty", ErrUnknownFormat)
+	}
+
+	got := argon2.IDKey([]byte(plain), salt, time, memory, threads, uint32(len(want)))
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return false, false, nil
+	}
+
+	rehash = memory != a.Memory || time != a.Time || threads != a.Threads ||
+		uint32(len(salt)) != a.SaltLen || uint32(len(want)) != a.KeyLen
+	return true, rehash, nil
+}
+
+func (a *Argon2id) Handles(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
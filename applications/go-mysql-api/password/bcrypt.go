@@ -0,0 +1,48 @@
+package password
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt hashes passwords with bcrypt in its standard $2b$<cost>$ encoding
+type Bcrypt struct {
+	Cost int
+}
+
+// DefaultBcrypt returns bcrypt with the library's default cost
+func DefaultBcrypt() *Bcrypt {
+	return &Bcrypt{Cost: bcrypt.DefaultCost}
+}
+
+func (b *Bcrypt) Hash(plain string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b *Bcrypt) Verify(plain, encoded string) (match, rehash bool, err error) {
+	err = bcrypt.CompareHashAndPassword([]byte(encoded), []byte(plain))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return false, false, err
+	}
+	return true, cost != b.Cost, nil
+}
+
+func (b *Bcrypt) Handles(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
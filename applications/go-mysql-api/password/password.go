@@ -0,0 +1,78 @@
+// Package password hashes and verifies user passwords using encoded
+// PHC-style strings so the algorithm and its cost parameters travel with
+// every stored hash.
+package password
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+)
+
+// ErrUnknownFormat is returned when a stored hash was not produced by any
+// registered Hasher
+var ErrUnknownFormat = errors.New("password: unknown hash format")
+
+// Hasher produces and verifies encoded password hashes for one algorithm
+type Hasher interface {
+	// Hash returns the encoded hash of plain.
+	Hash(plain string) (string, error)
+	// Verify reports whether plain matches encoded and whether encoded
+	// was produced with parameters other than the hasher's current ones.
+	Verify(plain, encoded string) (match, rehash bool, err error)
+	// Handles reports whether encoded uses this hasher's algorithm.
+	Handles(encoded string) bool
+}
+
+// Manager hashes new passwords with a preferred Hasher and verifies stored
+// hashes against any registered one. Hashes from a non-preferred hasher,
+// outdated parameters or legacy plaintext rows are flagged for rehashing.
+type Manager struct {
+	preferred Hasher
+	hashers   []Hasher
+}
+
+// NewManager returns a Manager hashing with preferred and additionally
+// accepting hashes produced by others
+func NewManager(preferred Hasher, others ...Hasher) *Manager {
+	return &Manager{
+		preferred: preferred,
+		hashers:   append([]Hasher{preferred}, others...),
+	}
+}
+
+// Default returns a Manager that hashes with argon2id and still accepts bcrypt
+func Default() *Manager {
+	return NewManager(DefaultArgon2id(), DefaultBcrypt())
+}
+
+// Hash returns the encoded hash of plain using the preferred hasher
+func (m *Manager) Hash(plain string) (string, error) {
+	return m.preferred.Hash(plain)
+}
+
+// Verify reports whether plain matches encoded and whether the caller should
+// store a fresh hash from Hash. An empty password never matches.
+func (m *Manager) Verify(plain, encoded string) (match, rehash bool, err error) {
+	if plain == "" || encoded == "" {
+		return false, false, nil
+	}
+
+	for _, h := range m.hashers {
+		if !h.Handles(encoded) {
+			continue
+		}
+		match, rehash, err = h.Verify(plain, encoded)
+		if err != nil || !match {
+			return false, false, err
+		}
+		return true, rehash || h != m.preferred, nil
+	}
+
+	// Rows written before hashing was introduced hold the password as-is.
+	if !strings.HasPrefix(encoded, "$") {
+		match = subtle.ConstantTimeCompare([]byte(plain), []byte(encoded)) == 1
+		return match, match, nil
+	}
+	return false, false, ErrUnknownFormat
+}
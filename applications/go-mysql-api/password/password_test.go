@@ -0,0 +1,142 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheap parameters keep the tests fast
+func testArgon2id() *Argon2id {
+	return &Argon2id{Memory: 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	h := testArgon2id()
+
+	encoded, err := h.Hash("s3cret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$"))
+	assert.True(t, h.Handles(encoded))
+
+	match, rehash, err := h.Verify("s3cret", encoded)
+	require.NoError(t, err)
+	assert.True(t, match)
+	assert.False(t, rehash)
+
+	match, _, err = h.Verify("wrong", encoded)
+	require.NoError(t, err)
+	assert.False(t, match)
+}
+
+func TestArgon2idRehashOnParameterChange(t *testing.T) {
+	old := testArgon2id()
+	encoded, err := old.Hash("s3cret")
+	require.NoError(t, err)
+
+	current := testArgon2id()
+	current.Time = 2
+	match, rehash, err := current.Verify("s3cret", encoded)
+	require.NoError(t, err)
+	assert.True(t, match)
+	assert.True(t, rehash)
+}
+
+func TestArgon2idRejectsUnsafeParameters(t *testing.T) {
+	h := testArgon2id()
+	const salt, key = "c2FsdHNhbHRzYWx0c2FsdA", "aGFzaGhhc2hoYXNoaGFzaGhhc2hoYXNoaGFzaGhhc2g"
+
+	cases := []struct {
+		name    string
+		encoded string
+	}{
+		{"zero time", "$argon2id$v=19$m=1024,t=0,p=1$" + salt + "$" + key},
+		{"zero threads", "$argon2id$v=19$m=1024,t=1,p=0$" + salt + "$" + key},
+		{"zero memory", "$argon2id$v=19$m=0,t=1,p=1$" + salt + "$" + key},
+		{"huge memory", "$argon2id$v=19$m=4294967295,t=1,p=1$" + salt + "$" + key},
+		{"huge time", "$argon2id$v=19$m=1024,t=100000,p=1$" + salt + "$" + key},
+		{"too many threads", "$argon2id$v=19$m=1024,t=1,p=255$" + salt + "$" + key},
+		{"empty hash", "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			match, _, err := h.Verify("s3cret", tc.encoded)
+			assert.ErrorIs(t, err, ErrUnknownFormat)
+			assert.False(t, match)
+		})
+	}
+}
+
+// Test that Hash refuses parameters its own Verify would reject
+func TestArgon2idHashRejectsUnsafeParameters(t *testing.T) {
+	for _, h := range []*Argon2id{
+		{Memory: 1024, Time: 0, Threads: 1, SaltLen: 16, KeyLen: 32},
+		{Memory: 1024, Time: MaxArgon2idTime + 1, Threads: 1, SaltLen: 16, KeyLen: 32},
+		{Memory: 1024, Time: 1, Threads: MaxArgon2idThreads + 1, SaltLen: 16, KeyLen: 32},
+		{Memory: MaxArgon2idMemory + 1, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32},
+		{Memory: 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 0},
+	} {
+		_, err := h.Hash("s3cret")
+		assert.ErrorContains(t, err, "out of range")
+	}
+
+	h := testArgon2id()
+	h.Time = MaxArgon2idTime
+	encoded, err := h.Hash("s3cret")
+	require.NoError(t, err)
+	match, _, err := h.Verify("s3cret", encoded)
+	require.NoError(t, err)
+	assert.True(t, match)
+}
+
+func TestBcryptRehashOnCostChange(t *testing.T) {
+	encoded, err := (&Bcrypt{Cost: bcrypt.MinCost}).Hash("s3cret")
+	require.NoError(t, err)
+
+	match, rehash, err := (&Bcrypt{Cost: bcrypt.MinCost + 1}).Verify("s3cret", encoded)
+	require.NoError(t, err)
+	assert.True(t, match)
+	assert.True(t, rehash)
+}
+
+func TestManagerVerify(t *testing.T) {
+	m := NewManager(testArgon2id(), &Bcrypt{Cost: bcrypt.MinCost})
+
+	argonHash, err := m.Hash("s3cret")
+	require.NoError(t, err)
+	bcryptHash, err := (&Bcrypt{Cost: bcrypt.MinCost}).Hash("s3cret")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		plain   string
+		encoded string
+		match   bool
+		rehash  bool
+		err     error
+	}{
+		{"preferred", "s3cret", argonHash, true, false, nil},
+		{"secondary hasher", "s3cret", bcryptHash, true, true, nil},
+		{"legacy plaintext", "admin123", "admin123", true, true, nil},
+		{"legacy plaintext mismatch", "nope", "admin123", false, false, nil},
+		{"empty password", "", "", false, false, nil},
+		{"wrong password", "nope", argonHash, false, false, nil},
+		{"unknown format", "s3cret", "$md5$abc", false, false, ErrUnknownFormat},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			match, rehash, err := m.Verify(test.plain, test.encoded)
+			if test.err != nil {
+				assert.ErrorIs(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, test.match, match)
+			assert.Equal(t, test.rehash, rehash)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Package ratelimit limits how often each client may call the API. Every
+// client has a token bucket per rate-limited route; a request takes a token
+// and is rejected with 429 when the bucket is empty. Buckets are kept in a
+// Store, in memory for a single replica or in Redis to share them.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket: Burst tokens, refilled at Rate per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit parses rate/period[:burst], e.g. 10/m or 5/s:20. The period is
+// s, m or h, optionally with a count such as 10/15m. The burst defaults to
+// the number of requests per period.
+func ParseLimit(s string) (Limit, error) {
+	spec, burstStr, hasBurst := strings.Cut(strings.TrimSpace(s), ":")
+	countStr, periodStr, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("ratelimit: invalid limit %q, expected rate/period[:burst]", s)
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count <= 0 {
+		return Limit{}, fmt.Errorf("ratelimit: invalid request count in %q", s)
+	}
+	period, err := parsePeriod(periodStr)
+	if err != nil {
+		return Limit{}, fmt.Errorf("ratelimit: invalid period in %q", s)
+	}
+	l := Limit{Rate: float64(count) / period.Seconds(), Burst: count}
+	if hasBurst {
+		l.Burst, err = strconv.Atoi(burstStr)
+		if err != nil || l.Burst <= 0 {
+			return Limit{}, fmt.Errorf("ratelimit: invalid burst in %q", s)
+		}
+	}
+	return l, nil
+}
+
+func parsePeriod(s string) (time.Duration, error) {
+	switch s {
+	case "s", "m", "h":
+		s = "1" + s
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid period %q", s)
+	}
+	return d, nil
+}
+
+// Policy assigns limits to routes
+type Policy struct {
+	// Disabled lets every request through
+	Disabled bool
+	// Default is the budget shared by the routes without their own
+	Default Limit
+	// Routes gives routes their own budget, keyed by "METHOD /template",
+	// e.g. "POST /users", or by the template alone for every method
+	Routes map[string]Limit
+	// TrustedProxies are the networks of the proxies in front of the API,
+	// whose X-Forwarded-For entries identify anonymous clients
+	TrustedProxies []*net.IPNet
+}
+
+// ParsePolicy builds a Policy from a default limit and route=limit entries
+// such as "POST /auth/login=5/m"
+func ParsePolicy(def string, routes []string) (Policy, error) {
+	l, err := ParseLimit(def)
+	if err != nil {
+		return Policy{}, err
+	}
+	p := Policy{Default: l, Routes: make(map[string]Limit, len(routes))}
+	for _, entry := range routes {
+		route, limit, ok := strings.Cut(entry, "=")
+		route = strings.Join(strings.Fields(route), " ")
+		if !ok || route == "" {
+			return Policy{}, fmt.Errorf("ratelimit: invalid route limit %q, expected route=limit", entry)
+		}
+		if p.Routes[route], err = ParseLimit(limit); err != nil {
+			return Policy{}, err
+		}
+	}
+	return p, nil
+}
+
+// limitFor returns the limit of a request for route by method, and the
+// name of its bucket
+func (p *Policy) limitFor(method, route string) (Limit, string) {
+	if l, ok := p.Routes[method+" "+route]; ok {
+		return l, method + " " + route
+	}
+	if l, ok := p.Routes[route]; ok {
+		return l, route
+	}
+	return p.Default, "*"
+}
+
+// Result is the state of a bucket after a request
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is when the bucket will be full again
+	Reset time.Duration
+	// RetryAfter is when the next token is available, if none was
+	RetryAfter time.Duration
+}
+
+// Store takes tokens from buckets
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// refill returns the tokens in a bucket last updated at last, in
+// milliseconds, that held tokens then
+func refill(tokens float64, last, now int64, l Limit) float64 {
+	elapsed := math.Max(0, float64(now-last))
+	return math.Min(float64(l.Burst), tokens+elapsed*l.Rate/1000)
+}
+
+// result describes a bucket left with tokens
+func result(allowed bool, tokens float64, l Limit) Result {
+	r := Result{
+		Allowed:   allowed,
+		Limit:     l.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(l.Burst) - tokens) / l.Rate),
+	}
+	if !allowed {
+		r.RetryAfter = seconds((1 - tokens) / l.Rate)
+	}
+	return r
+}
+
+// ttl is how long until an empty bucket is full, after which a bucket is
+// the same as a new one and can be dropped
+func (l Limit) ttl() time.Duration {
+	return seconds(float64(l.Burst) / l.Rate)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often full buckets are dropped from a MemoryStore
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	// last is when tokens was computed, in Unix milliseconds
+	last    int64
+	expires time.Time
+}
+
+// MemoryStore keeps buckets in process memory. Each replica then enforces
+// the limits on its own.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	nextSweep time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, l Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.After(s.nextSweep) {
+		for k, b := range s.buckets {
+			if now.After(b.expires) {
+				delete(s.buckets, k)
+			}
+		}
+		s.nextSweep = now.Add(sweepInterval)
+	}
+
+	ms := now.UnixMilli()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), last: ms}
+		s.buckets[key] = b
+	}
+	b.tokens = refill(b.tokens, b.last, ms, l)
+	b.last = ms
+	b.expires = now.Add(l.ttl())
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return result(allowed, b.tokens, l), nil
+}
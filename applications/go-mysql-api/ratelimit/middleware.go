@@ -0,0 +1,161 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"goapp_CI/auth"
+	"goapp_CI/logging"
+
+	"github.com/gorilla/mux"
+)
+
+// Limiter applies a Policy to requests, taking tokens from a Store
+type Limiter struct {
+	store  Store
+	policy atomic.Pointer[Policy]
+
+	// now returns the current time; tests replace it
+	now func() time.Time
+}
+
+// New returns a Limiter enforcing p with buckets kept in store
+func New(store Store, p Policy) *Limiter {
+	l := &Limiter{store: store, now: time.Now}
+	l.SetPolicy(p)
+	return l
+}
+
+// SetPolicy replaces the policy of l. Requests in flight keep the policy
+// they started with, and buckets carry over to the new limits.
+func (l *Limiter) SetPolicy(p Policy) {
+	l.policy.Store(&p)
+}
+
+// Policy returns the policy in force
+func (l *Limiter) Policy() Policy {
+	return *l.policy.Load()
+}
+
+// Middleware takes a token for every request and calls onLimited instead of
+// next when the client has none left. Responses carry the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers of the IETF httpapi
+// draft, and Retry-After when limited.
+//
+// Requests are limited per client, see ClientKey: before authentication by
+// address, after it by identity. Routes are known by their template, so it must run inside
+// the router, as a Router.Use middleware or around a route's handler. If
+// the store fails, requests are let through.
+func (l *Limiter) Middleware(onLimited http.HandlerFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := l.policy.Load()
+			if p.Disabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limit, bucket := p.limitFor(r.Method, routeTemplate(r))
+			key := ClientKey(r, p.TrustedProxies) + "|" + bucket
+			res, err := l.store.Take(r.Context(), key, limit, l.now())
+			if err != nil {
+				logging.FromContext(r.Context()).Warn("rate limit store unavailable, allowing request", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", ceilSeconds(res.Reset))
+			if !res.Allowed {
+				h.Set("Retry-After", ceilSeconds(res.RetryAfter))
+				logging.AddAttrs(r.Context(), slog.Bool("rate_limited", true))
+				onLimited(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientKey identifies the client of r: the authenticated user, API key or
+// client certificate, or else its IP address, see ClientIP
+func ClientKey(r *http.Request, trustedProxies []*net.IPNet) string {
+	if id, ok := auth.FromContext(r.Context()); ok {
+		switch {
+		case id.APIKeyID != 0:
+			return "apikey:" + strconv.Itoa(id.APIKeyID)
+		case id.UserID != 0:
+			return "user:" + strconv.Itoa(id.UserID)
+		case id.ClientCert != "":
+			return "cert:" + id.ClientCert
+		case id.Username != "":
+			return "name:" + id.Username
+		}
+	}
+	return "ip:" + ClientIP(r, trustedProxies)
+}
+
+// ClientIP returns the address of the client of r. When the direct peer is
+// one of trustedProxies, X-Forwarded-For is walked from the right and the
+// first hop outside trustedProxies is the client; hops further left were
+// added by the client itself and cannot be trusted.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !trusted(host, trustedProxies) {
+		return host
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			// A garbled entry ends the chain we can vouch for
+			break
+		}
+		host = hop
+		if !trusted(hop, trustedProxies) {
+			break
+		}
+	}
+	return host
+}
+
+func trusted(host string, nets []*net.IPNet) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return r.URL.Path
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
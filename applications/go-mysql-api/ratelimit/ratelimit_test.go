@@ -0,0 +1,401 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"goapp_CI/auth"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Limit
+	}{
+		{"10/s", Limit{Rate: 10, Burst: 10}},
+		{"60/m", Limit{Rate: 1, Burst: 60}},
+		{"300/m:20", Limit{Rate: 5, Burst: 20}},
+		{"10/15m", Limit{Rate: 10.0 / 900, Burst: 10}},
+		{" 3600/h ", Limit{Rate: 1, Burst: 3600}},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.InDelta(t, tt.want.Rate, got.Rate, 1e-9, tt.in)
+		assert.Equal(t, tt.want.Burst, got.Burst, tt.in)
+	}
+	for _, in := range []string{"", "10", "0/s", "-1/m", "10/d", "10/m:0", "10/m:x", "ten/m"} {
+		_, err := ParseLimit(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("300/m", []string{"POST /auth/login=5/m", "/users/{id} = 10/s"})
+	require.NoError(t, err)
+
+	l, bucket := p.limitFor("POST", "/auth/login")
+	assert.Equal(t, 5, l.Burst)
+	assert.Equal(t, "POST /auth/login", bucket)
+	l, bucket = p.limitFor("DELETE", "/users/{id}")
+	assert.Equal(t, 10, l.Burst)
+	assert.Equal(t, "/users/{id}", bucket)
+	l, bucket = p.limitFor("GET", "/auth/login")
+	assert.Equal(t, 300, l.Burst)
+	assert.Equal(t, "*", bucket)
+
+	_, err = ParsePolicy("300/m", []string{"POST /auth/login"})
+	assert.Error(t, err)
+	_, err = ParsePolicy("lots", nil)
+	assert.Error(t, err)
+}
+
+// testStore checks the token bucket behaviour of a Store
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	l := Limit{Rate: 1, Burst: 3}
+	now := time.UnixMilli(1_700_000_000_000)
+
+	for i := 2; i >= 0; i-- {
+		res, err := s.Take(ctx, "client|*", l, now)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+	}
+	res, err := s.Take(ctx, "client|*", l, now)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 3*time.Second, res.Reset)
+
+	// Other clients have their own bucket
+	res, err = s.Take(ctx, "other|*", l, now)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	// Tokens come back at Rate per second, up to Burst
+	res, err = s.Take(ctx, "client|*", l, now.Add(1500*time.Millisecond))
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	res, err = s.Take(ctx, "client|*", l, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Remaining)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestMemoryStoreDropsFullBuckets(t *testing.T) {
+	s := NewMemoryStore()
+	now := time.Now()
+	s.Take(context.Background(), "a", Limit{Rate: 1, Burst: 1}, now)
+	s.Take(context.Background(), "b", Limit{Rate: 1, Burst: 1}, now.Add(2*sweepInterval))
+	assert.Len(t, s.buckets, 1)
+	assert.Contains(t, s.buckets, "b")
+}
+
+// fakeRedis is an in-process Redis server knowing the commands RedisStore
+// sends. Scripts are not interpreted: any script runs the token bucket.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu      sync.Mutex
+	scripts map[string]bool
+	buckets map[string]*bucket
+	keys    []string
+	fail    bool
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f := &fakeRedis{ln: ln, password: password, scripts: map[string]bool{}, buckets: map[string]*bucket{}}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) url() string {
+	if f.password == "" {
+		return "redis://" + f.ln.Addr().String() + "/2"
+	}
+	return "redis://:" + f.password + "@" + f.ln.Addr().String() + "/2"
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, v := range reply.([]any) {
+			args = append(args, v.(string))
+		}
+		if !authed && args[0] != "AUTH" {
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		switch args[0] {
+		case "AUTH":
+			if args[len(args)-1] != f.password {
+				fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			authed = true
+			fmt.Fprint(conn, "+OK\r\n")
+		case "SELECT", "PING":
+			fmt.Fprint(conn, "+OK\r\n")
+		case "EVALSHA", "EVAL":
+			fmt.Fprint(conn, f.eval(args))
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+func (f *fakeRedis) eval(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return "-LOADING Redis is loading the dataset in memory\r\n"
+	}
+	if args[0] == "EVAL" {
+		f.scripts[takeScriptSHA] = true
+	} else if !f.scripts[args[1]] {
+		return "-NOSCRIPT No matching script. Please use EVAL.\r\n"
+	}
+
+	key := args[3]
+	rate, _ := strconv.ParseFloat(args[4], 64)
+	burst, _ := strconv.Atoi(args[5])
+	now, _ := strconv.ParseInt(args[6], 10, 64)
+	l := Limit{Rate: rate, Burst: burst}
+	f.keys = append(f.keys, key)
+
+	b, ok := f.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		f.buckets[key] = b
+	}
+	b.tokens = refill(b.tokens, b.last, now, l)
+	b.last = now
+	allowed := 0
+	if b.tokens >= 1 {
+		b.tokens--
+		allowed = 1
+	}
+	tokens := strconv.FormatFloat(b.tokens, 'f', -1, 64)
+	return fmt.Sprintf("*2\r\n:%d\r\n$%d\r\n%s\r\n", allowed, len(tokens), tokens)
+}
+
+func TestRedisStore(t *testing.T) {
+	f := newFakeRedis(t, "s3cret")
+	s, err := NewRedisStore(RedisOptions{URL: f.url(), Prefix: "ratelimit:"})
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, s.Ping(context.Background()))
+	testStore(t, s)
+	assert.Equal(t, "ratelimit:client|*", f.keys[0])
+
+	// Replicas share buckets
+	other, err := NewRedisStore(RedisOptions{URL: f.url(), Prefix: "ratelimit:"})
+	require.NoError(t, err)
+	defer other.Close()
+	res, err := other.Take(context.Background(), "other|*", Limit{Rate: 1, Burst: 3}, time.UnixMilli(1_700_000_000_000))
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Remaining)
+}
+
+func TestRedisStoreErrors(t *testing.T) {
+	f := newFakeRedis(t, "s3cret")
+
+	s, err := NewRedisStore(RedisOptions{URL: "redis://:wrong@" + f.ln.Addr().String()})
+	require.NoError(t, err)
+	assert.ErrorContains(t, s.Ping(context.Background()), "WRONGPASS")
+
+	s, err = NewRedisStore(RedisOptions{URL: f.url()})
+	require.NoError(t, err)
+	f.fail = true
+	_, err = s.Take(context.Background(), "k", Limit{Rate: 1, Burst: 1}, time.Now())
+	assert.ErrorContains(t, err, "LOADING")
+	// The connection survives error replies
+	f.fail = false
+	_, err = s.Take(context.Background(), "k", Limit{Rate: 1, Burst: 1}, time.Now())
+	assert.NoError(t, err)
+
+	for _, u := range []string{"http://localhost", "redis://localhost/x", "://"} {
+		_, err := NewRedisStore(RedisOptions{URL: u})
+		assert.Error(t, err, u)
+	}
+}
+
+// failingStore stands in for an unreachable backend
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Limit, time.Time) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusTooManyRequests)
+}
+
+func newRouter(l *Limiter) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user := r.Header.Get("X-Test-User"); user != "" {
+				id, _ := strconv.Atoi(user)
+				r = r.WithContext(auth.WithIdentity(r.Context(), auth.Identity{UserID: id}))
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Use(l.Middleware(tooManyRequests))
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.HandleFunc("/auth/login", ok).Methods("POST")
+	r.HandleFunc("/users/{id}", ok).Methods("GET")
+	r.HandleFunc("/users", ok).Methods("GET")
+	return r
+}
+
+func call(h http.Handler, method, path, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "192.0.2.1:50000"
+	if user != "" {
+		req.Header.Set("X-Test-User", user)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	p, err := ParsePolicy("3/m", []string{"POST /auth/login=1/m"})
+	require.NoError(t, err)
+	l := New(NewMemoryStore(), p)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	r := newRouter(l)
+
+	rec := call(r, "POST", "/auth/login", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", rec.Header().Get("RateLimit-Reset"))
+	assert.Empty(t, rec.Header().Get("Retry-After"))
+
+	rec = call(r, "POST", "/auth/login", "")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+
+	// Routes without their own limit share the default budget
+	assert.Equal(t, http.StatusOK, call(r, "GET", "/users/1", "7").Code)
+	assert.Equal(t, http.StatusOK, call(r, "GET", "/users/2", "7").Code)
+	rec = call(r, "GET", "/users", "7")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, http.StatusTooManyRequests, call(r, "GET", "/users", "7").Code)
+	// Users are limited apart from each other and from their IP address
+	assert.Equal(t, http.StatusOK, call(r, "GET", "/users", "8").Code)
+	assert.Equal(t, http.StatusOK, call(r, "GET", "/users", "").Code)
+
+	// A new policy applies to the next request; the bucket keeps its
+	// tokens and refills at the new rate
+	p.Default = Limit{Rate: 1, Burst: 100}
+	l.SetPolicy(p)
+	now = now.Add(time.Second)
+	rec = call(r, "GET", "/users", "7")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "100", rec.Header().Get("RateLimit-Limit"))
+
+	l.SetPolicy(Policy{Disabled: true})
+	rec = call(r, "POST", "/auth/login", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("RateLimit-Limit"))
+}
+
+func TestMiddlewareFailsOpen(t *testing.T) {
+	l := New(failingStore{}, Policy{Default: Limit{Rate: 1, Burst: 1}})
+	rec := call(newRouter(l), "GET", "/users", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("RateLimit-Limit"))
+}
+
+func TestClientKey(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "[2001:db8::1]:443"
+	assert.Equal(t, "ip:2001:db8::1", ClientKey(req, nil))
+
+	for id, want := range map[*auth.Identity]string{
+		{UserID: 7, Username: "alice"}:                      "user:7",
+		{APIKeyID: 3, Username: "apikey:ci"}:                "apikey:3",
+		{Username: "reporting", ClientCert: "CN=reporting"}: "cert:CN=reporting",
+	} {
+		r := req.WithContext(auth.WithIdentity(req.Context(), *id))
+		assert.Equal(t, want, ClientKey(r, nil))
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	trustedProxies := []*net.IPNet{proxies}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		trusted    []*net.IPNet
+		want       string
+	}{
+		{"no trusted proxies", "10.0.0.1:1234", []string{"203.0.113.7"}, nil, "10.0.0.1"},
+		{"untrusted peer", "198.51.100.1:1234", []string{"203.0.113.7"}, trustedProxies, "198.51.100.1"},
+		{"one proxy", "10.0.0.1:1234", []string{"203.0.113.7"}, trustedProxies, "203.0.113.7"},
+		{"proxy chain", "10.0.0.1:1234", []string{"203.0.113.7, 10.0.0.2"}, trustedProxies, "203.0.113.7"},
+		{"spoofed hops", "10.0.0.1:1234", []string{"192.0.2.9, 203.0.113.7"}, trustedProxies, "203.0.113.7"},
+		{"several headers", "10.0.0.1:1234", []string{"192.0.2.9", "203.0.113.7, 10.0.0.2"}, trustedProxies, "203.0.113.7"},
+		{"garbled hop", "10.0.0.1:1234", []string{"203.0.113.7, unknown, 10.0.0.2"}, trustedProxies, "10.0.0.2"},
+		{"no header", "10.0.0.1:1234", nil, trustedProxies, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			assert.Equal(t, tt.want, ClientIP(req, tt.trusted))
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// takeScript is the token bucket of MemoryStore, run atomically in Redis.
+// The bucket is a hash of its tokens and the time they were computed, and
+// expires once it would be full again.
+const takeScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1]) or burst
+local last = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate / 1000)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000))
+return {allowed, tostring(tokens)}
+`
+
+var takeScriptSHA = func() string {
+	sum := sha1.Sum([]byte(takeScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// RedisOptions configures a RedisStore
+type RedisOptions struct {
+	// URL is redis://[user:password@]host:port[/db], or rediss:// for TLS
+	URL string
+	// Timeout bounds each command, including dialing
+	Timeout time.Duration
+	// PoolSize is the number of idle connections kept open
+	PoolSize int
+	// Prefix is prepended to bucket keys
+	Prefix string
+}
+
+// RedisStore keeps buckets in Redis so that replicas share them. It speaks
+// the Redis protocol directly and needs Redis 4 or later.
+type RedisStore struct {
+	addr     string
+	tls      *tls.Config
+	username string
+	password string
+	db       int
+	timeout  time.Duration
+	prefix   string
+	idle     chan *redisConn
+}
+
+// NewRedisStore returns a RedisStore for opts.URL. Connections are opened
+// on first use.
+func NewRedisStore(opts RedisOptions) (*RedisStore, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("ratelimit: invalid Redis URL: %w", err)
+	}
+	s := &RedisStore{
+		addr:    u.Host,
+		timeout: opts.Timeout,
+		prefix:  opts.Prefix,
+	}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		s.tls = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	default:
+		return nil, fmt.Errorf("ratelimit: Redis URL scheme must be redis or rediss, not %q", u.Scheme)
+	}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		s.username = u.User.Username()
+		s.password, _ = u.User.Password()
+		if _, ok := u.User.Password(); !ok {
+			// redis://:password@host and redis://password@host both mean
+			// the default user
+			s.username, s.password = "", s.username
+		}
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("ratelimit: invalid Redis database %q", db)
+		}
+	}
+	if s.timeout <= 0 {
+		s.timeout = time.Second
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 10
+	}
+	s.idle = make(chan *redisConn, opts.PoolSize)
+	return s, nil
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, l Limit, now time.Time) (Result, error) {
+	args := []string{
+		"EVALSHA", takeScriptSHA, "1", s.prefix + key,
+		strconv.FormatFloat(l.Rate, 'f', -1, 64),
+		strconv.Itoa(l.Burst),
+		strconv.FormatInt(now.UnixMilli(), 10),
+	}
+	reply, err := s.do(ctx, args...)
+	var rerr redisError
+	if errors.As(err, &rerr) && strings.HasPrefix(string(rerr), "NOSCRIPT") {
+		// The script cache was flushed or this is a new server
+		args[0], args[1] = "EVAL", takeScript
+		reply, err = s.do(ctx, args...)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 2 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected Redis reply %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	remaining, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(remaining, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("ratelimit: unexpected Redis reply %v", reply)
+	}
+	return result(allowed == 1, tokens, l), nil
+}
+
+// Ping checks that Redis is reachable
+func (s *RedisStore) Ping(ctx context.Context) error {
+	_, err := s.do(ctx, "PING")
+	return err
+}
+
+// Close closes the idle connections
+func (s *RedisStore) Close() error {
+	for {
+		select {
+		case c := <-s.idle:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do runs a command on a pooled connection. Connections that fail are
+// dropped; errors returned by Redis leave the connection usable.
+func (s *RedisStore) do(ctx context.Context, args ...string) (any, error) {
+	c, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.do(ctx, s.timeout, args...)
+	var rerr redisError
+	if err != nil && !errors.As(err, &rerr) {
+		c.Close()
+		return nil, err
+	}
+	select {
+	case s.idle <- c:
+	default:
+		c.Close()
+	}
+	return reply, err
+}
+
+func (s *RedisStore) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-s.idle:
+		return c, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: s.timeout}
+	var nc net.Conn
+	var err error
+	if s.tls != nil {
+		nc, err = (&tls.Dialer{NetDialer: dialer, Config: s.tls}).DialContext(ctx, "tcp", s.addr)
+	} else {
+		nc, err = dialer.DialContext(ctx, "tcp", s.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ratelimit: connecting to Redis: %w", err)
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+
+	var setup [][]string
+	if s.password != "" {
+		if s.username != "" {
+			setup = append(setup, []string{"AUTH", s.username, s.password})
+		} else {
+			setup = append(setup, []string{"AUTH", s.password})
+		}
+	}
+	if s.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.db)})
+	}
+	for _, args := range setup {
+		if _, err := c.do(ctx, s.timeout, args...); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("ratelimit: %s: %w", args[0], err)
+		}
+	}
+	return c, nil
+}
+
+// redisError is an error reply from Redis
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// redisConn is a connection speaking RESP2
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *redisConn) do(ctx context.Context, timeout time.Duration, args ...string) (any, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.SetDeadline(deadline)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.Write([]byte(b.String())); err != nil {
+		return nil, err
+	}
+	return readReply(c.r)
+}
+
+// readReply reads a RESP2 reply: strings, integers, nil or arrays of them
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("ratelimit: malformed Redis reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]any, n)
+		var replyErr error
+		for i := range values {
+			// An error inside an array fails the command, once the rest of
+			// the array has been read
+			values[i], err = readReply(r)
+			var rerr redisError
+			if errors.As(err, &rerr) {
+				if replyErr == nil {
+					replyErr = err
+				}
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		if replyErr != nil {
+			return nil, replyErr
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("ratelimit: malformed Redis reply %q", line)
+}
@@ -270,6 +270,10 @@ populate_secrets() {
         log_level="info" \
         environment="production"
     
+    # JWT signing secret (HS256, at least 32 bytes)
+    vault kv put -address="$VAULT_ADDR" secret/go-mysql-api/jwt \
+        secret="$(openssl rand -base64 48)"
+    
     # AWS secrets
     vault kv put -address="$VAULT_ADDR" secret/go-mysql-api/aws \
         access_key_id="your-aws-access-key" \
@@ -306,6 +310,7 @@ vault:
   secrets:
     db_password: "secret/data/go-mysql-api/database"
     api_key: "secret/data/go-mysql-api/app"
+    jwt: "secret/data/go-mysql-api/jwt"
     aws_credentials: "secret/data/go-mysql-api/aws"
 
 # Disable direct environment variables when using Vault
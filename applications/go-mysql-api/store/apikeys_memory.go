@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+func (s *MemoryStore) CreateAPIKey(ctx context.Context, k *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.apiKeys {
+		if existing.Prefix == k.Prefix {
+			return ErrDuplicate
+		}
+	}
+
+	k.ID = s.nextKeyID
+	k.CreatedAt = s.now()
+	s.nextKeyID++
+	s.apiKeys[k.ID] = copyAPIKey(*k)
+	return nil
+}
+
+func (s *MemoryStore) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, k := range s.apiKeys {
+		if k.Prefix == prefix {
+			k = copyAPIKey(k)
+			return &k, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]APIKey, 0, len(s.apiKeys))
+	for _, k := range s.apiKeys {
+		keys = append(keys, copyAPIKey(k))
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID > keys[j].ID })
+	return keys, nil
+}
+
+func (s *MemoryStore) RevokeAPIKey(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.apiKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if k.RevokedAt == nil {
+		now := s.now()
+		k.RevokedAt = &now
+		s.apiKeys[id] = k
+	}
+	return nil
+}
+
+func (s *MemoryStore) TouchAPIKey(ctx context.Context, id int, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.apiKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	k.LastUsedAt = &at
+	s.apiKeys[id] = k
+	return nil
+}
+
+// copyAPIKey keeps callers from mutating the stored scopes and timestamps
+func copyAPIKey(k APIKey) APIKey {
+	k.Scopes = append([]string(nil), k.Scopes...)
+	for _, t := range []**time.Time{&k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt} {
+		if *t != nil {
+			v := **t
+			*t = &v
+		}
+	}
+	return k
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+const apiKeyColumns = "id, name, prefix, secret_hash, scopes, created_by, expires_at, last_used_at, revoked_at, created_at"
+
+func (s *MySQLStore) CreateAPIKey(ctx context.Context, k *APIKey) error {
+	query := "INSERT INTO api_keys (name, prefix, secret_hash, scopes, created_by, expires_at) VALUES (?, ?, ?, ?, ?, ?)"
+	createdBy := sql.NullInt64{Int64: int64(k.CreatedBy), Valid: k.CreatedBy != 0}
+	result, err := s.db.ExecContext(ctx, query, k.Name, k.Prefix, k.SecretHash, strings.Join(k.Scopes, ","), createdBy, k.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	created, err := s.GetAPIKeyByPrefix(ctx, k.Prefix)
+	if err != nil {
+		return err
+	}
+	created.ID = int(id)
+	*k = *created
+	return nil
+}
+
+func (s *MySQLStore) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE prefix = ?"
+	k, err := scanAPIKey(s.db.QueryRowContext(ctx, query, prefix))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return k, err
+}
+
+func (s *MySQLStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *MySQLStore) RevokeAPIKey(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP) WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MySQLStore) TouchAPIKey(ctx context.Context, id int, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", at, id)
+	return err
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var k APIKey
+	var scopes string
+	var createdBy sql.NullInt64
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.SecretHash, &scopes, &createdBy, &expiresAt, &lastUsedAt, &revokedAt, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if scopes != "" {
+		k.Scopes = strings.Split(scopes, ",")
+	}
+	k.CreatedBy = int(createdBy.Int64)
+	k.ExpiresAt = nullTime(expiresAt)
+	k.LastUsedAt = nullTime(lastUsedAt)
+	k.RevokedAt = nullTime(revokedAt)
+	return &k, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed or were issued
+// for a different sort order
+var ErrInvalidCursor = errors.New("store: invalid cursor")
+
+// SortFields are the user columns List can order by. Every sort is
+// tie-broken by id so that keyset pagination is stable.
+var SortFields = []string{"created_at", "username", "email", "id"}
+
+// Sort is an ordering of the user list
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// DefaultSort lists the newest users first
+var DefaultSort = Sort{Field: "created_at", Desc: true}
+
+// ParseSort parses a sort field from SortFields, prefixed with "-" for
+// descending order. An empty string gives DefaultSort.
+func ParseSort(s string) (Sort, error) {
+	if s == "" {
+		return DefaultSort, nil
+	}
+	field, desc := strings.CutPrefix(s, "-")
+	for _, f := range SortFields {
+		if f == field {
+			return Sort{Field: field, Desc: desc}, nil
+		}
+	}
+	return Sort{}, fmt.Errorf("unsupported sort field %q", field)
+}
+
+func (s Sort) String() string {
+	if s.Desc {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+// Cursor is the keyset position after the last user of a page: the value of
+// the sort field and the id of that user
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v,omitempty"`
+	ID    int    `json:"id"`
+}
+
+// ListOptions selects a page of users
+type ListOptions struct {
+	Sort  Sort
+	Limit int
+	// After continues the listing behind a previous page
+	After *Cursor
+
+	UsernamePrefix string
+	EmailPrefix    string
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+}
+
+// cursorFor returns the cursor positioned on u
+func cursorFor(sort Sort, u User) *Cursor {
+	c := &Cursor{Sort: sort.String(), ID: u.ID}
+	switch sort.Field {
+	case "created_at":
+		c.Value = u.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "username":
+		c.Value = u.Username
+	case "email":
+		c.Value = u.Email
+	}
+	return c
+}
+
+// Encode returns the opaque form of c handed to clients
+func (c *Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor produced by Encode and checks that it belongs
+// to sort
+func DecodeCursor(s string, sort Sort) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != sort.String() {
+		return nil, ErrInvalidCursor
+	}
+	if sort.Field == "created_at" {
+		if _, err := time.Parse(time.RFC3339Nano, c.Value); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return &c, nil
+}
+
+// page trims users, fetched with one extra row, to opts.Limit and returns
+// the cursor of the next page if the extra row exists
+func page(users []User, opts ListOptions) ([]User, *Cursor, error) {
+	if len(users) <= opts.Limit {
+		return users, nil, nil
+	}
+	users = users[:opts.Limit]
+	return users, cursorFor(opts.Sort, users[len(users)-1]), nil
+}
+
+// likePrefix returns a LIKE pattern matching values starting with prefix
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(prefix) + "%"
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-memory UserStore used by tests and local development
+type MemoryStore struct {
+	mu     sync.RWMutex
+	users  map[int]User
+	nextID int
+	now    func() time.Time
+
+	apiKeys   map[int]APIKey
+	nextKeyID int
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:  make(map[int]User),
+		nextID: 1,
+		now:    time.Now,
+
+		apiKeys:   make(map[int]APIKey),
+		nextKeyID: 1,
+	}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, u *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.taken(0, u.Username, u.Email) {
+		return ErrDuplicate
+	}
+
+	now := s.now()
+	u.ID = s.nextID
+	u.Version = 1
+	u.CreatedAt = now
+	u.UpdatedAt = now
+	s.nextID++
+	s.users[u.ID] = *u
+
+	u.Password = ""
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id int) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user.Password = ""
+	return &user, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, opts ListOptions) ([]User, *Cursor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var after *User
+	if opts.After != nil {
+		after = &User{ID: opts.After.ID, Username: opts.After.Value, Email: opts.After.Value}
+		if opts.Sort.Field == "created_at" {
+			t, err := time.Parse(time.RFC3339Nano, opts.After.Value)
+			if err != nil {
+				return nil, nil, ErrInvalidCursor
+			}
+			after.CreatedAt = t
+		}
+	}
+
+	users := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		if !strings.HasPrefix(user.Username, opts.UsernamePrefix) ||
+			!strings.HasPrefix(user.Email, opts.EmailPrefix) ||
+			(opts.CreatedAfter != nil && !user.CreatedAt.After(*opts.CreatedAfter)) ||
+			(opts.CreatedBefore != nil && !user.CreatedAt.Before(*opts.CreatedBefore)) ||
+			(after != nil && !less(opts.Sort, *after, user)) {
+			continue
+		}
+		user.Password = ""
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return less(opts.Sort, users[i], users[j]) })
+
+	if len(users) > opts.Limit+1 {
+		users = users[:opts.Limit+1]
+	}
+	return page(users, opts)
+}
+
+// less reports whether a is listed before b under order
+func less(order Sort, a, b User) bool {
+	c := 0
+	switch order.Field {
+	case "created_at":
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	case "username":
+		c = strings.Compare(a.Username, b.Username)
+	case "email":
+		c = strings.Compare(a.Email, b.Email)
+	}
+	if c == 0 {
+		c = a.ID - b.ID
+	}
+	if order.Desc {
+		return c > 0
+	}
+	return c < 0
+}
+
+func (s *MemoryStore) Update(ctx context.Context, u *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.users[u.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if u.Version != 0 && u.Version != existing.Version {
+		return ErrConflict
+	}
+	if s.taken(u.ID, u.Username, u.Email) {
+		return ErrDuplicate
+	}
+
+	existing.Username = u.Username
+	existing.Email = u.Email
+	if u.Password != "" {
+		existing.Password = u.Password
+	}
+	existing.Version++
+	existing.UpdatedAt = s.now()
+	s.users[u.ID] = existing
+
+	*u = existing
+	u.Password = ""
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+func (s *MemoryStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) SetPassword(ctx context.Context, id int, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Password = hash
+	s.users[id] = user
+	return nil
+}
+
+// taken reports whether another user than id already uses username or email.
+// Callers must hold s.mu.
+func (s *MemoryStore) taken(id int, username, email string) bool {
+	for _, user := range s.users {
+		if user.ID != id && (user.Username == username || user.Email == email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStoreLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	user := User{Username: "alice", Email: "alice@example.com", Password: "secret"}
+	require.NoError(t, s.Create(ctx, &user))
+	assert.Equal(t, 1, user.ID)
+	assert.Empty(t, user.Password)
+	assert.False(t, user.CreatedAt.IsZero())
+
+	got, err := s.Get(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", got.Username)
+
+	got.Username = "alice2"
+	require.NoError(t, s.Update(ctx, got))
+	assert.Equal(t, "alice2", got.Username)
+
+	users, next, err := s.List(ctx, ListOptions{Sort: DefaultSort, Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Nil(t, next)
+
+	require.NoError(t, s.Delete(ctx, user.ID))
+	_, err = s.Get(ctx, user.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, s.Delete(ctx, user.ID), ErrNotFound)
+}
+
+func TestMemoryStoreDuplicate(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	require.NoError(t, s.Create(ctx, &User{Username: "bob", Email: "bob@example.com", Password: "x"}))
+	err := s.Create(ctx, &User{Username: "bob", Email: "other@example.com", Password: "x"})
+	assert.ErrorIs(t, err, ErrDuplicate)
+
+	carol := User{Username: "carol", Email: "carol@example.com", Password: "x"}
+	require.NoError(t, s.Create(ctx, &carol))
+	carol.Email = "bob@example.com"
+	assert.ErrorIs(t, s.Update(ctx, &carol), ErrDuplicate)
+}
+
+func TestMemoryStoreUpdateVersion(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	user := User{Username: "dave", Email: "dave@example.com", Password: "hash"}
+	require.NoError(t, s.Create(ctx, &user))
+	assert.Equal(t, 1, user.Version)
+
+	stale := User{ID: user.ID, Username: "dave2", Email: "dave@example.com", Version: 1}
+	require.NoError(t, s.Update(ctx, &stale))
+	assert.Equal(t, 2, stale.Version)
+
+	stale = User{ID: user.ID, Username: "dave3", Email: "dave@example.com", Version: 1}
+	assert.ErrorIs(t, s.Update(ctx, &stale), ErrConflict)
+
+	// An empty password keeps the stored hash
+	got, err := s.GetByUsername(ctx, "dave2")
+	require.NoError(t, err)
+	assert.Equal(t, "hash", got.Password)
+}
+
+func TestMemoryStoreListNewestFirst(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, s.Create(ctx, &User{Username: name, Email: name + "@example.com", Password: "x"}))
+	}
+
+	users, _, err := s.List(ctx, ListOptions{Sort: DefaultSort, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, users, 3)
+	assert.Equal(t, "c", users[0].Username)
+	assert.Equal(t, "a", users[2].Username)
+}
+
+func TestMemoryStoreListPages(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+	s.now = func() time.Time { return clock }
+
+	// Users 2 and 3 share a timestamp so the id tie-break is exercised
+	for i, name := range []string{"ann", "bob", "bea", "cid", "dan"} {
+		if i != 2 {
+			clock = clock.Add(time.Hour)
+		}
+		require.NoError(t, s.Create(ctx, &User{Username: name, Email: name + "@example.com", Password: "x"}))
+	}
+
+	names := func(users []User) []string {
+		var out []string
+		for _, u := range users {
+			out = append(out, u.Username)
+		}
+		return out
+	}
+	listAll := func(opts ListOptions) []string {
+		var all []string
+		for {
+			users, next, err := s.List(ctx, opts)
+			require.NoError(t, err)
+			all = append(all, names(users)...)
+			if next == nil {
+				return all
+			}
+			opts.After, err = DecodeCursor(next.Encode(), opts.Sort)
+			require.NoError(t, err)
+		}
+	}
+
+	assert.Equal(t, []string{"dan", "cid", "bea", "bob", "ann"}, listAll(ListOptions{Sort: DefaultSort, Limit: 2}))
+	assert.Equal(t, []string{"ann", "bea", "bob", "cid", "dan"}, listAll(ListOptions{Sort: Sort{Field: "username"}, Limit: 2}))
+	assert.Equal(t, []string{"dan", "cid", "bea", "bob", "ann"}, listAll(ListOptions{Sort: Sort{Field: "id", Desc: true}, Limit: 3}))
+	assert.Equal(t, []string{"bea", "bob"}, listAll(ListOptions{Sort: Sort{Field: "username"}, Limit: 1, UsernamePrefix: "b"}))
+
+	after, before := start.Add(time.Hour), start.Add(4*time.Hour)
+	assert.Equal(t, []string{"cid", "bea", "bob"}, listAll(ListOptions{Sort: DefaultSort, Limit: 5, CreatedAfter: &after, CreatedBefore: &before}))
+}
+
+func TestParseSortAndCursor(t *testing.T) {
+	sort, err := ParseSort("-username")
+	require.NoError(t, err)
+	assert.Equal(t, Sort{Field: "username", Desc: true}, sort)
+	_, err = ParseSort("password")
+	assert.Error(t, err)
+
+	c := cursorFor(sort, User{ID: 4, Username: "bob"})
+	got, err := DecodeCursor(c.Encode(), sort)
+	require.NoError(t, err)
+	assert.Equal(t, c, got)
+
+	_, err = DecodeCursor(c.Encode(), DefaultSort)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = DecodeCursor("!!", sort)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestLikePrefixEscapesWildcards(t *testing.T) {
+	assert.Equal(t, `50\%\_off\\%`, likePrefix(`50%_off\`))
+}
+
+func TestMemoryStorePassword(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	user := User{Username: "dave", Email: "dave@example.com", Password: "plain"}
+	require.NoError(t, s.Create(ctx, &user))
+
+	got, err := s.GetByUsername(ctx, "dave")
+	require.NoError(t, err)
+	assert.Equal(t, "plain", got.Password)
+
+	require.NoError(t, s.SetPassword(ctx, user.ID, "$argon2id$hash"))
+	got, err = s.GetByUsername(ctx, "dave")
+	require.NoError(t, err)
+	assert.Equal(t, "$argon2id$hash", got.Password)
+
+	_, err = s.GetByUsername(ctx, "nobody")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, s.SetPassword(ctx, 42, "x"), ErrNotFound)
+}
+
+func TestMemoryStoreAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	k := APIKey{Name: "ci", Prefix: "abcd1234", SecretHash: "hash", Scopes: []string{"users:read"}}
+	require.NoError(t, s.CreateAPIKey(ctx, &k))
+	assert.Equal(t, 1, k.ID)
+	assert.False(t, k.CreatedAt.IsZero())
+	assert.ErrorIs(t, s.CreateAPIKey(ctx, &APIKey{Name: "dup", Prefix: "abcd1234"}), ErrDuplicate)
+
+	got, err := s.GetAPIKeyByPrefix(ctx, "abcd1234")
+	require.NoError(t, err)
+	assert.Equal(t, "hash", got.SecretHash)
+	assert.Nil(t, got.LastUsedAt)
+
+	used := time.Now()
+	require.NoError(t, s.TouchAPIKey(ctx, k.ID, used))
+	require.NoError(t, s.RevokeAPIKey(ctx, k.ID))
+	got, err = s.GetAPIKeyByPrefix(ctx, "abcd1234")
+	require.NoError(t, err)
+	require.NotNil(t, got.LastUsedAt)
+	assert.True(t, used.Equal(*got.LastUsedAt))
+	assert.NotNil(t, got.RevokedAt)
+
+	keys, err := s.ListAPIKeys(ctx)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+
+	_, err = s.GetAPIKeyByPrefix(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, s.RevokeAPIKey(ctx, 42), ErrNotFound)
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DB is the part of *sql.DB used by MySQLStore. It is also implemented by
+// dbpool.Pool, whose connections survive credential rotation.
+type DB interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// MySQLStore is a UserStore backed by a MySQL database
+type MySQLStore struct {
+	db DB
+}
+
+// NewMySQLStore returns a UserStore using db
+func NewMySQLStore(db DB) *MySQLStore {
+	return &MySQLStore{db: db}
+}
+
+func (s *MySQLStore) Create(ctx context.Context, u *User) error {
+	query := "INSERT INTO users (username, email, password, role) VALUES (?, ?, ?, ?)"
+	result, err := s.db.ExecContext(ctx, query, u.Username, u.Email, u.Password, u.Role)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	created, err := s.Get(ctx, int(id))
+	if err != nil {
+		return err
+	}
+	*u = *created
+	return nil
+}
+
+func (s *MySQLStore) Get(ctx context.Context, id int) (*User, error) {
+	query := "SELECT id, username, email, role, version, created_at, updated_at FROM users WHERE id = ?"
+	var user User
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.Version, &user.CreatedAt, &user.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *MySQLStore) List(ctx context.Context, opts ListOptions) ([]User, *Cursor, error) {
+	var where []string
+	var args []any
+	if opts.UsernamePrefix != "" {
+		where = append(where, "username LIKE ?")
+		args = append(args, likePrefix(opts.UsernamePrefix))
+	}
+	if opts.EmailPrefix != "" {
+		where = append(where, "email LIKE ?")
+		args = append(args, likePrefix(opts.EmailPrefix))
+	}
+	if opts.CreatedAfter != nil {
+		where = append(where, "created_at > ?")
+		args = append(args, *opts.CreatedAfter)
+	}
+	if opts.CreatedBefore != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, *opts.CreatedBefore)
+	}
+
+	// The sort field is checked against SortFields, so it is safe to
+	// interpolate; all values are passed as arguments
+	field, cmp, dir := opts.Sort.Field, ">", "ASC"
+	if opts.Sort.Desc {
+		cmp, dir = "<", "DESC"
+	}
+	if opts.After != nil {
+		if field == "id" {
+			where = append(where, "id "+cmp+" ?")
+			args = append(args, opts.After.ID)
+		} else {
+			var value any = opts.After.Value
+			if field == "created_at" {
+				t, err := time.Parse(time.RFC3339Nano, opts.After.Value)
+				if err != nil {
+					return nil, nil, ErrInvalidCursor
+				}
+				value = t
+			}
+			where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", field, cmp))
+			args = append(args, value, value, opts.After.ID)
+		}
+	}
+
+	query := "SELECT id, username, email, role, version, created_at, updated_at FROM users"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if field == "id" {
+		query += " ORDER BY id " + dir
+	} else {
+		query += fmt.Sprintf(" ORDER BY %s %s, id %s", field, dir, dir)
+	}
+	// Fetch one row more than requested to learn whether there is a next page
+	query += " LIMIT ?"
+	args = append(args, opts.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.Version, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			return nil, nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return page(users, opts)
+}
+
+func (s *MySQLStore) Update(ctx context.Context, u *User) error {
+	query := "UPDATE users SET username = ?, email = ?, version = version + 1"
+	args := []any{u.Username, u.Email}
+	if u.Password != "" {
+		query += ", password = ?"
+		args = append(args, u.Password)
+	}
+	query += " WHERE id = ?"
+	args = append(args, u.ID)
+	if u.Version != 0 {
+		query += " AND version = ?"
+		args = append(args, u.Version)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// Either the user is gone or it was changed concurrently
+		if _, err := s.Get(ctx, u.ID); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+
+	updated, err := s.Get(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	*u = *updated
+	return nil
+}
+
+func (s *MySQLStore) Delete(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MySQLStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	query := "SELECT id, username, email, password, role, version, created_at, updated_at FROM users WHERE username = ?"
+	var user User
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role, &user.Version, &user.CreatedAt, &user.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *MySQLStore) SetPassword(ctx context.Context, id int, hash string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE users SET password = ? WHERE id = ?", hash, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
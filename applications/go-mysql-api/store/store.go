@@ -0,0 +1,87 @@
+// Package store provides persistence for users behind the UserStore interface.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when the requested record does not exist
+var ErrNotFound = errors.New("store: not found")
+
+// ErrConflict is returned when a conditional update finds the row at another
+// version than expected
+var ErrConflict = errors.New("store: version conflict")
+
+// ErrDuplicate is returned when a username or email is already taken
+var ErrDuplicate = errors.New("store: duplicate user")
+
+// User represents a user in the system
+type User struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Password  string    `json:"password,omitempty"`
+	Role      string    `json:"role"`
+	Version   int       `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// APIKey is a credential for machine clients. Only a hash of the secret is stored.
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	SecretHash string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  int        `json:"created_by,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Store combines all repositories used by the API
+type Store interface {
+	UserStore
+	APIKeyStore
+}
+
+// UserStore is the repository used by the HTTP layer to manage users.
+// Implementations must be safe for concurrent use.
+type UserStore interface {
+	// Create inserts u and fills in its ID and timestamps.
+	Create(ctx context.Context, u *User) error
+	// Get returns the user with the given ID or ErrNotFound.
+	Get(ctx context.Context, id int) (*User, error)
+	// List returns the page of users selected by opts and the cursor of
+	// the next page, which is nil on the last page.
+	List(ctx context.Context, opts ListOptions) ([]User, *Cursor, error)
+	// Update overwrites username and email of the user with u.ID, and the
+	// password unless u.Password is empty, then increments its version. The
+	// role is left unchanged. If u.Version is set, the update only applies
+	// to that version and otherwise returns ErrConflict.
+	Update(ctx context.Context, u *User) error
+	// Delete removes the user with the given ID or returns ErrNotFound.
+	Delete(ctx context.Context, id int) error
+	// GetByUsername returns the user including the stored password hash.
+	GetByUsername(ctx context.Context, username string) (*User, error)
+	// SetPassword replaces the stored password hash of the user with id.
+	SetPassword(ctx context.Context, id int, hash string) error
+}
+
+// APIKeyStore is the repository for API keys
+type APIKeyStore interface {
+	// CreateAPIKey inserts k and fills in its ID and creation time.
+	CreateAPIKey(ctx context.Context, k *APIKey) error
+	// GetAPIKeyByPrefix returns the key with the given lookup prefix or ErrNotFound.
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error)
+	// ListAPIKeys returns all keys, including revoked ones, newest first.
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	// RevokeAPIKey marks the key with id as revoked or returns ErrNotFound.
+	RevokeAPIKey(ctx context.Context, id int) error
+	// TouchAPIKey records that the key with id was used at at.
+	TouchAPIKey(ctx context.Context, id int, at time.Time) error
+}
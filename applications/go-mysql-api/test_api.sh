@@ -8,9 +8,24 @@ BASE_URL="http://localhost:8080"
 echo "Testing Go MySQL User Management API"
 echo "===================================="
 
+# Log in as the seeded admin user (see init.sql) to get an access token
+echo -e "\n0. Logging in..."
+LOGIN_RESPONSE=$(curl -s -X POST $BASE_URL/auth/login \
+  -H "Content-Type: application/json" \
+  -d "{\"username\": \"${ADMIN_USER:-admin}\", \"password\": \"${ADMIN_PASSWORD:-admin123}\"}")
+
+TOKEN=$(echo $LOGIN_RESPONSE | grep -o '"access_token":"[^"]*' | cut -d'"' -f4)
+
+if [ -z "$TOKEN" ]; then
+    echo "Failed to log in: $LOGIN_RESPONSE"
+    exit 1
+fi
+
+AUTH_HEADER="Authorization: Bearer $TOKEN"
+
 # Test 1: Create a user
 echo -e "\n1. Creating a user..."
-CREATE_RESPONSE=$(curl -s -X POST $BASE_URL/users \
+CREATE_RESPONSE=$(curl -s -H "$AUTH_HEADER" -X POST $BASE_URL/users \
   -H "Content-Type: application/json" \
   -d '{
     "username": "testuser1",
@@ -32,15 +47,15 @@ echo "Created user with ID: $USER_ID"
 
 # Test 2: Get all users
 echo -e "\n2. Getting all users..."
-curl -s $BASE_URL/users | jq '.'
+curl -s -H "$AUTH_HEADER" $BASE_URL/users | jq '.'
 
 # Test 3: Get specific user
 echo -e "\n3. Getting user with ID: $USER_ID"
-curl -s $BASE_URL/users/$USER_ID | jq '.'
+curl -s -H "$AUTH_HEADER" $BASE_URL/users/$USER_ID | jq '.'
 
 # Test 4: Update user
 echo -e "\n4. Updating user with ID: $USER_ID"
-UPDATE_RESPONSE=$(curl -s -X PUT $BASE_URL/users/$USER_ID \
+UPDATE_RESPONSE=$(curl -s -H "$AUTH_HEADER" -X PUT $BASE_URL/users/$USER_ID \
   -H "Content-Type: application/json" \
   -d '{
     "username": "updateduser1",
@@ -52,11 +67,11 @@ echo "Update response: $UPDATE_RESPONSE"
 
 # Test 5: Get updated user
 echo -e "\n5. Getting updated user..."
-curl -s $BASE_URL/users/$USER_ID | jq '.'
+curl -s -H "$AUTH_HEADER" $BASE_URL/users/$USER_ID | jq '.'
 
 # Test 6: Create another user
 echo -e "\n6. Creating another user..."
-curl -s -X POST $BASE_URL/users \
+curl -s -H "$AUTH_HEADER" -X POST $BASE_URL/users \
   -H "Content-Type: application/json" \
   -d '{
     "username": "testuser2",
@@ -66,14 +81,14 @@ curl -s -X POST $BASE_URL/users \
 
 # Test 7: Get all users again
 echo -e "\n7. Getting all users after creating second user..."
-curl -s $BASE_URL/users | jq '.'
+curl -s -H "$AUTH_HEADER" $BASE_URL/users | jq '.'
 
 # Test 8: Delete the first user
 echo -e "\n8. Deleting user with ID: $USER_ID"
-curl -s -X DELETE $BASE_URL/users/$USER_ID | jq '.'
+curl -s -H "$AUTH_HEADER" -X DELETE $BASE_URL/users/$USER_ID | jq '.'
 
 # Test 9: Verify user is deleted
 echo -e "\n9. Verifying user is deleted..."
-curl -s $BASE_URL/users/$USER_ID | jq '.'
+curl -s -H "$AUTH_HEADER" $BASE_URL/users/$USER_ID | jq '.'
 
 echo -e "\nAPI testing completed!"
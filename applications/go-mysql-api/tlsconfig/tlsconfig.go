@@ -0,0 +1,185 @@
+// Package tlsconfig builds the TLS configuration of the API server and of
+// its connections to MySQL. The server certificate and the client CA bundle
+// are read from files and can be reloaded while serving, e.g. after
+// cert-manager renewed them.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+// Options configures the server side of TLS
+type Options struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is the PEM bundle client certificates are verified
+	// against. It is required unless ClientAuth is "none".
+	ClientCAFile string
+	// ClientAuth is "none", "optional" (verify a certificate if the client
+	// sends one) or "require"
+	ClientAuth string
+	// MinVersion is "1.2" or "1.3"
+	MinVersion string
+	// CipherSuites names the TLS 1.2 cipher suites to offer, e.g.
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256; empty keeps Go's defaults.
+	// TLS 1.3 suites are not configurable.
+	CipherSuites []string
+}
+
+// Reloader serves the current certificate and client CAs
+type Reloader struct {
+	opts         Options
+	clientAuth   tls.ClientAuthType
+	minVersion   uint16
+	cipherSuites []uint16
+
+	cert      atomic.Pointer[tls.Certificate]
+	clientCAs atomic.Pointer[x509.CertPool]
+}
+
+// New checks opts and loads the certificate and client CAs
+func New(opts Options) (*Reloader, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("tls: certificate and key files are required")
+	}
+	r := &Reloader{opts: opts}
+
+	var err error
+	if r.minVersion, err = ParseVersion(opts.MinVersion); err != nil {
+		return nil, err
+	}
+	if r.cipherSuites, err = ParseCipherSuites(opts.CipherSuites); err != nil {
+		return nil, err
+	}
+	switch opts.ClientAuth {
+	case "", "none":
+		r.clientAuth = tls.NoClientCert
+	case "optional":
+		r.clientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		r.clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("tls: unsupported client auth %q", opts.ClientAuth)
+	}
+	if r.clientAuth != tls.NoClientCert && opts.ClientCAFile == "" {
+		return nil, errors.New("tls: a client CA file is required to verify client certificates")
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate, key and client CAs again. On error the
+// previous ones stay in use.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("tls: loading certificate: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.opts.ClientCAFile != "" {
+		if pool, err = loadCertPool(r.opts.ClientCAFile); err != nil {
+			return fmt.Errorf("tls: reading client CAs: %w", err)
+		}
+	}
+
+	r.cert.Store(&cert)
+	r.clientCAs.Store(pool)
+	return nil
+}
+
+// Files returns the files Reload reads, for change detection
+func (r *Reloader) Files() []string {
+	files := []string{r.opts.CertFile, r.opts.KeyFile}
+	if r.opts.ClientCAFile != "" {
+		files = append(files, r.opts.ClientCAFile)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Config returns the server configuration. Every handshake uses the
+// certificate and client CAs loaded last.
+func (r *Reloader) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion:   r.minVersion,
+		CipherSuites: r.cipherSuites,
+		// http.Server.ServeTLS requires a certificate source
+		GetCertificate: r.certificate,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.handshakeConfig(), nil
+		},
+	}
+}
+
+func (r *Reloader) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// handshakeConfig is the configuration of one handshake; it replaces the
+// one given to the server, so it repeats the protocols ServeTLS adds
+func (r *Reloader) handshakeConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     r.minVersion,
+		CipherSuites:   r.cipherSuites,
+		GetCertificate: r.certificate,
+		ClientAuth:     r.clientAuth,
+		ClientCAs:      r.clientCAs.Load(),
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+}
+
+// ParseVersion converts "1.2" or "1.3" to a TLS version
+func ParseVersion(v string) (uint16, error) {
+	switch v {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("tls: unsupported minimum version %q", v)
+	}
+}
+
+// ParseCipherSuites converts cipher suite names to their IDs. Only the
+// suites Go considers secure are accepted.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		known[s.Name] = s.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("tls: unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// loadCertPool reads a PEM bundle of CA certificates
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,245 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA signs the certificates of a test
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for cn
+func (ca *testCA) issue(t *testing.T, cn string, serial int64, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func write(t *testing.T, path string, b []byte) {
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+}
+
+// handshake connects a client using cfg to a server using r and returns
+// the serial of the server certificate
+func handshake(t *testing.T, r *Reloader, cfg *tls.Config) (*big.Int, error) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	server := tls.Server(serverConn, r.Config())
+	errc := make(chan error, 1)
+	go func() { errc <- server.Handshake() }()
+
+	client := tls.Client(clientConn, cfg)
+	if err := client.Handshake(); err != nil {
+		return nil, err
+	}
+	// With TLS 1.3 the server rejects a client certificate after the client
+	// has finished; reading lets its alert through the unbuffered pipe
+	go io.Copy(io.Discard, client)
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	return client.ConnectionState().PeerCertificates[0].SerialNumber, nil
+}
+
+func TestReloaderServesRotatedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	cert, key := ca.issue(t, "api.example.com", 10, x509.ExtKeyUsageServerAuth)
+	write(t, certFile, cert)
+	write(t, keyFile, key)
+
+	r, err := New(Options{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2"})
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := &tls.Config{RootCAs: roots, ServerName: "api.example.com"}
+
+	serial, err := handshake(t, r, client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), serial.Int64())
+
+	cert, key = ca.issue(t, "api.example.com", 11, x509.ExtKeyUsageServerAuth)
+	write(t, certFile, cert)
+	write(t, keyFile, key)
+	require.NoError(t, r.Reload())
+
+	serial, err = handshake(t, r, client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), serial.Int64())
+
+	// A broken file keeps the last good certificate
+	write(t, keyFile, []byte("not a key"))
+	assert.Error(t, r.Reload())
+	serial, err = handshake(t, r, client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), serial.Int64())
+}
+
+func TestReloaderRequiresClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	cert, key := ca.issue(t, "api.example.com", 10, x509.ExtKeyUsageServerAuth)
+	write(t, certFile, cert)
+	write(t, keyFile, key)
+	write(t, caFile, ca.pem)
+
+	r, err := New(Options{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: "require", MinVersion: "1.3"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{caFile, certFile, keyFile}, r.Files())
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	_, err = handshake(t, r, &tls.Config{RootCAs: roots, ServerName: "api.example.com"})
+	assert.Error(t, err)
+
+	clientCert, clientKey := ca.issue(t, "reporting", 20, x509.ExtKeyUsageClientAuth)
+	pair, err := tls.X509KeyPair(clientCert, clientKey)
+	require.NoError(t, err)
+	_, err = handshake(t, r, &tls.Config{RootCAs: roots, ServerName: "api.example.com", Certificates: []tls.Certificate{pair}})
+	assert.NoError(t, err)
+
+	// TLS 1.2 clients are turned away with MinVersion 1.3
+	_, err = handshake(t, r, &tls.Config{RootCAs: roots, ServerName: "api.example.com", Certificates: []tls.Certificate{pair}, MaxVersion: tls.VersionTLS12})
+	assert.Error(t, err)
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	_, err := New(Options{})
+	assert.Error(t, err)
+	_, err = New(Options{CertFile: "a", KeyFile: "b", ClientAuth: "require"})
+	assert.ErrorContains(t, err, "client CA")
+	_, err = New(Options{CertFile: "a", KeyFile: "b", MinVersion: "1.0"})
+	assert.Error(t, err)
+
+	_, err = ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"})
+	assert.Error(t, err)
+	ids, err := ParseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"})
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, ids)
+}
+
+// dial connects a client using cfg to a server using r over TCP. A client
+// rejecting the server sends its alert while the server is still writing,
+// which would block on a pipe.
+func dial(t *testing.T, r *Reloader, cfg *tls.Config) error {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", r.Config())
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), cfg)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestClientVerifiesServer(t *testing.T) {
+	dir := t.TempDir()
+	ca, other := newTestCA(t), newTestCA(t)
+	certFile, keyFile, caFile, otherFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt"), filepath.Join(dir, "other.crt")
+	cert, key := ca.issue(t, "db.internal", 10, x509.ExtKeyUsageServerAuth)
+	write(t, certFile, cert)
+	write(t, keyFile, key)
+	write(t, caFile, ca.pem)
+	write(t, otherFile, other.pem)
+
+	r, err := New(Options{CertFile: certFile, KeyFile: keyFile})
+	require.NoError(t, err)
+
+	tests := []struct {
+		opts ClientOptions
+		ok   bool
+	}{
+		{ClientOptions{Mode: "required", CAFile: otherFile}, true},
+		{ClientOptions{Mode: "verify-ca", CAFile: caFile, ServerName: "elsewhere.internal"}, true},
+		{ClientOptions{Mode: "verify-ca", CAFile: otherFile}, false},
+		{ClientOptions{Mode: "verify-identity", CAFile: caFile, ServerName: "db.internal"}, true},
+		{ClientOptions{Mode: "verify-identity", CAFile: caFile, ServerName: "elsewhere.internal"}, false},
+		{ClientOptions{Mode: "verify-identity", CAFile: otherFile, ServerName: "db.internal"}, false},
+	}
+	for _, tt := range tests {
+		cfg, err := Client(tt.opts)
+		require.NoError(t, err)
+		err = dial(t, r, cfg)
+		assert.Equal(t, tt.ok, err == nil, "%+v: %v", tt.opts, err)
+	}
+}
+
+func TestClientRejectsInvalidOptions(t *testing.T) {
+	cfg, err := Client(ClientOptions{Mode: "disabled"})
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	_, err = Client(ClientOptions{Mode: "verify-identity"})
+	assert.ErrorContains(t, err, "server name")
+	_, err = Client(ClientOptions{Mode: "verify-full"})
+	assert.Error(t, err)
+	_, err = Client(ClientOptions{Mode: "verify-ca", CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DB is the part of *sql.DB that WrapDB traces. It matches store.DB.
+type DB interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// tracedDB starts a client span for every statement run on db
+type tracedDB struct {
+	db   DB
+	name string
+}
+
+// WrapDB returns a DB recording each statement run on db as a child span of
+// the span in its context. name is the database, reported as db.namespace.
+// Statements are recorded with their literals replaced by ?, and the
+// arguments are never recorded.
+func WrapDB(db DB, name string) DB {
+	return &tracedDB{db: db, name: name}
+}
+
+func (t *tracedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+	result, err := t.db.ExecContext(ctx, query, args...)
+	recordError(span, err)
+	return result, err
+}
+
+func (t *tracedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	recordError(span, err)
+	return rows, err
+}
+
+// QueryRowContext ends the span once the query has run; errors reported
+// only by Scan, such as sql.ErrNoRows, are not recorded
+func (t *tracedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+	row := t.db.QueryRowContext(ctx, query, args...)
+	recordError(span, row.Err())
+	return row
+}
+
+func (t *tracedDB) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	statement := Sanitize(query)
+	operation := operationName(statement)
+	name := operation
+	if t.name != "" {
+		name += " " + t.name
+	}
+	return tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemMySQL,
+			semconv.DBNamespace(t.name),
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(statement),
+		),
+	)
+}
+
+func recordError(span trace.Span, err error) {
+	if err == nil || errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+var (
+	// sqlLiteral matches quoted strings, hex and numeric literals. Digits
+	// inside identifiers such as t1 are left alone by the word boundary.
+	sqlLiteral = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.|"")*"|\b0[xX][0-9a-fA-F]+\b|\b\d+(?:\.\d+)?(?:[eE][+-]?\d+)?\b`)
+	whitespace = regexp.MustCompile(`\s+`)
+)
+
+// Sanitize replaces the literals of a SQL statement with ? and collapses
+// whitespace, so that the statement can be recorded without the values it
+// was built with
+func Sanitize(query string) string {
+	query = sqlLiteral.ReplaceAllString(query, "?")
+	return strings.TrimSpace(whitespace.ReplaceAllString(query, " "))
+}
+
+// operationName returns the leading keyword of statement, e.g. SELECT
+func operationName(statement string) string {
+	op, _, _ := strings.Cut(statement, " ")
+	return strings.ToUpper(op)
+}
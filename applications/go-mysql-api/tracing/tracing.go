@@ -0,0 +1,141 @@
+// Package tracing sets up OpenTelemetry tracing for the API: a tracer
+// provider exporting over OTLP or to stdout, W3C trace context propagation,
+// a server span per HTTP request and a client span per SQL statement.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation names the tracer used for the spans of this package
+const instrumentation = "goapp_CI/tracing"
+
+// Options configures the tracer provider
+type Options struct {
+	// Exporter is "none", "otlp" or "stdout"
+	Exporter string
+	// Protocol is the OTLP transport, "grpc" or "http/protobuf"
+	Protocol string
+	// Endpoint is the OTLP collector URL, e.g. http://otel-collector:4317.
+	// Empty uses the exporter default, localhost on the standard port.
+	Endpoint string
+	// Stdout receives the spans of the stdout exporter; nil is os.Stdout
+	Stdout io.Writer
+
+	ServiceName string
+	Version     string
+	Environment string
+	// SampleRatio is the share of new traces recorded; traces started by a
+	// caller follow the caller's decision
+	SampleRatio float64
+}
+
+// Setup installs the W3C trace context and baggage propagators and, unless
+// the exporter is "none", a global tracer provider. The returned function
+// flushes the pending spans and stops the provider.
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, err := newExporter(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(opts.ServiceName),
+		semconv.ServiceVersion(opts.Version),
+		semconv.DeploymentEnvironment(opts.Environment),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// newExporter returns the exporter selected by opts, or nil for "none"
+func newExporter(ctx context.Context, opts Options) (sdktrace.SpanExporter, error) {
+	switch opts.Exporter {
+	case "", "none":
+		return nil, nil
+
+	case "stdout":
+		w := opts.Stdout
+		if w == nil {
+			w = os.Stdout
+		}
+		return stdouttrace.New(stdouttrace.WithWriter(w))
+
+	case "otlp":
+		switch opts.Protocol {
+		case "", "grpc":
+			var o []otlptracegrpc.Option
+			if opts.Endpoint != "" {
+				o = append(o, otlptracegrpc.WithEndpointURL(opts.Endpoint))
+			}
+			return otlptracegrpc.New(ctx, o...)
+
+		case "http/protobuf":
+			var o []otlptracehttp.Option
+			if opts.Endpoint != "" {
+				endpoint, err := tracesURL(opts.Endpoint)
+				if err != nil {
+					return nil, err
+				}
+				o = append(o, otlptracehttp.WithEndpointURL(endpoint))
+			}
+			return otlptracehttp.New(ctx, o...)
+
+		default:
+			return nil, fmt.Errorf("tracing: unsupported OTLP protocol %q", opts.Protocol)
+		}
+
+	default:
+		return nil, fmt.Errorf("tracing: unsupported exporter %q", opts.Exporter)
+	}
+}
+
+// tracesURL returns the OTLP/HTTP traces URL for a collector base URL,
+// adding the standard /v1/traces path when endpoint has none
+func tracesURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("tracing: invalid endpoint: %w", err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("tracing: endpoint %q has no host", endpoint)
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path = "/v1/traces"
+	}
+	return u.String(), nil
+}
+
+// tracer returns the tracer of the current global provider
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
@@ -0,0 +1,193 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider keeping finished spans in memory
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		tp.Shutdown(context.Background())
+		otel.SetTracerProvider(prev)
+	})
+	return exporter
+}
+
+func attr(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	exporter := recordSpans(t)
+
+	r := mux.NewRouter()
+	r.Use(Middleware)
+	r.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, trace.SpanFromContext(r.Context()).SpanContext().IsValid())
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	req := httptest.NewRequest("GET", "/users/7", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET /users/{id}", span.Name)
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+	assert.True(t, span.Parent.IsRemote())
+	assert.Equal(t, "/users/{id}", attr(span, "http.route").AsString())
+	assert.Equal(t, int64(503), attr(span, "http.response.status_code").AsInt64())
+	assert.Equal(t, codes.Error, span.Status.Code)
+}
+
+func TestMiddlewareStartsTrace(t *testing.T) {
+	exporter := recordSpans(t)
+
+	r := mux.NewRouter()
+	r.Use(Middleware)
+	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.False(t, spans[0].Parent.IsValid())
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+}
+
+// fakeDB records the context of the last statement
+type fakeDB struct {
+	err error
+	ctx context.Context
+}
+
+func (f *fakeDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	f.ctx = ctx
+	return nil, f.err
+}
+
+func (f *fakeDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	f.ctx = ctx
+	return nil, f.err
+}
+
+func (f *fakeDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	f.ctx = ctx
+	return &sql.Row{}
+}
+
+func TestWrapDBRecordsChildSpans(t *testing.T) {
+	exporter := recordSpans(t)
+	fake := &fakeDB{}
+	db := WrapDB(fake, "users")
+
+	ctx, parent := tracer().Start(context.Background(), "request")
+	db.QueryRowContext(ctx, "SELECT id FROM users WHERE email = 'a@example.com' AND id = 42")
+	assert.Equal(t, trace.SpanFromContext(fake.ctx).SpanContext().TraceID(), parent.SpanContext().TraceID())
+	fake.err = errors.New("deadlock")
+	db.ExecContext(ctx, "UPDATE users SET version = version + 1 WHERE id = ?", 1)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+
+	query := spans[0]
+	assert.Equal(t, "SELECT users", query.Name)
+	assert.Equal(t, trace.SpanKindClient, query.SpanKind)
+	assert.Equal(t, parent.SpanContext().SpanID(), query.Parent.SpanID())
+	assert.Equal(t, "SELECT id FROM users WHERE email = ? AND id = ?", attr(query, "db.query.text").AsString())
+	assert.Equal(t, "mysql", attr(query, "db.system").AsString())
+	assert.Equal(t, codes.Unset, query.Status.Code)
+
+	exec := spans[1]
+	assert.Equal(t, "UPDATE users", exec.Name)
+	assert.Equal(t, "UPDATE users SET version = version + ? WHERE id = ?", attr(exec, "db.query.text").AsString())
+	assert.Equal(t, codes.Error, exec.Status.Code)
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM users WHERE id = ?", "SELECT * FROM users WHERE id = ?"},
+		{"SELECT * FROM users WHERE id = 12", "SELECT * FROM users WHERE id = ?"},
+		{"SELECT * FROM t1 WHERE name = 'O\\'Brien' OR name = 'it''s'", "SELECT * FROM t1 WHERE name = ? OR name = ?"},
+		{`INSERT INTO users (email) VALUES ("a@example.com")`, "INSERT INTO users (email) VALUES (?)"},
+		{"SELECT 0xFF, 1.5e3, -7", "SELECT ?, ?, -?"},
+		{"SELECT id\n\tFROM  users\n", "SELECT id FROM users"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Sanitize(tt.query), tt.query)
+	}
+}
+
+func TestSetupStdout(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	var buf bytes.Buffer
+	shutdown, err := Setup(context.Background(), Options{Exporter: "stdout", Stdout: &buf, ServiceName: "go-mysql-api", SampleRatio: 1})
+	require.NoError(t, err)
+
+	_, span := tracer().Start(context.Background(), "stdout-span")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	assert.Contains(t, buf.String(), `"Name":"stdout-span"`)
+	assert.Contains(t, buf.String(), "go-mysql-api")
+}
+
+func TestSetupNone(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Options{Exporter: "none"})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = Setup(context.Background(), Options{Exporter: "zipkin"})
+	assert.Error(t, err)
+	_, err = Setup(context.Background(), Options{Exporter: "otlp", Protocol: "http/json"})
+	assert.Error(t, err)
+}
+
+func TestTracesURL(t *testing.T) {
+	u, err := tracesURL("http://otel-collector:4318")
+	require.NoError(t, err)
+	assert.Equal(t, "http://otel-collector:4318/v1/traces", u)
+
+	u, err = tracesURL("https://collector.example.com/otlp/v1/traces")
+	require.NoError(t, err)
+	assert.Equal(t, "https://collector.example.com/otlp/v1/traces", u)
+
+	_, err = tracesURL("otel-collector:4318")
+	assert.Error(t, err)
+}
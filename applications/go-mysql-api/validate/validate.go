@@ -0,0 +1,209 @@
+// Package validate checks request bodies against rules declared in struct
+// tags and reports every failing field at once:
+//
+//	type CreateUserRequest struct {
+//		Username string `json:"username" validate:"required,username,max=50"`
+//		Email    string `json:"email" validate:"required,email,max=100"`
+//	}
+//
+// Fields are reported by their JSON name. Rules other than required pass
+// on empty values, so optional fields only need checking when present.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Codes of the field errors, stable for clients to match on
+const (
+	CodeRequired     = "required"
+	CodeTooShort     = "too_short"
+	CodeTooLong      = "too_long"
+	CodeInvalidEmail = "invalid_email"
+	CodeInvalidChars = "invalid_characters"
+	CodeWeakPassword = "weak_password"
+	CodeInvalidType  = "invalid_type"
+	CodeInvalidValue = "invalid_value"
+	CodeUnknown      = "unknown_field"
+	CodeReadOnly     = "read_only"
+)
+
+// FieldError is a problem with one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors are the problems found in a request
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Add records a problem with field
+func (e *Errors) Add(field, code, format string, args ...any) {
+	*e = append(*e, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns e as an error, or nil if e is empty
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// PasswordPolicy is what the password rule requires of a password
+type PasswordPolicy struct {
+	MinLength int
+	// MaxLength bounds the work of hashing; 0 means no limit
+	MaxLength int
+	// MinClasses is how many of lower case letters, upper case letters,
+	// digits and other characters a password must mix
+	MinClasses int
+}
+
+// DefaultPasswordPolicy is NIST SP 800-63B's minimum
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 8, MaxLength: 128, MinClasses: 1}
+
+// Validator checks structs against their validate tags
+type Validator struct {
+	Password PasswordPolicy
+}
+
+// New returns a Validator enforcing password policy p
+func New(p PasswordPolicy) *Validator {
+	return &Validator{Password: p}
+}
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Struct checks the string fields of the struct s points to. It returns
+// Errors listing every failing field, or nil. Unknown rules panic, as they
+// are programming errors.
+func (v *Validator) Struct(s any) error {
+	var errs Errors
+	rv := reflect.Indirect(reflect.ValueOf(s))
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		rules, ok := f.Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+		if f.Type.Kind() != reflect.String {
+			panic("validate: rules on non-string field " + f.Name)
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" {
+			name = f.Name
+		}
+		v.Value(&errs, name, rv.Field(i).String(), rules)
+	}
+	return errs.Err()
+}
+
+// Value checks value against comma-separated rules, adding the first
+// failing one to errs
+func (v *Validator) Value(errs *Errors, field, value, rules string) {
+	for _, rule := range strings.Split(rules, ",") {
+		rule, param, _ := strings.Cut(rule, "=")
+		if value == "" {
+			if rule == "required" {
+				errs.Add(field, CodeRequired, "is required")
+				return
+			}
+			continue
+		}
+		n := utf8.RuneCountInString(value)
+		switch rule {
+		case "required":
+		case "max":
+			if max := atoi(param); n > max {
+				errs.Add(field, CodeTooLong, "must be at most %d characters", max)
+				return
+			}
+		case "min":
+			if min := atoi(param); n < min {
+				errs.Add(field, CodeTooShort, "must be at least %d characters", min)
+				return
+			}
+		case "email":
+			if !validEmail(value) {
+				errs.Add(field, CodeInvalidEmail, "must be an email address")
+				return
+			}
+		case "username":
+			if !usernamePattern.MatchString(value) {
+				errs.Add(field, CodeInvalidChars, "must start with a letter or digit and contain only letters, digits, '.', '_' and '-'")
+				return
+			}
+		case "password":
+			if code, msg := v.Password.check(value); code != "" {
+				errs.Add(field, code, "%s", msg)
+				return
+			}
+		default:
+			panic("validate: unknown rule " + rule)
+		}
+	}
+}
+
+func atoi(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		panic("validate: invalid rule parameter " + s)
+	}
+	return n
+}
+
+// validEmail accepts a bare addr-spec with a dotted domain, as stored in
+// the users table
+func validEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return false
+	}
+	_, domain, _ := strings.Cut(s, "@")
+	return strings.Contains(strings.Trim(domain, "."), ".")
+}
+
+func (p PasswordPolicy) check(pw string) (code, msg string) {
+	n := utf8.RuneCountInString(pw)
+	if n < p.MinLength {
+		return CodeTooShort, fmt.Sprintf("must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && n > p.MaxLength {
+		return CodeTooLong, fmt.Sprintf("must be at most %d characters", p.MaxLength)
+	}
+	var lower, upper, digit, other int
+	for _, r := range pw {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	if lower+upper+digit+other < p.MinClasses {
+		return CodeWeakPassword, fmt.Sprintf("must mix at least %d of lower case letters, upper case letters, digits and symbols", p.MinClasses)
+	}
+	return "", ""
+}
@@ -0,0 +1,78 @@
+package validate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type signup struct {
+	Username string `json:"username" validate:"required,username,max=50"`
+	Email    string `json:"email,omitempty" validate:"required,email,max=100"`
+	Password string `json:"password" validate:"required,password"`
+	Nickname string `json:"nickname" validate:"min=3"`
+	Ignored  string
+}
+
+func TestStructReportsEveryField(t *testing.T) {
+	v := New(DefaultPasswordPolicy)
+
+	require.NoError(t, v.Struct(&signup{Username: "alice.b-c_1", Email: "alice@example.com", Password: "correct horse"}))
+
+	err := v.Struct(signup{Username: "-alice", Password: "short", Nickname: "al"})
+	var errs Errors
+	require.ErrorAs(t, err, &errs)
+	assert.Equal(t, Errors{
+		{Field: "username", Code: CodeInvalidChars, Message: "must start with a letter or digit and contain only letters, digits, '.', '_' and '-'"},
+		{Field: "email", Code: CodeRequired, Message: "is required"},
+		{Field: "password", Code: CodeTooShort, Message: "must be at least 8 characters"},
+		{Field: "nickname", Code: CodeTooShort, Message: "must be at least 3 characters"},
+	}, errs)
+	assert.Contains(t, err.Error(), "email: is required")
+}
+
+func TestLengthsCountCharacters(t *testing.T) {
+	v := New(DefaultPasswordPolicy)
+	var errs Errors
+	v.Value(&errs, "name", "ééééé", "max=5")
+	assert.Empty(t, errs)
+	v.Value(&errs, "name", "éééééé", "max=5")
+	require.Len(t, errs, 1)
+	assert.Equal(t, CodeTooLong, errs[0].Code)
+}
+
+func TestEmail(t *testing.T) {
+	for _, ok := range []string{"a@example.com", "first.last+tag@sub.example.org"} {
+		assert.True(t, validEmail(ok), ok)
+	}
+	for _, bad := range []string{"a", "a@", "@example.com", "a@localhost", "Alice <a@example.com>", " a@example.com", "a@b@example.com"} {
+		assert.False(t, validEmail(bad), bad)
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	p := PasswordPolicy{MinLength: 10, MaxLength: 20, MinClasses: 3}
+	tests := []struct {
+		password string
+		code     string
+	}{
+		{"Abcdefgh1!", ""},
+		{"Abcdefgh12", ""},
+		{"abcdefgh12", CodeWeakPassword},
+		{"Abc1!", CodeTooShort},
+		{"Abcdefgh1!Abcdefgh1!x", CodeTooLong},
+	}
+	for _, tt := range tests {
+		code, _ := p.check(tt.password)
+		assert.Equal(t, tt.code, code, tt.password)
+	}
+}
+
+func TestUnknownRulePanics(t *testing.T) {
+	assert.Panics(t, func() {
+		New(DefaultPasswordPolicy).Struct(&struct {
+			Name string `validate:"uuid"`
+		}{Name: "x"})
+	})
+}